@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	// rugWatchRefresh is how often the watched tokens and the AntiRug
+	// setting are re-read while subscribed.
+	rugWatchRefresh = time.Minute
+	// rugRetryDelay is how long the guard waits before watching again after
+	// AntiRug is off or the watch fails.
+	rugRetryDelay = time.Minute
+	// rugEscapeTimeout bounds an escape sell including its approvals. A
+	// token is not escaped again until the previous escape has timed out.
+	rugEscapeTimeout = 3 * time.Minute
+)
+
+// rugFeeMultiplier is how far an escape sell outbids the rug transaction.
+var rugFeeMultiplier = big.NewInt(2)
+
+const uniswapV2LiquidityABIJSON = `[
+	{"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountAMin","type":"uint256"},{"name":"amountBMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"removeLiquidity","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"token","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"removeLiquidityETH","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"token","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"removeLiquidityETHSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountAMin","type":"uint256"},{"name":"amountBMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"},{"name":"approveMax","type":"bool"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"name":"removeLiquidityWithPermit","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"token","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"},{"name":"approveMax","type":"bool"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"name":"removeLiquidityETHWithPermit","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"token","type":"address"},{"name":"liquidity","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"},{"name":"approveMax","type":"bool"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"name":"removeLiquidityETHWithPermitSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var uniswapV2LiquidityABI = mustParseABI(uniswapV2LiquidityABIJSON)
+
+// pairBurnSelector is burn(address), called on a pair to redeem LP tokens
+// sent to it directly.
+var pairBurnSelector = selector("burn(address)")
+
+// ownerRugSelectors are owner-only token functions commonly used to trap
+// holders by blacklisting them or raising taxes.
+var ownerRugSelectors = map[[4]byte]string{}
+
+func init() {
+	for _, signature := range []string{
+		"blacklist(address)",
+		"addToBlacklist(address)",
+		"setBlacklist(address,bool)",
+		"blacklistAddress(address,bool)",
+		"addBots(address[])",
+		"setBots(address[])",
+		"setBots(address[],bool)",
+		"blockBots(address[])",
+		"setFee(uint256,uint256)",
+		"setFees(uint256,uint256)",
+		"setTaxes(uint256,uint256)",
+		"updateFees(uint256,uint256)",
+		"setBuyTax(uint256)",
+		"setSellTax(uint256)",
+		"setTaxFeePercent(uint256)",
+		"setSwapFees(uint256,uint256)",
+		"updateBuyFees(uint256,uint256,uint256)",
+		"updateSellFees(uint256,uint256,uint256)",
+	} {
+		ownerRugSelectors[selector(signature)] = signature[:strings.Index(signature, "(")]
+	}
+}
+
+func selector(signature string) [4]byte {
+	var id [4]byte
+	copy(id[:], crypto.Keccak256([]byte(signature))[:4])
+	return id
+}
+
+// rugTarget is a held token and the contracts a rug on it would touch.
+type rugTarget struct {
+	Token common.Address
+	Pair  common.Address
+	Owner common.Address
+}
+
+// rugWatch indexes the targets watched on one chain.
+type rugWatch struct {
+	router  common.Address
+	byToken map[common.Address]*rugTarget
+	byPair  map[common.Address]*rugTarget
+}
+
+// rugThreat is a pending transaction that would rug a held token.
+type rugThreat struct {
+	Target *rugTarget
+	Kind   string
+	Tx     *types.Transaction
+}
+
+// loadRugWatch builds the watch list from every token the wallets have
+// traded on cfg.
+func (a *application) loadRugWatch(ctx context.Context, client *ethclient.Client, cfg chainConfig) (*rugWatch, error) {
+	tokens, err := database.GetChainTokens(a.db, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	watch := &rugWatch{
+		router:  common.HexToAddress(cfg.V2Router),
+		byToken: make(map[common.Address]*rugTarget),
+		byPair:  make(map[common.Address]*rugTarget),
+	}
+	for _, token := range tokens {
+		target := &rugTarget{Token: common.HexToAddress(token)}
+		if pair, err := findV2Pair(ctx, client, cfg, target.Token); err == nil {
+			target.Pair = pair.Address
+			watch.byPair[pair.Address] = target
+		}
+		if out, err := callContract(ctx, client, target.Token, ownableABI, "owner"); err == nil {
+			target.Owner = out[0].(common.Address)
+		}
+		watch.byToken[target.Token] = target
+	}
+	return watch, nil
+}
+
+// match reports whether tx removes liquidity of a watched token, or is an
+// owner call that blacklists holders or changes taxes. Liquidity removals are
+// flagged from any sender, since ownership may already be renounced.
+func (w *rugWatch) match(tx *types.Transaction) *rugThreat {
+	to, data := tx.To(), tx.Data()
+	if to == nil || len(data) < 4 {
+		return nil
+	}
+	var id [4]byte
+	copy(id[:], data[:4])
+
+	if *to == w.router {
+		method, err := uniswapV2LiquidityABI.MethodById(data[:4])
+		if err != nil {
+			return nil
+		}
+		args, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			return nil
+		}
+		for _, arg := range args[:2] {
+			if address, ok := arg.(common.Address); ok {
+				if target, ok := w.byToken[address]; ok {
+					return &rugThreat{Target: target, Kind: "liquidity removal", Tx: tx}
+				}
+			}
+		}
+		return nil
+	}
+
+	if target, ok := w.byPair[*to]; ok && id == pairBurnSelector {
+		return &rugThreat{Target: target, Kind: "liquidity removal", Tx: tx}
+	}
+
+	target, ok := w.byToken[*to]
+	if !ok || target.Owner == (common.Address{}) {
+		return nil
+	}
+	name, ok := ownerRugSelectors[id]
+	if !ok {
+		return nil
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil || sender != target.Owner {
+		return nil
+	}
+	return &rugThreat{Target: target, Kind: fmt.Sprintf("owner call %s", name), Tx: tx}
+}
+
+// guardAgainstRugs watches the mempool of the active chain while AntiRug is
+// on and sells held tokens ahead of transactions that would rug them.
+func (a *application) guardAgainstRugs(ctx context.Context) {
+	escaped := make(map[common.Address]time.Time)
+	for {
+		if err := a.watchMempool(ctx, escaped); err != nil {
+			log.Printf("AntiRug mempool watch stopped: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rugRetryDelay):
+		}
+	}
+}
+
+// watchMempool escapes each threatened token at most once per
+// rugEscapeTimeout; escaped records when each escape started.
+func (a *application) watchMempool(ctx context.Context, escaped map[common.Address]time.Time) error {
+	if !a.defaultSettings().AntiRug {
+		return nil
+	}
+	cfg, err := a.currentChain()
+	if err != nil {
+		return err
+	}
+	if !cfg.isEVM() || !cfg.hasDEX() {
+		return nil
+	}
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return err
+	}
+	watch, err := a.loadRugWatch(ctx, client, cfg)
+	if err != nil {
+		return err
+	}
+
+	pool, err := a.mempool(cfg)
+	if err != nil {
+		return err
+	}
+	pending, unsubscribe := pool.subscribe(nil)
+	defer unsubscribe()
+
+	refresh := time.NewTicker(rugWatchRefresh)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-refresh.C:
+			if !a.defaultSettings().AntiRug {
+				return nil
+			}
+			if current, err := a.currentChain(); err != nil || current.Name != cfg.Name {
+				return nil
+			}
+			if watch, err = a.loadRugWatch(ctx, client, cfg); err != nil {
+				return err
+			}
+		case e := <-pending:
+			threat := watch.match(e.Tx)
+			if threat == nil {
+				continue
+			}
+			if started, ok := escaped[threat.Target.Token]; ok && time.Since(started) < rugEscapeTimeout {
+				continue
+			}
+			escaped[threat.Target.Token] = time.Now()
+			go a.escapeRug(cfg, threat)
+		}
+	}
+}
+
+// outbidFees prices a transaction to be mined ahead of tx.
+func outbidFees(ctx context.Context, client *ethclient.Client, tx *types.Transaction) (*feeQuote, error) {
+	fees, err := suggestFees(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if !fees.Dynamic {
+		return &feeQuote{GasPrice: maxBig(fees.GasPrice, new(big.Int).Mul(tx.GasPrice(), rugFeeMultiplier))}, nil
+	}
+	tip := maxBig(fees.TipCap, new(big.Int).Mul(tx.GasTipCap(), rugFeeMultiplier))
+	feeCap := maxBig(fees.FeeCap, new(big.Int).Mul(tx.GasFeeCap(), rugFeeMultiplier))
+	return &feeQuote{Dynamic: true, TipCap: tip, FeeCap: maxBig(feeCap, tip)}, nil
+}
+
+func maxBig(x, y *big.Int) *big.Int {
+	if x.Cmp(y) >= 0 {
+		return x
+	}
+	return y
+}
+
+// escapeRug sells the threatened token from every wallet holding it and
+// reports to the chats that traded it.
+func (a *application) escapeRug(cfg chainConfig, threat *rugThreat) {
+	ctx, cancel := context.WithTimeout(context.Background(), rugEscapeTimeout)
+	defer cancel()
+
+	token := threat.Target.Token
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		log.Printf("AntiRug: %v", err)
+		return
+	}
+	info, err := readTokenInfo(ctx, client, token)
+	if err != nil {
+		log.Printf("AntiRug: failed to read token %s: %v", token.Hex(), err)
+		return
+	}
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("AntiRug: failed to fetch wallets: %v", err)
+		return
+	}
+	chats, err := database.GetTokenTradeChats(a.db, cfg.Name, token.Hex())
+	if err != nil {
+		log.Printf("AntiRug: failed to fetch chats for %s: %v", token.Hex(), err)
+	}
+	chatID := ""
+	if len(chats) > 0 {
+		chatID = chats[0]
+	}
+
+	fees, err := outbidFees(ctx, client, threat.Tx)
+	var results []swapResult
+	if err == nil {
+		results, err = a.sellTokenWithFees(ctx, cfg, chatID, info, sellSpec{Percent: 100}, wallets, fees, true)
+	}
+
+	outcome := formatSwapResults(cfg, results)
+	if err != nil {
+		outcome = "❌ Sell failed: " + markdownEscaper.Replace(err.Error())
+	} else if len(results) == 0 {
+		outcome = "None of your wallets held it any more."
+	}
+	rugMsg := fmt.Sprintf(`🛡 AntiRug (🔗%s)
+
+Detected a pending %s on %s in [%s](%s).
+Sold 100%% from every holding wallet:
+
+%s`, cfg.Name, markdownEscaper.Replace(threat.Kind), markdownEscaper.Replace(info.Symbol),
+		shortAddress(threat.Tx.Hash().Hex()), cfg.txURL(threat.Tx.Hash().Hex()), outcome)
+
+	log.Printf("AntiRug: %s on %s in %s", threat.Kind, token.Hex(), threat.Tx.Hash().Hex())
+	for _, chat := range chats {
+		a.client.SendMessage(chat, rugMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+	}
+}
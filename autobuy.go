@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// autoBuyEdit is an auto-buy value waiting to be typed in.
+type autoBuyEdit struct {
+	Chain string
+	Field string
+}
+
+func makeAutoBuyButtons(config *models.AutoBuyConfig, cfg chainConfig, wallets int) *tbot.InlineKeyboardMarkup {
+	maxTax := "Default"
+	if config.MaxTax > 0 {
+		maxTax = fmt.Sprintf("%.1f%%", config.MaxTax)
+	}
+	minLiquidity := "Default"
+	if config.MinLiquidity > 0 {
+		minLiquidity = fmt.Sprintf("$%d", config.MinLiquidity)
+	}
+
+	callback := func(field string) string {
+		return fmt.Sprintf("auto_buy_set_%s_%s", field, config.Chain)
+	}
+	buttons := [][]tbot.InlineKeyboardButton{
+		{{Text: "Auto Buy:" + toggleLabel(config.Enabled), CallbackData: callback("toggle")}},
+		{{Text: fmt.Sprintf("Amount: %s %s", config.Amount, cfg.NativeSymbol), CallbackData: callback("amount")}},
+		{{Text: "Max Tax: " + maxTax, CallbackData: callback("tax")}},
+		{{Text: "Min Liquidity: " + minLiquidity, CallbackData: callback("liquidity")}},
+		{{Text: fmt.Sprintf("Wallets: %d selected", wallets), CallbackData: callback("wallets")}},
+		{{Text: "Back", CallbackData: "auto_buy_buttons"}},
+	}
+	return &tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
+
+// autoBuyHandler shows the Auto Buy settings of one chain.
+func (a *application) autoBuyHandler(chain database.ChainStatusOne, m *tbot.Message) {
+	cfg := chainConfigFor(chain)
+	config, err := database.GetAutoBuyConfig(a.db, m.Chat.ID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting auto buy config: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to load Auto Buy settings.")
+		return
+	}
+	wallets, err := database.GetDefaultWallets(a.db, m.Chat.ID, database.AutoBuyWalletsPurpose(cfg.Name))
+	if err != nil {
+		log.Printf("Error getting auto buy wallets: %v", err)
+	}
+
+	autoBuyMsg := fmt.Sprintf(`Settings > Auto Buy (🔗%s)
+
+Auto Buy will automatically purchase any contract address
+sent to the bot when this setting is on. Configure the settings
+below to control how to buy the token.`, cfg.Name)
+	if !cfg.isEVM() {
+		autoBuyMsg += fmt.Sprintf("\n\nBuying is not available on %s yet.", cfg.Name)
+	}
+
+	buttons := makeAutoBuyButtons(config, cfg, len(wallets))
+	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
+}
+
+// autoBuySettingHandler handles the buttons of the Auto Buy screen. data is
+// "<field>_<chain>".
+func (a *application) autoBuySettingHandler(data string, m *tbot.Message) {
+	field, chainName, ok := strings.Cut(data, "_")
+	if !ok {
+		log.Printf("Invalid auto buy callback: %s", data)
+		return
+	}
+	chain := convertChainStatusNameToType(chainName)
+
+	switch field {
+	case "toggle":
+		config, err := database.GetAutoBuyConfig(a.db, m.Chat.ID, chainName)
+		if err != nil {
+			log.Printf("Error getting auto buy config: %v", err)
+			return
+		}
+		config.Enabled = !config.Enabled
+		if err := database.SaveAutoBuyConfig(a.db, config); err != nil {
+			a.client.SendMessage(m.Chat.ID, "Failed to save Auto Buy settings.")
+			return
+		}
+		a.autoBuyHandler(chain, m)
+	case "wallets":
+		a.defaultWalletsSelectHandler(database.AutoBuyWalletsPurpose(chainName), m)
+	case "amount", "tax", "liquidity":
+		a.draftsMu.Lock()
+		if a.autoBuyEdits == nil {
+			a.autoBuyEdits = make(map[string]autoBuyEdit)
+		}
+		a.autoBuyEdits[m.Chat.ID] = autoBuyEdit{Chain: chainName, Field: field}
+		a.draftsMu.Unlock()
+
+		prompts := map[string]string{
+			"amount":    fmt.Sprintf("Enter the amount of %s to buy with from each wallet:", chainConfigFor(chain).NativeSymbol),
+			"tax":       "Enter the maximum buy and sell tax in percent, or 0 to use your defaults:",
+			"liquidity": "Enter the minimum liquidity in USD, or 0 to use your defaults:",
+		}
+		a.waitingForAutoBuyValue = true
+		a.client.SendMessage(m.Chat.ID, prompts[field])
+	default:
+		log.Printf("Invalid auto buy callback: %s", data)
+	}
+}
+
+// autoBuyValueHandler saves the value typed in after an Auto Buy button.
+func (a *application) autoBuyValueHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	edit, ok := a.autoBuyEdits[m.Chat.ID]
+	delete(a.autoBuyEdits, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	config, err := database.GetAutoBuyConfig(a.db, m.Chat.ID, edit.Chain)
+	if err != nil {
+		log.Printf("Error getting auto buy config: %v", err)
+		return
+	}
+	text := strings.TrimSpace(m.Text)
+	switch edit.Field {
+	case "amount":
+		amount, err := parseUnits(text, 18)
+		if err != nil || amount.Sign() <= 0 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", text))
+			return
+		}
+		config.Amount = text
+	case "tax":
+		maxTax, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+		if err != nil || maxTax < 0 || maxTax > 100 {
+			a.client.SendMessage(m.Chat.ID, "Max tax must be between 0 and 100.")
+			return
+		}
+		config.MaxTax = maxTax
+	case "liquidity":
+		minLiquidity, err := strconv.Atoi(strings.TrimPrefix(text, "$"))
+		if err != nil || minLiquidity < 0 {
+			a.client.SendMessage(m.Chat.ID, "Min liquidity must be a whole number of dollars.")
+			return
+		}
+		config.MinLiquidity = minLiquidity
+	}
+
+	if err := database.SaveAutoBuyConfig(a.db, config); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save Auto Buy settings.")
+		return
+	}
+	a.autoBuyHandler(convertChainStatusNameToType(edit.Chain), m)
+}
+
+// autoBuy buys a pasted token when the chat has Auto Buy on for cfg.
+func (a *application) autoBuy(cfg chainConfig, token string, m *tbot.Message) {
+	config, err := database.GetAutoBuyConfig(a.db, m.Chat.ID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting auto buy config: %v", err)
+		return
+	}
+	if !config.Enabled {
+		return
+	}
+
+	wallets, err := a.tradingWallets(m.Chat.ID, database.AutoBuyWalletsPurpose(cfg.Name))
+	if err != nil {
+		log.Printf("Error getting auto buy wallets: %v", err)
+		return
+	}
+	if len(wallets) == 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Auto Buy is on but no wallets are selected for %s. Choose them in Settings > Presets > Auto Buy.", cfg.Name))
+		return
+	}
+	amountIn, err := parseUnits(config.Amount, 18)
+	if err != nil {
+		log.Printf("Invalid auto buy amount %q: %v", config.Amount, err)
+		return
+	}
+	a.confirmBuy(cfg, token, amountIn, wallets, buyOptions{MaxTax: config.MaxTax, MinLiquidity: config.MinLiquidity}, m)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/l3njo/rochambeau/database"
+)
+
+// BridgeQuoteRequest describes a cross-chain transfer to be priced. Amount is
+// expressed in base units of FromToken on FromChain. ToToken is the address
+// of the token on ToChain, or empty to let the provider map FromToken.
+type BridgeQuoteRequest struct {
+	FromChain   string `json:"fromChain"`
+	ToChain     string `json:"toChain"`
+	FromToken   string `json:"fromToken"`
+	ToToken     string `json:"toToken"`
+	Amount      string `json:"amount"`
+	FromAddress string `json:"fromAddress"`
+	ToAddress   string `json:"toAddress"`
+}
+
+// BridgeQuote is a provider's offer for a BridgeQuoteRequest. AmountOut and
+// Fee are in base units; Fee is charged in FeeToken.
+type BridgeQuote struct {
+	Provider  string
+	QuoteID   string
+	Request   BridgeQuoteRequest
+	AmountOut string
+	Fee       string
+	FeeToken  string
+	ETA       time.Duration
+}
+
+// BridgeProvider moves tokens between chains.
+type BridgeProvider interface {
+	Name() string
+	// Quote prices a transfer without committing to it.
+	Quote(ctx context.Context, req BridgeQuoteRequest) (*BridgeQuote, error)
+	// Initiate starts the transfer described by quote, funds it on-chain
+	// through depositor and returns the provider's transfer ID.
+	Initiate(ctx context.Context, quote *BridgeQuote, depositor bridgeDepositor) (string, error)
+	// Status maps the provider's view of a transfer onto one of the
+	// database.TransferStatus values.
+	Status(ctx context.Context, transferID string) (string, error)
+}
+
+// bridgeDepositor sends the on-chain side of a transfer from the user's
+// wallet.
+type bridgeDepositor interface {
+	// Deposit approves spender for amount of token when spender is set, then
+	// sends value and data to the bridge contract at to.
+	Deposit(ctx context.Context, token, spender, to common.Address, amount, value *big.Int, data []byte) (*types.Transaction, error)
+}
+
+type bridgeAPIRequest struct {
+	BridgeQuoteRequest
+	QuoteID string `json:"quoteId,omitempty"`
+}
+
+type bridgeAPIQuoteResponse struct {
+	QuoteID    string `json:"quoteId"`
+	ToToken    string `json:"toToken"`
+	AmountOut  string `json:"amountOut"`
+	Fee        string `json:"fee"`
+	FeeToken   string `json:"feeToken"`
+	EtaSeconds int    `json:"etaSeconds"`
+}
+
+type bridgeAPIResponse struct {
+	TransactionID string            `json:"transactionId"`
+	Status        string            `json:"status"`
+	Deposit       *bridgeAPIDeposit `json:"deposit,omitempty"`
+}
+
+// bridgeAPIDeposit is the transaction that locks the tokens in the bridge.
+// Spender must be approved for the transfer amount first; it is empty when
+// the bridge contract needs no allowance.
+type bridgeAPIDeposit struct {
+	To      string `json:"to"`
+	Data    string `json:"data"`
+	Value   string `json:"value"`
+	Spender string `json:"spender"`
+}
+
+type bridgeAPIDepositReport struct {
+	TxHash string `json:"txHash"`
+}
+
+// httpBridgeProvider talks to a bridge service exposing the quote/transfer
+// REST API. Every provider, Wormhole included, is configured with
+// <NAME>_API_URL and <NAME>_API_KEY.
+type httpBridgeProvider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newHTTPBridgeProvider(name string) (*httpBridgeProvider, error) {
+	prefix := strings.ToUpper(name)
+	baseURL := os.Getenv(prefix + "_API_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("bridge %s has no API URL: set %s_API_URL to its quote/transfer service or remove it from BRIDGE_PROVIDERS", name, prefix)
+	}
+	return &httpBridgeProvider{
+		name:       strings.ToUpper(name[:1]) + strings.ToLower(name[1:]),
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     os.Getenv(prefix + "_API_KEY"),
+		httpClient: &http.Client{Timeout: 20 * time.Second},
+	}, nil
+}
+
+// bridgeProvidersFromEnv builds the providers listed in BRIDGE_PROVIDERS,
+// defaulting to Wormhole alone. A listed provider without an API URL is an
+// error rather than a bridge that silently fails every quote.
+func bridgeProvidersFromEnv() ([]BridgeProvider, error) {
+	names := os.Getenv("BRIDGE_PROVIDERS")
+	if names == "" {
+		names = "wormhole"
+	}
+
+	var providers []BridgeProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		provider, err := newHTTPBridgeProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func (w *httpBridgeProvider) Name() string {
+	return w.name
+}
+
+func (w *httpBridgeProvider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		requestData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(requestData)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, w.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+w.apiKey)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (w *httpBridgeProvider) Quote(ctx context.Context, req BridgeQuoteRequest) (*BridgeQuote, error) {
+	var resp bridgeAPIQuoteResponse
+	if err := w.do(ctx, http.MethodPost, "/v1/quote", bridgeAPIRequest{BridgeQuoteRequest: req}, &resp); err != nil {
+		return nil, err
+	}
+	// Without a destination token the quote could be for any asset, so one
+	// the provider did not map is refused.
+	if req.ToToken == "" {
+		req.ToToken = resp.ToToken
+	}
+	if !common.IsHexAddress(req.ToToken) {
+		return nil, fmt.Errorf("%s has no %s token matching %s", w.Name(), req.ToChain, req.FromToken)
+	}
+	return &BridgeQuote{
+		Provider:  w.Name(),
+		QuoteID:   resp.QuoteID,
+		Request:   req,
+		AmountOut: resp.AmountOut,
+		Fee:       resp.Fee,
+		FeeToken:  resp.FeeToken,
+		ETA:       time.Duration(resp.EtaSeconds) * time.Second,
+	}, nil
+}
+
+func (w *httpBridgeProvider) Initiate(ctx context.Context, quote *BridgeQuote, depositor bridgeDepositor) (string, error) {
+	var resp bridgeAPIResponse
+	err := w.do(ctx, http.MethodPost, "/v1/transfer", bridgeAPIRequest{BridgeQuoteRequest: quote.Request, QuoteID: quote.QuoteID}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.TransactionID == "" {
+		return "", fmt.Errorf("bridge returned no transfer ID")
+	}
+	if resp.Deposit == nil || !common.IsHexAddress(resp.Deposit.To) {
+		return "", fmt.Errorf("bridge returned no deposit transaction")
+	}
+
+	data, err := hexutil.Decode(resp.Deposit.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid deposit data: %w", err)
+	}
+	value := new(big.Int)
+	if resp.Deposit.Value != "" {
+		if _, ok := value.SetString(resp.Deposit.Value, 0); !ok {
+			return "", fmt.Errorf("invalid deposit value %q", resp.Deposit.Value)
+		}
+	}
+	amount, ok := new(big.Int).SetString(quote.Request.Amount, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid transfer amount %q", quote.Request.Amount)
+	}
+	var spender common.Address
+	if resp.Deposit.Spender != "" {
+		if !common.IsHexAddress(resp.Deposit.Spender) {
+			return "", fmt.Errorf("invalid deposit spender %q", resp.Deposit.Spender)
+		}
+		spender = common.HexToAddress(resp.Deposit.Spender)
+	}
+
+	tx, err := depositor.Deposit(ctx, common.HexToAddress(quote.Request.FromToken), spender, common.HexToAddress(resp.Deposit.To), amount, value, data)
+	if err != nil {
+		return "", fmt.Errorf("deposit failed: %w", err)
+	}
+
+	// The bridge only starts relaying once it has seen the deposit. The
+	// transfer is funded by now, so a failed report is logged rather than
+	// returned and the tracker picks the transfer up by its ID.
+	var reported bridgeAPIResponse
+	path := "/v1/transfer/" + resp.TransactionID + "/deposit"
+	if err := w.do(ctx, http.MethodPost, path, bridgeAPIDepositReport{TxHash: tx.Hash().Hex()}, &reported); err != nil {
+		log.Printf("Error reporting %s deposit %s: %v", w.Name(), tx.Hash().Hex(), err)
+	}
+	return resp.TransactionID, nil
+}
+
+func (w *httpBridgeProvider) Status(ctx context.Context, transferID string) (string, error) {
+	var resp bridgeAPIResponse
+	if err := w.do(ctx, http.MethodGet, "/v1/transfer/"+transferID, nil, &resp); err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(resp.Status) {
+	case "completed", "redeemed", "confirmed":
+		return database.TransferStatusConfirmed, nil
+	case "failed", "refunded":
+		return database.TransferStatusFailed, nil
+	default:
+		return database.TransferStatusPending, nil
+	}
+}
+
+// bridgeQuoteTimeout bounds how long the bridge menu waits for providers.
+const bridgeQuoteTimeout = 10 * time.Second
+
+// quoteAllBridges asks every provider for a quote in parallel and returns the
+// successful quotes ranked best first, along with the providers that failed.
+func quoteAllBridges(ctx context.Context, providers []BridgeProvider, req BridgeQuoteRequest) ([]*BridgeQuote, map[string]error) {
+	ctx, cancel := context.WithTimeout(ctx, bridgeQuoteTimeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		quotes []*BridgeQuote
+		errs   = make(map[string]error)
+	)
+	for _, provider := range providers {
+		wg.Add(1)
+		go func(provider BridgeProvider) {
+			defer wg.Done()
+			quote, err := provider.Quote(ctx, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[provider.Name()] = err
+				return
+			}
+			quote.Provider = provider.Name()
+			quotes = append(quotes, quote)
+		}(provider)
+	}
+	wg.Wait()
+
+	rankBridgeQuotes(quotes)
+	return quotes, errs
+}
+
+// rankBridgeQuotes orders quotes by received amount, then by fee when both
+// are charged in the same token, then by ETA.
+func rankBridgeQuotes(quotes []*BridgeQuote) {
+	amount := func(value string) *big.Int {
+		parsed, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return new(big.Int)
+		}
+		return parsed
+	}
+
+	sort.SliceStable(quotes, func(i, j int) bool {
+		if c := amount(quotes[i].AmountOut).Cmp(amount(quotes[j].AmountOut)); c != 0 {
+			return c > 0
+		}
+		if strings.EqualFold(quotes[i].FeeToken, quotes[j].FeeToken) {
+			if c := amount(quotes[i].Fee).Cmp(amount(quotes[j].Fee)); c != 0 {
+				return c < 0
+			}
+		}
+		return quotes[i].ETA < quotes[j].ETA
+	})
+}
+
+// bridgeProvider returns the configured provider called name, falling back
+// to the first one for transfers recorded before providers were stored.
+func (a *application) bridgeProvider(name string) (BridgeProvider, error) {
+	for _, provider := range a.bridges {
+		if strings.EqualFold(provider.Name(), name) {
+			return provider, nil
+		}
+	}
+	if name == "" && len(a.bridges) > 0 {
+		return a.bridges[0], nil
+	}
+	return nil, fmt.Errorf("bridge provider %q is not configured", name)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+)
+
+// fakeBridge serves the quote/transfer REST API over httptest and records
+// what the bot sends it.
+type fakeBridge struct {
+	t       *testing.T
+	deposit bridgeAPIDeposit
+	status  string
+
+	mu       sync.Mutex
+	quoted   bridgeAPIRequest
+	started  bridgeAPIRequest
+	reported string
+}
+
+func (f *fakeBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+		f.t.Errorf("%s %s: Authorization = %q", r.Method, r.URL.Path, got)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp interface{}
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/quote":
+		json.NewDecoder(r.Body).Decode(&f.quoted)
+		resp = bridgeAPIQuoteResponse{QuoteID: "q-1", AmountOut: "990", Fee: "10", FeeToken: "FAKE", EtaSeconds: 900}
+	case "POST /v1/transfer":
+		json.NewDecoder(r.Body).Decode(&f.started)
+		resp = bridgeAPIResponse{TransactionID: "t-1", Status: "awaiting_deposit", Deposit: &f.deposit}
+	case "POST /v1/transfer/t-1/deposit":
+		var report bridgeAPIDepositReport
+		json.NewDecoder(r.Body).Decode(&report)
+		f.reported = report.TxHash
+		resp = bridgeAPIResponse{TransactionID: "t-1", Status: "pending"}
+	case "GET /v1/transfer/t-1":
+		resp = bridgeAPIResponse{TransactionID: "t-1", Status: f.status}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestHTTPBridgeProvider(t *testing.T) {
+	var (
+		token  = common.HexToAddress("0x00000000000000000000000000000000000000c1")
+		bridge = common.HexToAddress("0x00000000000000000000000000000000000000c2")
+	)
+	depositSelector := selector("transferTokens(address,uint256,uint16,bytes32)")
+	depositData := append(depositSelector[:], bytes.Repeat([]byte{0x01}, 128)...)
+	relayerFee := big.NewInt(1e15)
+
+	tokenCode := map[[4]byte][]byte{}
+	stubReturn(t, tokenCode, erc20ABI, "allowance", big.NewInt(0))
+	stubReturn(t, tokenCode, erc20ABI, "approve", true)
+	bridgeCode := map[[4]byte][]byte{depositSelector: nil}
+
+	key, _ := crypto.GenerateKey()
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	chain, client := newTestChain(t, types.GenesisAlloc{
+		owner:  {Balance: big.NewInt(1e18)},
+		token:  {Code: stubContract(tokenCode)},
+		bridge: {Code: stubContract(bridgeCode)},
+	})
+
+	fake := &fakeBridge{t: t, deposit: bridgeAPIDeposit{
+		To:      bridge.Hex(),
+		Data:    hexutil.Encode(depositData),
+		Value:   relayerFee.String(),
+		Spender: bridge.Hex(),
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("FAKE_API_URL", server.URL)
+	t.Setenv("FAKE_API_KEY", "secret")
+
+	provider, err := newHTTPBridgeProvider("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := BridgeQuoteRequest{
+		FromChain:   "Simulated",
+		ToChain:     "Base",
+		FromToken:   token.Hex(),
+		ToToken:     token.Hex(),
+		Amount:      "1000",
+		FromAddress: owner.Hex(),
+		ToAddress:   owner.Hex(),
+	}
+	quote, err := provider.Quote(ctx, req)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if fake.quoted.BridgeQuoteRequest != req {
+		t.Errorf("quoted %+v, want %+v", fake.quoted.BridgeQuoteRequest, req)
+	}
+	if quote.Provider != "Fake" || quote.QuoteID != "q-1" || quote.AmountOut != "990" || quote.Fee != "10" || quote.ETA != 15*time.Minute {
+		t.Errorf("unexpected quote %+v", quote)
+	}
+
+	cfg := chainConfig{Name: "Simulated", ChainID: testChainID, NativeSymbol: "ETH"}
+	db, _ := openRecordingDB(t)
+	app := &application{db: db, ethClients: map[string]*ethclient.Client{cfg.Name: client}}
+	depositor := &walletDepositor{app: app, client: client, cfg: cfg, key: key}
+
+	transferID, err := provider.Initiate(ctx, quote, depositor)
+	if err != nil {
+		t.Fatalf("Initiate: %v", err)
+	}
+	if transferID != "t-1" {
+		t.Errorf("transfer ID = %q, want t-1", transferID)
+	}
+	if fake.started.QuoteID != "q-1" || fake.started.BridgeQuoteRequest != req {
+		t.Errorf("transfer started with %+v", fake.started)
+	}
+
+	sent := chain.sent()
+	if len(sent) != 2 {
+		t.Fatalf("chain mined %d transactions, want the approval and the deposit", len(sent))
+	}
+	approval, deposit := sent[0], sent[1]
+	if to := approval.To(); to == nil || *to != token || !bytes.HasPrefix(approval.Data(), erc20ABI.Methods["approve"].ID) {
+		t.Errorf("first transaction is not an approval of the token: to %v", approval.To())
+	}
+	if to := deposit.To(); to == nil || *to != bridge || !bytes.Equal(deposit.Data(), depositData) || deposit.Value().Cmp(relayerFee) != 0 {
+		t.Errorf("deposit sent %v to %v, want %v to the bridge", deposit.Value(), deposit.To(), relayerFee)
+	}
+	for _, tx := range sent {
+		if chain.failed(tx.Hash()) {
+			t.Errorf("transaction %s reverted", tx.Hash().Hex())
+		}
+	}
+	if fake.reported != deposit.Hash().Hex() {
+		t.Errorf("reported deposit %q, want %s", fake.reported, deposit.Hash().Hex())
+	}
+
+	for status, want := range map[string]string{
+		"completed": database.TransferStatusConfirmed,
+		"redeemed":  database.TransferStatusConfirmed,
+		"refunded":  database.TransferStatusFailed,
+		"failed":    database.TransferStatusFailed,
+		"inflight":  database.TransferStatusPending,
+	} {
+		fake.mu.Lock()
+		fake.status = status
+		fake.mu.Unlock()
+		got, err := provider.Status(ctx, transferID)
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if got != want {
+			t.Errorf("status %q maps to %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestHTTPBridgeProviderRequiresDeposit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(bridgeAPIResponse{TransactionID: "t-1"})
+	}))
+	defer server.Close()
+
+	provider := &httpBridgeProvider{name: "Fake", baseURL: server.URL, httpClient: server.Client()}
+	quote := &BridgeQuote{QuoteID: "q-1", Request: BridgeQuoteRequest{Amount: "1000"}}
+	if _, err := provider.Initiate(context.Background(), quote, nil); err == nil {
+		t.Fatal("Initiate succeeded without a deposit transaction")
+	}
+}
+
+func TestHTTPBridgeProviderMapsDestinationToken(t *testing.T) {
+	mapped := common.HexToAddress("0x00000000000000000000000000000000000000d1")
+	var toToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(bridgeAPIQuoteResponse{QuoteID: "q-1", ToToken: toToken, AmountOut: "990"})
+	}))
+	defer server.Close()
+
+	provider := &httpBridgeProvider{name: "Fake", baseURL: server.URL, httpClient: server.Client()}
+	req := BridgeQuoteRequest{FromChain: "Ethereum", ToChain: "Base", FromToken: common.HexToAddress("0xc1").Hex(), Amount: "1000"}
+
+	if _, err := provider.Quote(context.Background(), req); err == nil {
+		t.Error("quoted a transfer with no destination token")
+	}
+	toToken = mapped.Hex()
+	quote, err := provider.Quote(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if quote.Request.ToToken != mapped.Hex() {
+		t.Errorf("destination token = %q, want the provider's %s", quote.Request.ToToken, mapped.Hex())
+	}
+}
+
+func TestBridgeDestinationToken(t *testing.T) {
+	ethereum, base, bsc := chainConfigFor(database.Ethereum), chainConfigFor(database.Base), chainConfigFor(database.BSC)
+	if got := bridgeDestinationToken(ethereum, base, common.HexToAddress(ethereum.WrappedNative)); got != common.HexToAddress(base.WrappedNative).Hex() {
+		t.Errorf("WETH maps to %q on Base, want %s", got, base.WrappedNative)
+	}
+	if got := bridgeDestinationToken(ethereum, bsc, common.HexToAddress(ethereum.WrappedNative)); got != "" {
+		t.Errorf("WETH maps to %q on BSC, want it left to the provider", got)
+	}
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	if got := bridgeDestinationToken(ethereum, base, usdc); got != "" {
+		t.Errorf("USDC maps to %q on Base, want it left to the provider", got)
+	}
+}
+
+func TestBridgeProvidersRequireAPIURL(t *testing.T) {
+	t.Setenv("BRIDGE_PROVIDERS", "")
+	t.Setenv("WORMHOLE_API_URL", "")
+	if _, err := bridgeProvidersFromEnv(); err == nil {
+		t.Fatal("configured Wormhole without WORMHOLE_API_URL")
+	}
+	t.Setenv("WORMHOLE_API_URL", "http://localhost:1")
+	providers, err := bridgeProvidersFromEnv()
+	if err != nil || len(providers) != 1 || providers[0].Name() != "Wormhole" {
+		t.Fatalf("providers = %v, %v, want Wormhole", providers, err)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// bridgeDraft holds the choices made so far in the bridge flow.
+type bridgeDraft struct {
+	FromChain chainConfig
+	ToChain   chainConfig
+	From      *models.Wallet
+	Token     *tokenInfo
+	Balance   *big.Int
+	Amount    *big.Int
+	Quotes    []*BridgeQuote
+	Quote     *BridgeQuote
+}
+
+func (a *application) bridgeDraft(chatID string) *bridgeDraft {
+	a.draftsMu.Lock()
+	defer a.draftsMu.Unlock()
+	return a.bridgeDrafts[chatID]
+}
+
+func (a *application) setBridgeDraft(chatID string, draft *bridgeDraft) {
+	a.draftsMu.Lock()
+	defer a.draftsMu.Unlock()
+	if a.bridgeDrafts == nil {
+		a.bridgeDrafts = make(map[string]*bridgeDraft)
+	}
+	if draft == nil {
+		delete(a.bridgeDrafts, chatID)
+		return
+	}
+	a.bridgeDrafts[chatID] = draft
+}
+
+// bridgeDestinationHandler starts a bridge transfer from the active chain to
+// destination and asks for the source wallet.
+func (a *application) bridgeDestinationHandler(destination database.ChainStatusOne, m *tbot.Message) {
+	fromChain, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	toChain := chainConfigFor(destination)
+	if !fromChain.isEVM() {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Bridging from %s is not supported yet.", fromChain.Name))
+		return
+	}
+	if fromChain.Name == toChain.Name {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("You are already on %s. Pick a different destination chain.", toChain.Name))
+		return
+	}
+
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+
+	a.setBridgeDraft(m.Chat.ID, &bridgeDraft{FromChain: fromChain, ToChain: toChain})
+
+	bridgeMsg := fmt.Sprintf(`
+Bridge (🔗%s → %s)
+
+Select the wallet you want to bridge from.
+`, fromChain.Name, toChain.Name)
+
+	buttons := make([][]tbot.InlineKeyboardButton, 0, len(wallets)+1)
+	for i, wallet := range wallets {
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("%s (%d)", wallet.Address, i+1),
+			CallbackData: fmt.Sprintf("bridge_from_%d", i),
+		}})
+	}
+	buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: "Cancel", CallbackData: "cancel_bridge"}})
+
+	a.client.SendMessage(m.Chat.ID, bridgeMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) bridgeTokenHandler(walletIndex int, m *tbot.Message) {
+	draft := a.bridgeDraft(m.Chat.ID)
+	if draft == nil {
+		a.client.SendMessage(m.Chat.ID, "Bridge expired. Please start again.")
+		return
+	}
+
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if walletIndex >= len(wallets) || walletIndex < 0 {
+		a.client.SendMessage(m.Chat.ID, "Invalid wallet selection.")
+		return
+	}
+	client, err := a.ethClient(draft.FromChain)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	draft.From = wallets[walletIndex]
+	tokens, err := database.GetWalletTokens(a.db, draft.FromChain.Name, draft.From.Address)
+	if err != nil {
+		log.Printf("Error retrieving wallet tokens: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var buttons [][]tbot.InlineKeyboardButton
+	for _, holding := range walletTokenHoldings(ctx, client, tokens, common.HexToAddress(draft.From.Address)) {
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("%s (%s)", holding.Token.Symbol, formatUnits(holding.Balance, holding.Token.Decimals)),
+			CallbackData: "bridge_token_" + holding.Token.Address.Hex(),
+		}})
+	}
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "📋Paste contract", CallbackData: "bridge_paste"}},
+		[]tbot.InlineKeyboardButton{{Text: "Cancel", CallbackData: "cancel_bridge"}},
+	)
+
+	bridgeMsg := fmt.Sprintf(`Bridge (🔗%s → %s)
+From: %s
+
+Select the token to bridge or paste its contract address.`, draft.FromChain.Name, draft.ToChain.Name, draft.From.Address)
+
+	a.client.SendMessage(m.Chat.ID, bridgeMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) bridgeSelectToken(tokenAddress string, m *tbot.Message) {
+	draft := a.bridgeDraft(m.Chat.ID)
+	if draft == nil || draft.From == nil {
+		a.client.SendMessage(m.Chat.ID, "Bridge expired. Please start again.")
+		return
+	}
+	if !common.IsHexAddress(tokenAddress) {
+		a.client.SendMessage(m.Chat.ID, "Invalid contract address.")
+		return
+	}
+	client, err := a.ethClient(draft.FromChain)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	token := common.HexToAddress(tokenAddress)
+	info, err := readTokenInfo(ctx, client, token)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return
+	}
+	balance, err := tokenBalance(ctx, client, token, common.HexToAddress(draft.From.Address))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token balance: "+err.Error())
+		return
+	}
+	if balance.Sign() == 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Wallet %s holds no %s.", draft.From.Address, info.Symbol))
+		return
+	}
+
+	draft.Token = info
+	draft.Balance = balance
+	database.AddWalletToken(a.db, draft.FromChain.Name, draft.From.Address, token.Hex())
+
+	a.waitingForBridgeAmount = true
+	bridgeMsg := fmt.Sprintf(`Bridge (🔗%s → %s)
+From: %s
+Token: %s (%s)
+Available balance: %s %s
+
+Enter the amount you would like to bridge, or "max":`, draft.FromChain.Name, draft.ToChain.Name, draft.From.Address, info.Name, info.Symbol, formatUnits(balance, info.Decimals), info.Symbol)
+
+	a.client.SendMessage(m.Chat.ID, bridgeMsg)
+}
+
+// bridgeDestinationToken returns the address of token on to when the bot
+// knows it: wrapped native coins map onto each other between chains sharing
+// a native coin. Any other token is left empty for the provider to map,
+// since its address usually differs from chain to chain.
+func bridgeDestinationToken(from, to chainConfig, token common.Address) string {
+	if from.WrappedNative != "" && to.WrappedNative != "" && from.NativeSymbol == to.NativeSymbol &&
+		token == common.HexToAddress(from.WrappedNative) {
+		return common.HexToAddress(to.WrappedNative).Hex()
+	}
+	return ""
+}
+
+// bridgeAmountHandler requests quotes for the entered amount from every
+// provider and lists them best first.
+func (a *application) bridgeAmountHandler(m *tbot.Message) {
+	draft := a.bridgeDraft(m.Chat.ID)
+	if draft == nil || draft.Token == nil {
+		a.client.SendMessage(m.Chat.ID, "Bridge expired. Please start again.")
+		return
+	}
+
+	var amount *big.Int
+	if strings.EqualFold(strings.TrimSpace(m.Text), "max") {
+		amount = new(big.Int).Set(draft.Balance)
+	} else {
+		parsed, err := parseUnits(m.Text, draft.Token.Decimals)
+		if err != nil {
+			a.waitingForBridgeAmount = true
+			a.client.SendMessage(m.Chat.ID, "Invalid amount: "+err.Error()+"\nPlease enter the amount again:")
+			return
+		}
+		amount = parsed
+	}
+	if amount.Sign() <= 0 || amount.Cmp(draft.Balance) > 0 {
+		a.waitingForBridgeAmount = true
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Amount must be between 0 and %s %s. Please enter the amount again:", formatUnits(draft.Balance, draft.Token.Decimals), draft.Token.Symbol))
+		return
+	}
+	draft.Amount = amount
+
+	if len(a.bridges) == 0 {
+		a.client.SendMessage(m.Chat.ID, "No bridge providers are configured.")
+		return
+	}
+
+	quotes, errs := quoteAllBridges(context.Background(), a.bridges, BridgeQuoteRequest{
+		FromChain:   draft.FromChain.Name,
+		ToChain:     draft.ToChain.Name,
+		FromToken:   draft.Token.Address.Hex(),
+		ToToken:     bridgeDestinationToken(draft.FromChain, draft.ToChain, draft.Token.Address),
+		Amount:      amount.String(),
+		FromAddress: draft.From.Address,
+		ToAddress:   draft.From.Address,
+	})
+	for name, err := range errs {
+		log.Printf("Error getting %s bridge quote: %v", name, err)
+	}
+	if len(quotes) == 0 {
+		a.client.SendMessage(m.Chat.ID, "Failed to get a bridge quote from any provider. Please try again later.")
+		return
+	}
+	draft.Quotes = quotes
+
+	var routes strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, quote := range quotes {
+		label := quote.Provider
+		if i == 0 {
+			label += " ⭐Best"
+		}
+		routes.WriteString(fmt.Sprintf("%d. %s\n%s\n\n", i+1, label, formatBridgeQuote(draft, quote)))
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: fmt.Sprintf("%d. %s", i+1, label), CallbackData: fmt.Sprintf("bridge_pick_%d", i)}})
+	}
+	if len(errs) > 0 {
+		routes.WriteString(fmt.Sprintf("%d provider(s) did not respond in time.\n", len(errs)))
+	}
+	buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: "Cancel", CallbackData: "cancel_bridge"}})
+
+	bridgeMsg := fmt.Sprintf(`Bridge (🔗%s → %s)
+From: %s
+
+Available routes, best first:
+
+%s
+Choose a route:`, draft.FromChain.Name, draft.ToChain.Name, draft.From.Address, routes.String())
+
+	a.client.SendMessage(m.Chat.ID, bridgeMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+// bridgePickHandler selects one of the ranked quotes and asks the user to
+// confirm it.
+func (a *application) bridgePickHandler(quoteIndex int, m *tbot.Message) {
+	draft := a.bridgeDraft(m.Chat.ID)
+	if draft == nil || quoteIndex < 0 || quoteIndex >= len(draft.Quotes) {
+		a.client.SendMessage(m.Chat.ID, "Bridge expired. Please start again.")
+		return
+	}
+	quote := draft.Quotes[quoteIndex]
+	draft.Quote = quote
+
+	bridgeMsg := fmt.Sprintf(`Bridge (🔗%s → %s)
+Provider: %s
+From: %s
+
+%s`, draft.FromChain.Name, draft.ToChain.Name, quote.Provider, draft.From.Address, formatBridgeQuote(draft, quote))
+
+	buttons := &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tbot.InlineKeyboardButton{
+			{{Text: "✅Confirm", CallbackData: "bridge_confirm"}},
+			{{Text: "Cancel", CallbackData: "cancel_bridge"}},
+		},
+	}
+	a.client.SendMessage(m.Chat.ID, bridgeMsg, tbot.OptInlineKeyboardMarkup(buttons))
+}
+
+func formatBridgeQuote(draft *bridgeDraft, quote *BridgeQuote) string {
+	amountOut, _ := new(big.Int).SetString(quote.AmountOut, 10)
+	fee, _ := new(big.Int).SetString(quote.Fee, 10)
+
+	feeDecimals := uint8(18)
+	feeToken := quote.FeeToken
+	if feeToken == "" || strings.EqualFold(feeToken, draft.Token.Symbol) {
+		feeDecimals = draft.Token.Decimals
+		feeToken = draft.Token.Symbol
+	}
+
+	return fmt.Sprintf(`You send: %s %s
+You receive: %s %s
+Fees: %s %s
+Estimated time: %s`,
+		formatUnits(draft.Amount, draft.Token.Decimals), draft.Token.Symbol,
+		formatUnits(amountOut, draft.Token.Decimals), draft.Token.Symbol,
+		formatUnits(fee, feeDecimals), feeToken,
+		quote.ETA.Round(time.Second))
+}
+
+// walletDepositor funds bridge transfers from a bot wallet on the source
+// chain.
+type walletDepositor struct {
+	app    *application
+	client *ethclient.Client
+	cfg    chainConfig
+	key    *ecdsa.PrivateKey
+}
+
+func (d *walletDepositor) Deposit(ctx context.Context, token, spender, to common.Address, amount, value *big.Int, data []byte) (*types.Transaction, error) {
+	if spender != (common.Address{}) {
+		if err := d.app.ensureAllowance(ctx, d.client, d.cfg, d.key, token, spender, amount); err != nil {
+			return nil, err
+		}
+	}
+	return d.app.sendTransaction(ctx, d.client, d.cfg, d.key, to, value, data, nil)
+}
+
+// bridgeConfirmHandler initiates the quoted transfer, sends its deposit from
+// the source wallet and records it so the tracker can follow it to
+// completion.
+func (a *application) bridgeConfirmHandler(m *tbot.Message) {
+	draft := a.bridgeDraft(m.Chat.ID)
+	if draft == nil || draft.Quote == nil {
+		a.client.SendMessage(m.Chat.ID, "Bridge expired. Please start again.")
+		return
+	}
+	a.setBridgeDraft(m.Chat.ID, nil)
+
+	key, err := loadPrivateKey(draft.From)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to initiate token transfer: "+err.Error())
+		return
+	}
+	client, err := a.ethClient(draft.FromChain)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	provider, err := a.bridgeProvider(draft.Quote.Provider)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	// The deposit may need an approval mined first.
+	ctx, cancel := context.WithTimeout(context.Background(), approvalTimeout+time.Minute)
+	defer cancel()
+
+	depositor := &walletDepositor{app: a, client: client, cfg: draft.FromChain, key: key}
+	transferID, err := provider.Initiate(ctx, draft.Quote, depositor)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to initiate token transfer: "+err.Error())
+		return
+	}
+
+	err = database.CreateTransferRecord(a.db, &database.TransferRecord{
+		FromChain:     draft.FromChain.Name,
+		ToChain:       draft.ToChain.Name,
+		FromToken:     draft.Token.Symbol,
+		ToToken:       draft.Quote.Request.ToToken,
+		Amount:        formatUnits(draft.Amount, draft.Token.Decimals),
+		FromAddress:   draft.From.Address,
+		ToAddress:     draft.From.Address,
+		TransactionID: transferID,
+		Status:        database.TransferStatusPending,
+		TokenAddress:  draft.Token.Address.Hex(),
+		ChatID:        m.Chat.ID,
+		Provider:      draft.Quote.Provider,
+	})
+	if err != nil {
+		log.Printf("Error saving transfer record: %v", err)
+	}
+
+	a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Token transfer initiated via %s. Transfer ID: %s\nYou will be notified when it completes.", draft.Quote.Provider, transferID))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+)
+
+type chainConfig struct {
+	Name         string
+	ChainID      int64
+	NativeSymbol string
+	RPCURL       string
+	// WSURL is a websocket endpoint used to watch pending transactions.
+	WSURL string
+	// MempoolFile replays recorded pending transactions instead of WSURL,
+	// and MempoolRecord is a file every pending transaction seen is
+	// appended to.
+	MempoolFile   string
+	MempoolRecord string
+	Explorer      string
+	// V2Router and V2Factory are the Uniswap V2-compatible DEX used for
+	// pricing and swaps; WrappedNative is the token paired against.
+	V2Router      string
+	V2Factory     string
+	WrappedNative string
+	// V3Factory, V3Quoter and V3Router are the Uniswap V3 factory, QuoterV2
+	// and SwapRouter02 deployments.
+	V3Factory string
+	V3Quoter  string
+	V3Router  string
+	// NativeUSDFeed is a Chainlink aggregator pricing the native coin in USD.
+	NativeUSDFeed string
+}
+
+var chainDefaults = map[database.ChainStatusOne]chainConfig{
+	database.Ethereum: {
+		Name: "Ethereum", ChainID: 1, NativeSymbol: "ETH", RPCURL: "https://ethereum-rpc.publicnode.com", Explorer: "https://etherscan.io",
+		V2Router:      "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D",
+		V2Factory:     "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f",
+		WrappedNative: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+		V3Factory:     "0x1F98431c8aD98523631AE4a59f267346ea31F984",
+		V3Quoter:      "0x61fFE014bA17989E743c5F6cB21bF9697530B21e",
+		V3Router:      "0x68b3465833fb72A70ecDF485E0e4C7bD8665Fc45",
+		NativeUSDFeed: "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419",
+	},
+	database.BSC: {
+		Name: "BSC", ChainID: 56, NativeSymbol: "BNB", RPCURL: "https://bsc-dataseed.binance.org", Explorer: "https://bscscan.com",
+		V2Router:      "0x10ED43C718714eb63d5aA57B78B54704E256024E",
+		V2Factory:     "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73",
+		WrappedNative: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+		V3Factory:     "0xdB1d10011AD0Ff90774D0C6Bb92e5C5c8b4461F7",
+		V3Quoter:      "0x78D78E420Da98ad378D7799bE8f4AF69033EB077",
+		V3Router:      "0xB971eF87ede563556b2ED4b1C0b0019111Dd85d2",
+		NativeUSDFeed: "0x0567F2323251f0Aab15c8dFb1967E4e8A7D42aeE",
+	},
+	database.Blast: {
+		Name: "Blast", ChainID: 81457, NativeSymbol: "ETH", RPCURL: "https://rpc.blast.io", Explorer: "https://blastscan.io",
+		WrappedNative: "0x4300000000000000000000000000000000000004",
+	},
+	database.Base: {
+		Name: "Base", ChainID: 8453, NativeSymbol: "ETH", RPCURL: "https://mainnet.base.org", Explorer: "https://basescan.org",
+		V2Router:      "0x4752ba5DBc23f44D87826276BF6Fd6b1C372aD24",
+		V2Factory:     "0x8909Dc15e40173Ff4699343b6eB8132c65e18eC6",
+		WrappedNative: "0x4200000000000000000000000000000000000006",
+		V3Factory:     "0x33128a8fC17869897dcE68Ed026d694621f6FDfD",
+		V3Quoter:      "0x3d4e44Eb1374240CE5F1B871ab261CD16335B76a",
+		V3Router:      "0x2626664c2603336E57B271c5C0b26F421741e481",
+		NativeUSDFeed: "0x71041dddad3595F9CEd3DcCFBe3D1F4b0a16Bb70",
+	},
+	database.Avax: {
+		Name: "Avax", ChainID: 43114, NativeSymbol: "AVAX", RPCURL: "https://api.avax.network/ext/bc/C/rpc", Explorer: "https://snowtrace.io",
+		V2Router:      "0x4752ba5DBc23f44D87826276BF6Fd6b1C372aD24",
+		V2Factory:     "0x9e5A52f57b3038F1B8EeE45F28b3C1967e22799C",
+		WrappedNative: "0xB31f66AA3C1e785363F0875A1B74E27b85FD66c7",
+		V3Factory:     "0x740b1c1de25031C31FF4fC9A62f554A55cdC1baD",
+		V3Quoter:      "0xbe0F5544EC67e9B3b2D979aaA43f18Fd87E6257F",
+		V3Router:      "0xbb00FF08d01D300023C629E8fFfFcb65A5a578cE",
+		NativeUSDFeed: "0x0A77230d17318075983913bC2145DB16C7366156",
+	},
+	database.Solana: {Name: "Solana", NativeSymbol: "SOL", RPCURL: "https://api.mainnet-beta.solana.com", Explorer: "https://solscan.io"},
+}
+
+// chainConfigFor returns the configuration of a chain. The RPC endpoint can
+// be overridden with <CHAIN>_RPC_URL, e.g. ETHEREUM_RPC_URL, the mempool
+// websocket set with <CHAIN>_WS_URL or replaced by a recording with
+// <CHAIN>_MEMPOOL_FILE, and the DEX
+// contracts with <CHAIN>_V2_ROUTER, <CHAIN>_V2_FACTORY, <CHAIN>_V3_FACTORY,
+// <CHAIN>_V3_QUOTER and <CHAIN>_V3_ROUTER. <CHAIN>_MEMPOOL_RECORD records the
+// pending transactions seen to a file.
+func chainConfigFor(chain database.ChainStatusOne) chainConfig {
+	cfg, ok := chainDefaults[chain]
+	if !ok {
+		cfg = chainDefaults[database.Ethereum]
+	}
+	if url := os.Getenv(cfg.envPrefix() + "_RPC_URL"); url != "" {
+		cfg.RPCURL = url
+	}
+	if url := os.Getenv(cfg.envPrefix() + "_WS_URL"); url != "" {
+		cfg.WSURL = url
+	}
+	cfg.MempoolFile = os.Getenv(cfg.envPrefix() + "_MEMPOOL_FILE")
+	cfg.MempoolRecord = os.Getenv(cfg.envPrefix() + "_MEMPOOL_RECORD")
+	if router := os.Getenv(cfg.envPrefix() + "_V2_ROUTER"); router != "" {
+		cfg.V2Router = router
+	}
+	if factory := os.Getenv(cfg.envPrefix() + "_V2_FACTORY"); factory != "" {
+		cfg.V2Factory = factory
+	}
+	if factory := os.Getenv(cfg.envPrefix() + "_V3_FACTORY"); factory != "" {
+		cfg.V3Factory = factory
+	}
+	if quoter := os.Getenv(cfg.envPrefix() + "_V3_QUOTER"); quoter != "" {
+		cfg.V3Quoter = quoter
+	}
+	if router := os.Getenv(cfg.envPrefix() + "_V3_ROUTER"); router != "" {
+		cfg.V3Router = router
+	}
+	return cfg
+}
+
+func (c chainConfig) envPrefix() string {
+	return strings.ToUpper(c.Name)
+}
+
+func (c chainConfig) isEVM() bool {
+	return c.ChainID != 0
+}
+
+// hasDEX reports whether a V2 router and factory are configured for the chain.
+func (c chainConfig) hasDEX() bool {
+	return c.V2Router != "" && c.V2Factory != "" && c.WrappedNative != ""
+}
+
+// hasV3 reports whether Uniswap V3 contracts are configured for the chain.
+func (c chainConfig) hasV3() bool {
+	return c.V3Factory != "" && c.V3Quoter != "" && c.V3Router != "" && c.WrappedNative != ""
+}
+
+func (c chainConfig) chainID() *big.Int {
+	return big.NewInt(c.ChainID)
+}
+
+func (c chainConfig) txURL(hash string) string {
+	return fmt.Sprintf("%s/tx/%s", c.Explorer, hash)
+}
+
+func (c chainConfig) addressURL(address string) string {
+	if c.isEVM() {
+		return fmt.Sprintf("%s/address/%s", c.Explorer, address)
+	}
+	return fmt.Sprintf("%s/account/%s", c.Explorer, address)
+}
+
+// currentChain returns the configuration of the chain selected in settings.
+func (a *application) currentChain() (chainConfig, error) {
+	status, err := database.GetChainStatus(a.db)
+	if err != nil {
+		return chainConfig{}, err
+	}
+	return chainConfigFor(status), nil
+}
+
+// ethClient returns a cached RPC client for an EVM chain.
+func (a *application) ethClient(cfg chainConfig) (*ethclient.Client, error) {
+	if !cfg.isEVM() {
+		return nil, fmt.Errorf("%s is not an EVM chain", cfg.Name)
+	}
+
+	a.ethClientsMu.Lock()
+	defer a.ethClientsMu.Unlock()
+
+	if client, ok := a.ethClients[cfg.Name]; ok {
+		return client, nil
+	}
+	client, err := ethclient.Dial(cfg.RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s RPC: %w", cfg.Name, err)
+	}
+	if a.ethClients == nil {
+		a.ethClients = make(map[string]*ethclient.Client)
+	}
+	a.ethClients[cfg.Name] = client
+	return client, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// copyStats rates a followed wallet on its indexed swaps, next to what
+// copying it has made the chat.
+type copyStats struct {
+	Target *models.CopyTarget
+	Swaps  int
+	// Closed counts the tokens the wallet bought and then sold, and Wins
+	// those it sold for more than they cost.
+	Closed int
+	Wins   int
+	// Multiple and Holding are averaged over the closed tokens; Holding
+	// runs from the first buy to the last sell.
+	Multiple float64
+	Holding  time.Duration
+	Realized *big.Float
+	// Copied are the chat's positions from copying the wallet.
+	Copied []*position
+}
+
+// rateCopyTarget measures a wallet on its indexed swaps, treating each
+// token it traded as one position.
+func rateCopyTarget(cfg chainConfig, swaps []*models.CopyTargetSwap) *copyStats {
+	stats := &copyStats{Swaps: len(swaps), Realized: new(big.Float)}
+
+	type tokenRun struct {
+		Position *position
+		First    time.Time
+		Last     time.Time
+	}
+	runs := make(map[string]*tokenRun)
+	var tokens []string
+	for _, swap := range swaps {
+		run, ok := runs[swap.TokenAddress]
+		if !ok {
+			run = &tokenRun{Position: newPosition(cfg, swap.WalletAddress, nil)}
+			runs[swap.TokenAddress] = run
+			tokens = append(tokens, swap.TokenAddress)
+		}
+		run.Position.add(&models.Trade{Side: swap.Side, NativeAmount: swap.NativeAmount, TokenAmount: swap.TokenAmount})
+		if swap.Side == database.TradeSideBuy && run.First.IsZero() {
+			run.First = swap.BlockTime
+		}
+		if swap.Side == database.TradeSideSell {
+			run.Last = swap.BlockTime
+		}
+	}
+
+	var multiples float64
+	var holding time.Duration
+	for _, token := range tokens {
+		run := runs[token]
+		p := run.Position
+		// Sells of tokens bought before indexing began cannot be rated.
+		if p.Sold.Sign() == 0 || p.Bought.Sign() == 0 {
+			continue
+		}
+		basis := p.basisOf(p.Sold)
+		if basis.Sign() == 0 {
+			continue
+		}
+		realized := p.realized()
+		stats.Closed++
+		if realized.Sign() > 0 {
+			stats.Wins++
+		}
+		stats.Realized.Add(stats.Realized, realized)
+		multiple, _ := new(big.Float).Quo(toDecimal(p.Proceeds, 18), basis).Float64()
+		multiples += multiple
+		if run.Last.After(run.First) {
+			holding += run.Last.Sub(run.First)
+		}
+	}
+	if stats.Closed > 0 {
+		stats.Multiple = multiples / float64(stats.Closed)
+		stats.Holding = holding / time.Duration(stats.Closed)
+	}
+	return stats
+}
+
+// copiedPnL sums the realized and unrealized profit of the chat's copies.
+func (s *copyStats) copiedPnL() (*big.Float, *big.Float) {
+	realized, unrealized := new(big.Float), new(big.Float)
+	for _, p := range s.Copied {
+		realized.Add(realized, p.realized())
+		unrealized.Add(unrealized, p.unrealized())
+	}
+	return realized, unrealized
+}
+
+// loadCopiedPositions values the chat's copies of target. Only the tokens
+// the copies bought and have not sold count, so holdings from other trades
+// of the same token are left out.
+func (a *application) loadCopiedPositions(ctx context.Context, client *ethclient.Client, cfg chainConfig, target *models.CopyTarget) ([]*position, error) {
+	trades, err := database.GetCopyTargetTrades(a.db, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	positions := aggregatePositions(ctx, client, cfg, trades)
+	valuePositions(ctx, client, cfg, positions)
+	for _, p := range positions {
+		held := new(big.Int).Sub(p.Bought, p.Sold)
+		if held.Sign() < 0 {
+			held.SetInt64(0)
+		}
+		if p.Balance.Cmp(held) > 0 {
+			p.Value = new(big.Int).Div(new(big.Int).Mul(p.Value, held), p.Balance)
+			p.Balance = held
+		}
+	}
+	return positions, nil
+}
+
+// formatHolding renders a holding time in minutes, hours or days.
+func formatHolding(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%.1fh", d.Hours())
+	}
+	return fmt.Sprintf("%.1fd", d.Hours()/24)
+}
+
+// copyLeaderboardHandler ranks the wallets a chat follows on a chain by the
+// profit they realized.
+func (a *application) copyLeaderboardHandler(chainName string, m *tbot.Message) {
+	cfg := chainConfigFor(convertChainStatusNameToType(chainName))
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	targets, err := database.GetChatCopyTargets(a.db, m.Chat.ID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting copy targets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to load followed wallets.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var leaderboard []*copyStats
+	for _, target := range targets {
+		swaps, err := database.GetCopyTargetSwaps(a.db, cfg.Name, target.WalletAddress)
+		if err != nil {
+			log.Printf("Error getting swaps of %s: %v", target.WalletAddress, err)
+			continue
+		}
+		stats := rateCopyTarget(cfg, swaps)
+		stats.Target = target
+		if stats.Copied, err = a.loadCopiedPositions(ctx, client, cfg, target); err != nil {
+			log.Printf("Error getting copies of %s: %v", target.WalletAddress, err)
+		}
+		leaderboard = append(leaderboard, stats)
+	}
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		return leaderboard[i].Realized.Cmp(leaderboard[j].Realized) > 0
+	})
+
+	nativeUSD, _ := nativeUSDPrice(ctx, client, cfg)
+
+	var lines strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, stats := range leaderboard {
+		lines.WriteString(fmt.Sprintf("%d. %s\n", i+1, stats.Target.WalletAddress))
+		if stats.Closed == 0 {
+			lines.WriteString(fmt.Sprintf("   No closed trades yet (%d swaps indexed)\n", stats.Swaps))
+		} else {
+			lines.WriteString(fmt.Sprintf("   Win rate: %.0f%% (%d/%d) | Avg: %.2fx | Hold: %s\n",
+				100*float64(stats.Wins)/float64(stats.Closed), stats.Wins, stats.Closed, stats.Multiple, formatHolding(stats.Holding)))
+			lines.WriteString(fmt.Sprintf("   Realized: %s | Swaps: %d\n", formatPnL(stats.Realized, nativeUSD, cfg.NativeSymbol), stats.Swaps))
+		}
+		realized, unrealized := stats.copiedPnL()
+		lines.WriteString(fmt.Sprintf("   Your copies: %s realized, %s unrealized\n",
+			formatPnL(realized, nativeUSD, cfg.NativeSymbol), formatPnL(unrealized, nativeUSD, cfg.NativeSymbol)))
+
+		buttons = append(buttons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("#%d %s", i+1, shortAddress(stats.Target.WalletAddress)), CallbackData: "copy_target_" + stats.Target.ID.String()},
+		})
+	}
+	if len(leaderboard) == 0 {
+		lines.WriteString("No wallets followed.\n")
+	}
+
+	leaderboardMsg := fmt.Sprintf(`📊 Copy Trading Leaderboard (🔗%s)
+
+Wallets are rated on the swaps seen since they were followed,
+plus the last %d blocks before. Each token a wallet bought and
+sold counts as one trade.
+
+%s`, cfg.Name, copyBackfillBlocks, lines.String())
+
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "🔄Refresh", CallbackData: "copy_stats_" + cfg.Name}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "copy_chain_" + cfg.Name}},
+	)
+	a.client.SendMessage(m.Chat.ID, leaderboardMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
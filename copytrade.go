@@ -0,0 +1,816 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	// copyPollInterval is how often new blocks are scanned for swaps of
+	// copy targets.
+	copyPollInterval = 12 * time.Second
+	// copyMaxBlocks is the most blocks scanned at once; a watcher further
+	// behind skips ahead rather than copying stale swaps.
+	copyMaxBlocks = 50
+	// copyTimeout bounds mirroring one swap.
+	copyTimeout = 2 * time.Minute
+	// copyMaxRemembered is how many mirrored swaps are remembered to avoid
+	// copying a swap twice.
+	copyMaxRemembered = 10000
+	// copyBackfillBlocks is how far back the swaps of a newly followed
+	// wallet are indexed, copyBackfillChunk blocks at a time.
+	copyBackfillBlocks = 20000
+	copyBackfillChunk  = 1000
+)
+
+// copySwap is a swap made by a copy target.
+type copySwap struct {
+	Trader common.Address
+	Tx     *types.Transaction
+	Method string
+	Side   string
+	Token  common.Address
+	// NativeAmount is what a buy spent or a sell returned, and TokenAmount
+	// the tokens bought or sold. A sell for another token returns nothing.
+	NativeAmount *big.Int
+	TokenAmount  *big.Int
+	Block        uint64
+	Time         time.Time
+	// Pending is set for swaps copied from the mempool, before they are
+	// mined.
+	Pending bool
+}
+
+// record converts the swap for indexing.
+func (s *copySwap) record(cfg chainConfig) *models.CopyTargetSwap {
+	return &models.CopyTargetSwap{
+		Chain:         cfg.Name,
+		WalletAddress: s.Trader.Hex(),
+		TokenAddress:  s.Token.Hex(),
+		Side:          s.Side,
+		NativeAmount:  s.NativeAmount.String(),
+		TokenAmount:   s.TokenAmount.String(),
+		TxHash:        s.Tx.Hash().Hex(),
+		BlockNumber:   s.Block,
+		BlockTime:     s.Time,
+	}
+}
+
+// copyTransfers are the token transfers to and from a trader in one
+// transaction.
+type copyTransfers struct {
+	Trader common.Address
+	Block  uint64
+	In     map[common.Address]*big.Int
+	Out    map[common.Address]*big.Int
+}
+
+func addTransfer(amounts map[common.Address]*big.Int, token common.Address, amount *big.Int) {
+	if amounts[token] == nil {
+		amounts[token] = new(big.Int)
+	}
+	amounts[token].Add(amounts[token], amount)
+}
+
+// findCopySwaps decodes the swaps traders sent in blocks from to to. A swap
+// is a recognised router call sent by the trader; its Transfer events tell
+// which token went in or out and how much native coin it cost.
+func findCopySwaps(ctx context.Context, client *ethclient.Client, cfg chainConfig, traders []common.Address, from, to uint64) ([]*copySwap, error) {
+	topics := make([]common.Hash, len(traders))
+	for i, trader := range traders {
+		topics[i] = common.BytesToHash(trader.Bytes())
+	}
+	query := ethereum.FilterQuery{FromBlock: new(big.Int).SetUint64(from), ToBlock: new(big.Int).SetUint64(to)}
+
+	query.Topics = [][]common.Hash{{erc20TransferTopic}, nil, topics}
+	received, err := client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	query.Topics = [][]common.Hash{{erc20TransferTopic}, topics}
+	sent, err := client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []common.Hash
+	byTx := make(map[common.Hash]*copyTransfers)
+	transfersOf := func(entry types.Log, trader common.Address) *copyTransfers {
+		transfers, ok := byTx[entry.TxHash]
+		if !ok {
+			transfers = &copyTransfers{Trader: trader, Block: entry.BlockNumber, In: make(map[common.Address]*big.Int), Out: make(map[common.Address]*big.Int)}
+			byTx[entry.TxHash] = transfers
+			hashes = append(hashes, entry.TxHash)
+		}
+		return transfers
+	}
+	for _, entry := range received {
+		if len(entry.Topics) == 3 && !entry.Removed {
+			trader := common.BytesToAddress(entry.Topics[2].Bytes())
+			addTransfer(transfersOf(entry, trader).In, entry.Address, new(big.Int).SetBytes(entry.Data))
+		}
+	}
+	for _, entry := range sent {
+		if len(entry.Topics) == 3 && !entry.Removed {
+			trader := common.BytesToAddress(entry.Topics[1].Bytes())
+			addTransfer(transfersOf(entry, trader).Out, entry.Address, new(big.Int).SetBytes(entry.Data))
+		}
+	}
+
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	times := make(map[uint64]time.Time)
+	var swaps []*copySwap
+	for _, hash := range hashes {
+		transfers := byTx[hash]
+		tx, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil || sender != transfers.Trader {
+			continue
+		}
+		kind, method, _ := decodeCall(tx.Data())
+		if kind != mempoolSwap {
+			continue
+		}
+
+		blockTime, ok := times[transfers.Block]
+		if !ok {
+			header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(transfers.Block))
+			if err != nil {
+				return nil, err
+			}
+			blockTime = time.Unix(int64(header.Time), 0)
+			times[transfers.Block] = blockTime
+		}
+		swap := func(side string, token common.Address, native, tokens *big.Int) {
+			swaps = append(swaps, &copySwap{Trader: sender, Tx: tx, Method: method, Side: side, Token: token, NativeAmount: native, TokenAmount: tokens, Block: transfers.Block, Time: blockTime})
+		}
+
+		nativeIn := new(big.Int).Set(tx.Value())
+		if out := transfers.Out[wrapped]; out != nil {
+			nativeIn.Add(nativeIn, out)
+		}
+		for token, amount := range transfers.In {
+			if token != wrapped && nativeIn.Sign() > 0 {
+				swap(database.TradeSideBuy, token, nativeIn, amount)
+			}
+		}
+
+		var nativeOut *big.Int
+		for token, amount := range transfers.Out {
+			if token == wrapped {
+				continue
+			}
+			if nativeOut == nil {
+				// Routers unwrap what a sell returns, or pay it out as the
+				// wrapped coin.
+				receipt, err := client.TransactionReceipt(ctx, hash)
+				if err != nil {
+					return nil, err
+				}
+				nativeOut = unwrappedNative(receipt, wrapped)
+				if in := transfers.In[wrapped]; in != nil {
+					nativeOut.Add(nativeOut, in)
+				}
+			}
+			swap(database.TradeSideSell, token, nativeOut, amount)
+		}
+	}
+	return swaps, nil
+}
+
+// copyWatch is what the copy trading watcher keeps between scans.
+type copyWatch struct {
+	// cursors holds the last block scanned on each chain, and stops ends
+	// the mempool listener of each chain.
+	cursors map[string]uint64
+	stops   map[string]func()
+
+	mu      sync.Mutex
+	targets map[string][]*models.CopyTarget
+	// copied holds the swaps already mirrored, so a swap copied from the
+	// mempool is not copied again once it is mined. recent holds the same
+	// hashes oldest first, so the oldest is forgotten when it is full.
+	copied map[common.Hash]bool
+	recent []common.Hash
+	next   int
+}
+
+// targetsOf returns the targets following trader on chain.
+func (w *copyWatch) targetsOf(chain string, trader common.Address) []*models.CopyTarget {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var targets []*models.CopyTarget
+	for _, target := range w.targets[chain] {
+		if common.HexToAddress(target.WalletAddress) == trader {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// claim reports whether the swaps of hash are yet to be mirrored, and marks
+// them mirrored.
+func (w *copyWatch) claim(hash common.Hash) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.copied[hash] {
+		return false
+	}
+	delete(w.copied, w.recent[w.next])
+	w.recent[w.next] = hash
+	w.next = (w.next + 1) % len(w.recent)
+	w.copied[hash] = true
+	return true
+}
+
+// watchCopyTargets mirrors the swaps of enabled copy targets until ctx is
+// done. Swaps are copied from the mempool where the chain has one, and
+// otherwise once they are mined.
+func (a *application) watchCopyTargets(ctx context.Context) {
+	ticker := time.NewTicker(copyPollInterval)
+	defer ticker.Stop()
+
+	watch := &copyWatch{
+		cursors: make(map[string]uint64),
+		stops:   make(map[string]func()),
+		targets: make(map[string][]*models.CopyTarget),
+		copied:  make(map[common.Hash]bool),
+		recent:  make([]common.Hash, copyMaxRemembered),
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkCopyTargets(ctx, watch)
+		}
+	}
+}
+
+func (a *application) checkCopyTargets(ctx context.Context, watch *copyWatch) {
+	targets, err := database.GetActiveCopyTargets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving copy targets: %v", err)
+		return
+	}
+	byChain := make(map[string][]*models.CopyTarget)
+	for _, target := range targets {
+		byChain[target.Chain] = append(byChain[target.Chain], target)
+	}
+	watch.mu.Lock()
+	watch.targets = byChain
+	watch.mu.Unlock()
+
+	for chain, stop := range watch.stops {
+		if len(byChain[chain]) == 0 {
+			stop()
+			delete(watch.stops, chain)
+		}
+	}
+
+	for chain, targets := range byChain {
+		cfg := chainConfigFor(convertChainStatusNameToType(chain))
+		client, err := a.ethClient(cfg)
+		if err != nil {
+			continue
+		}
+		if _, ok := watch.stops[chain]; !ok {
+			if pool, err := a.mempool(cfg); err == nil {
+				events, unsubscribe := pool.subscribe(func(e *mempoolEvent) bool { return e.Kind == mempoolSwap })
+				listenCtx, cancel := context.WithCancel(ctx)
+				go a.listenCopySwaps(listenCtx, cfg, watch, events)
+				watch.stops[chain] = func() {
+					cancel()
+					unsubscribe()
+				}
+			}
+		}
+
+		scanCtx, cancel := context.WithTimeout(ctx, copyPollInterval)
+		head, err := client.BlockNumber(scanCtx)
+		if err != nil || head <= watch.cursors[chain] {
+			cancel()
+			continue
+		}
+		from := watch.cursors[chain] + 1
+		if watch.cursors[chain] == 0 || head-watch.cursors[chain] > copyMaxBlocks {
+			from = head
+		}
+
+		seen := make(map[common.Address]bool)
+		var traders []common.Address
+		for _, target := range targets {
+			trader := common.HexToAddress(target.WalletAddress)
+			if !seen[trader] {
+				seen[trader] = true
+				traders = append(traders, trader)
+			}
+		}
+		swaps, err := findCopySwaps(scanCtx, client, cfg, traders, from, head)
+		cancel()
+		if err != nil {
+			log.Printf("Error scanning %s for copy trades: %v", chain, err)
+			continue
+		}
+		watch.cursors[chain] = head
+		a.indexCopySwaps(cfg, swaps)
+
+		claimed := make(map[common.Hash]bool)
+		for _, swap := range swaps {
+			hash := swap.Tx.Hash()
+			if _, ok := claimed[hash]; !ok {
+				claimed[hash] = watch.claim(hash)
+			}
+			if !claimed[hash] {
+				continue
+			}
+			for _, target := range watch.targetsOf(chain, swap.Trader) {
+				go a.mirrorSwap(cfg, target, swap)
+			}
+		}
+	}
+}
+
+// listenCopySwaps mirrors the pending swaps of followed wallets on cfg
+// until ctx is done.
+func (a *application) listenCopySwaps(ctx context.Context, cfg chainConfig, watch *copyWatch, events <-chan *mempoolEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			targets := watch.targetsOf(cfg.Name, e.From())
+			if len(targets) == 0 {
+				continue
+			}
+			swap, ok := pendingCopySwap(cfg, e)
+			if !ok || !watch.claim(e.Tx.Hash()) {
+				continue
+			}
+			for _, target := range targets {
+				go a.mirrorSwap(cfg, target, swap)
+			}
+		}
+	}
+}
+
+// pendingCopySwap reads a pending swap between the native coin and a token.
+// What a buy will receive and a sell return are not known yet.
+func pendingCopySwap(cfg chainConfig, e *mempoolEvent) (*copySwap, bool) {
+	tokenIn, tokenOut, amountIn, ok := e.swapLeg()
+	if !ok {
+		return nil, false
+	}
+	swap := &copySwap{Trader: e.From(), Tx: e.Tx, Method: e.Method, NativeAmount: new(big.Int), TokenAmount: new(big.Int), Pending: true}
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	switch {
+	case tokenIn == wrapped && tokenOut != wrapped:
+		swap.Side, swap.Token, swap.NativeAmount = database.TradeSideBuy, tokenOut, amountIn
+	case tokenOut == wrapped && tokenIn != wrapped:
+		swap.Side, swap.Token, swap.TokenAmount = database.TradeSideSell, tokenIn, amountIn
+	default:
+		return nil, false
+	}
+	return swap, true
+}
+
+// indexCopySwaps saves the swaps that moved native coin, which are the ones
+// a wallet's performance is measured on.
+func (a *application) indexCopySwaps(cfg chainConfig, swaps []*copySwap) {
+	for _, swap := range swaps {
+		if swap.NativeAmount.Sign() > 0 {
+			database.SaveCopyTargetSwap(a.db, swap.record(cfg))
+		}
+	}
+}
+
+// backfillCopyTarget indexes the swaps a newly followed wallet made in the
+// last copyBackfillBlocks blocks.
+func (a *application) backfillCopyTarget(cfg chainConfig, wallet common.Address) {
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Printf("Error backfilling copy target %s: %v", wallet.Hex(), err)
+		return
+	}
+	start := uint64(0)
+	if head > copyBackfillBlocks {
+		start = head - copyBackfillBlocks
+	}
+	for from := start; from <= head; from += copyBackfillChunk {
+		to := min(from+copyBackfillChunk-1, head)
+		swaps, err := findCopySwaps(ctx, client, cfg, []common.Address{wallet}, from, to)
+		if err != nil {
+			log.Printf("Error backfilling copy target %s: %v", wallet.Hex(), err)
+			return
+		}
+		a.indexCopySwaps(cfg, swaps)
+	}
+}
+
+// copyVerb picks the wording for a mined or a pending swap.
+func copyVerb(swap *copySwap, mined, pending string) string {
+	if swap.Pending {
+		return pending
+	}
+	return mined
+}
+
+// copyBuyAmount is what each wallet spends copying a buy of target.
+func copyBuyAmount(target *models.CopyTarget, nativeIn *big.Int) (*big.Int, error) {
+	amount := new(big.Int)
+	if target.Ratio > 0 {
+		new(big.Float).Mul(new(big.Float).SetInt(nativeIn), big.NewFloat(target.Ratio)).Int(amount)
+	} else {
+		var err error
+		if amount, err = parseUnits(target.Amount, 18); err != nil {
+			return nil, err
+		}
+	}
+	if target.MaxBuy != "" {
+		maxBuy, err := parseUnits(target.MaxBuy, 18)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Cmp(maxBuy) > 0 {
+			amount = maxBuy
+		}
+	}
+	return amount, nil
+}
+
+// mirrorSwap repeats a target's swap from the chat's copy trade wallets and
+// reports it.
+func (a *application) mirrorSwap(cfg chainConfig, target *models.CopyTarget, swap *copySwap) {
+	if swap.Side == database.TradeSideSell && !target.CopySells {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), copyTimeout)
+	defer cancel()
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return
+	}
+	info, err := readTokenInfo(ctx, client, swap.Token)
+	if err != nil {
+		log.Printf("Error reading copied token %s: %v", swap.Token.Hex(), err)
+		return
+	}
+	wallets, err := a.tradingWallets(target.ChatID, database.CopyTradeWalletsPurpose(cfg.Name))
+	if err != nil {
+		log.Printf("Error getting copy trade wallets: %v", err)
+		return
+	}
+	if len(wallets) == 0 {
+		a.client.SendMessage(target.ChatID, fmt.Sprintf("Copy Trading skipped a %s of %s by %s: no wallets are selected for %s.", swap.Side, info.Symbol, shortAddress(target.WalletAddress), cfg.Name))
+		return
+	}
+
+	trader := shortAddress(target.WalletAddress)
+	symbol := markdownEscaper.Replace(info.Symbol)
+	link := fmt.Sprintf("via %s ([transaction](%s))", swap.Method, cfg.txURL(swap.Tx.Hash().Hex()))
+
+	var summary string
+	var results []swapResult
+	if swap.Side == database.TradeSideBuy {
+		amount, err := copyBuyAmount(target, swap.NativeAmount)
+		if err != nil || amount.Sign() <= 0 {
+			log.Printf("Invalid copy amount for target %s: %v", target.ID, err)
+			return
+		}
+		summary = fmt.Sprintf("%s %s %s for %s %s %s.\nBuying %s %s from each wallet.",
+			trader, copyVerb(swap, "bought", "is buying"), symbol, formatUnits(swap.NativeAmount, 18), cfg.NativeSymbol, link, formatUnits(amount, 18), cfg.NativeSymbol)
+		results, _, err = a.buyToken(ctx, cfg, target.ChatID, info, amount, wallets, buyOptions{})
+		if err != nil {
+			summary += "\n❌ " + markdownEscaper.Replace(err.Error())
+		}
+	} else {
+		// The target's balance before a mined sell is what is left plus
+		// what was sold.
+		before, err := tokenBalance(ctx, client, swap.Token, swap.Trader)
+		if err != nil || (swap.Pending && before.Sign() == 0) {
+			return
+		}
+		if !swap.Pending {
+			before.Add(before, swap.TokenAmount)
+		}
+		percent := int(new(big.Int).Div(new(big.Int).Mul(swap.TokenAmount, big.NewInt(100)), before).Int64())
+		percent = max(1, min(percent, 100))
+		if results, err = a.sellToken(ctx, cfg, target.ChatID, info, sellSpec{Percent: percent}, wallets); err != nil || len(results) == 0 {
+			// Nothing to sell: the chat never copied this token.
+			return
+		}
+		summary = fmt.Sprintf("%s %s %d%% of their %s %s.\nSelling %d%% from each wallet.", trader, copyVerb(swap, "sold", "is selling"), percent, symbol, link, percent)
+	}
+
+	for _, result := range results {
+		if result.Err == nil {
+			database.SetTradeCopyTarget(a.db, result.Tx.Hash().Hex(), target.ID)
+		}
+	}
+
+	copyMsg := fmt.Sprintf(`🏛️ Copy Trade (🔗%s)
+
+%s
+
+%s`, cfg.Name, summary, formatSwapResults(cfg, results))
+	a.client.SendMessage(target.ChatID, copyMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
+
+// copyTargetEdit is a copy target setting waiting to be typed in.
+type copyTargetEdit struct {
+	TargetID uuid.UUID
+	Field    string
+}
+
+// formatCopyAmount describes how much a target's buys are copied with.
+func formatCopyAmount(target *models.CopyTarget, cfg chainConfig) string {
+	if target.Ratio > 0 {
+		return fmt.Sprintf("%gx of their buy", target.Ratio)
+	}
+	return fmt.Sprintf("%s %s", target.Amount, cfg.NativeSymbol)
+}
+
+// parseCopyAmount reads "0.5x" as a ratio of the target's buy and "0.05" as
+// a fixed native amount per wallet.
+func parseCopyAmount(text string, target *models.CopyTarget) error {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if ratio, ok := strings.CutSuffix(text, "x"); ok {
+		value, err := strconv.ParseFloat(ratio, 64)
+		if err != nil || value <= 0 {
+			return fmt.Errorf("invalid ratio %q", text)
+		}
+		target.Ratio, target.Amount = value, ""
+		return nil
+	}
+	if amount, err := parseUnits(text, 18); err != nil || amount.Sign() <= 0 {
+		return fmt.Errorf("invalid amount %q", text)
+	}
+	target.Ratio, target.Amount = 0, text
+	return nil
+}
+
+// copyTradingChainHandler lists the wallets a chat copies on one chain.
+func (a *application) copyTradingChainHandler(chain database.ChainStatusOne, m *tbot.Message) {
+	cfg := chainConfigFor(chain)
+	if !cfg.isEVM() {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Copy Trading is not available on %s yet.", cfg.Name))
+		return
+	}
+	targets, err := database.GetChatCopyTargets(a.db, m.Chat.ID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting copy targets: %v", err)
+	}
+	wallets, err := database.GetDefaultWallets(a.db, m.Chat.ID, database.CopyTradeWalletsPurpose(cfg.Name))
+	if err != nil {
+		log.Printf("Error getting copy trade wallets: %v", err)
+	}
+
+	var targetList strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, target := range targets {
+		sells := "buys only"
+		if target.CopySells {
+			sells = "buys and sells"
+		}
+		targetList.WriteString(fmt.Sprintf("%d. %s %s\n   %s, %s\n", i+1, toggleLabel(target.Enabled), target.WalletAddress, formatCopyAmount(target, cfg), sells))
+		buttons = append(buttons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("#%d %s", i+1, shortAddress(target.WalletAddress)), CallbackData: "copy_target_" + target.ID.String()},
+		})
+	}
+	if len(targets) == 0 {
+		targetList.WriteString("No wallets followed.\n")
+	}
+
+	timing := "as soon as they land in a block."
+	if cfg.WSURL != "" || cfg.MempoolFile != "" {
+		timing = `as soon as they show up in the mempool,
+before they are mined. A copy can go through even if the
+original swap never lands.`
+	}
+	copyTradingMsg := fmt.Sprintf(`Copy Trading (🔗%s)
+
+Swaps of the wallets below are mirrored from your copy trade
+wallets %s
+
+Following:
+%s`, cfg.Name, timing, targetList.String())
+
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "➕ Follow Wallet", CallbackData: "copy_add_" + cfg.Name}},
+		[]tbot.InlineKeyboardButton{{Text: "📊 Leaderboard", CallbackData: "copy_stats_" + cfg.Name}},
+		[]tbot.InlineKeyboardButton{{Text: fmt.Sprintf("Copy Wallets: %d selected", len(wallets)), CallbackData: "copy_wallets_" + cfg.Name}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "copy_trading"}},
+	)
+	a.client.SendMessage(m.Chat.ID, copyTradingMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) copyTargetAddHandler(chainName string, m *tbot.Message) {
+	a.draftsMu.Lock()
+	if a.copyTargetDrafts == nil {
+		a.copyTargetDrafts = make(map[string]string)
+	}
+	a.copyTargetDrafts[m.Chat.ID] = chainName
+	a.draftsMu.Unlock()
+
+	a.waitingForCopyTarget = true
+	a.client.SendMessage(m.Chat.ID, `Send the wallet to follow as:
+<wallet address> <amount>
+
+The amount is a multiple of what the wallet spends such as 0.5x,
+or a fixed amount per wallet such as 0.05.
+
+For example: 0x1234...abcd 0.5x`)
+}
+
+// copyTargetInputHandler follows the wallet entered after "Follow Wallet".
+func (a *application) copyTargetInputHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	chainName, ok := a.copyTargetDrafts[m.Chat.ID]
+	delete(a.copyTargetDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	if len(fields) != 2 || !isEVMAddress(fields[0]) {
+		a.client.SendMessage(m.Chat.ID, "Invalid wallet. Expected: <wallet address> <amount>")
+		return
+	}
+	target := &models.CopyTarget{
+		ChatID:        m.Chat.ID,
+		Chain:         chainName,
+		WalletAddress: common.HexToAddress(fields[0]).Hex(),
+		CopySells:     true,
+		Enabled:       true,
+	}
+	if err := parseCopyAmount(fields[1], target); err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error()+".")
+		return
+	}
+	if err := database.CreateCopyTarget(a.db, target); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to follow the wallet.")
+		return
+	}
+	go a.backfillCopyTarget(chainConfigFor(convertChainStatusNameToType(chainName)), common.HexToAddress(target.WalletAddress))
+	a.copyTradingChainHandler(convertChainStatusNameToType(chainName), m)
+}
+
+// copyTargetHandler shows the settings of one followed wallet.
+func (a *application) copyTargetHandler(id string, m *tbot.Message) {
+	targetID, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("Invalid copy target id: %s", id)
+		return
+	}
+	target, err := database.GetCopyTarget(a.db, m.Chat.ID, targetID)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "That wallet is no longer followed.")
+		return
+	}
+	cfg := chainConfigFor(convertChainStatusNameToType(target.Chain))
+
+	maxBuy := "None"
+	if target.MaxBuy != "" {
+		maxBuy = fmt.Sprintf("%s %s", target.MaxBuy, cfg.NativeSymbol)
+	}
+	copyTargetMsg := fmt.Sprintf(`Copy Trading (🔗%s) > %s
+
+Buys are copied with the amount below, up to Max Buy per
+wallet. Copied sells sell the same share of your balance.`, cfg.Name, target.WalletAddress)
+
+	callback := func(field string) string {
+		return fmt.Sprintf("copy_set_%s_%s", field, target.ID)
+	}
+	buttons := [][]tbot.InlineKeyboardButton{
+		{{Text: "Copying:" + toggleLabel(target.Enabled), CallbackData: callback("toggle")}},
+		{{Text: "Amount: " + formatCopyAmount(target, cfg), CallbackData: callback("amount")}},
+		{{Text: "Max Buy: " + maxBuy, CallbackData: callback("max")}},
+		{{Text: "Copy Sells:" + toggleLabel(target.CopySells), CallbackData: callback("sells")}},
+		{{Text: "🗑 Unfollow", CallbackData: callback("remove")}},
+		{{Text: "Back", CallbackData: "copy_chain_" + target.Chain}},
+	}
+	a.client.SendMessage(m.Chat.ID, copyTargetMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+// copyTargetSettingHandler handles the buttons of a followed wallet. data is
+// "<field>_<id>".
+func (a *application) copyTargetSettingHandler(data string, m *tbot.Message) {
+	field, id, _ := strings.Cut(data, "_")
+	targetID, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("Invalid copy target callback: %s", data)
+		return
+	}
+	target, err := database.GetCopyTarget(a.db, m.Chat.ID, targetID)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "That wallet is no longer followed.")
+		return
+	}
+
+	switch field {
+	case "toggle", "sells":
+		if field == "toggle" {
+			target.Enabled = !target.Enabled
+		} else {
+			target.CopySells = !target.CopySells
+		}
+		if err := database.SaveCopyTarget(a.db, target); err != nil {
+			a.client.SendMessage(m.Chat.ID, "Failed to save Copy Trading settings.")
+			return
+		}
+		a.copyTargetHandler(id, m)
+	case "remove":
+		if err := database.DeleteCopyTarget(a.db, m.Chat.ID, targetID); err != nil {
+			a.client.SendMessage(m.Chat.ID, "Failed to unfollow the wallet.")
+			return
+		}
+		a.copyTradingChainHandler(convertChainStatusNameToType(target.Chain), m)
+	case "amount", "max":
+		a.draftsMu.Lock()
+		if a.copyTargetEdits == nil {
+			a.copyTargetEdits = make(map[string]copyTargetEdit)
+		}
+		a.copyTargetEdits[m.Chat.ID] = copyTargetEdit{TargetID: targetID, Field: field}
+		a.draftsMu.Unlock()
+
+		prompts := map[string]string{
+			"amount": "Enter a multiple of the wallet's buys such as 0.5x, or a fixed amount per wallet such as 0.05:",
+			"max":    "Enter the most to spend per wallet on one copied buy, or 0 for no limit:",
+		}
+		a.waitingForCopyTargetValue = true
+		a.client.SendMessage(m.Chat.ID, prompts[field])
+	default:
+		log.Printf("Invalid copy target callback: %s", data)
+	}
+}
+
+// copyTargetValueHandler saves the value typed in after a followed wallet's
+// Amount or Max Buy button.
+func (a *application) copyTargetValueHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	edit, ok := a.copyTargetEdits[m.Chat.ID]
+	delete(a.copyTargetEdits, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+	target, err := database.GetCopyTarget(a.db, m.Chat.ID, edit.TargetID)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "That wallet is no longer followed.")
+		return
+	}
+
+	text := strings.TrimSpace(m.Text)
+	switch edit.Field {
+	case "amount":
+		if err := parseCopyAmount(text, target); err != nil {
+			a.client.SendMessage(m.Chat.ID, err.Error()+".")
+			return
+		}
+	case "max":
+		amount, err := parseUnits(text, 18)
+		if err != nil || amount.Sign() < 0 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", text))
+			return
+		}
+		target.MaxBuy = text
+		if amount.Sign() == 0 {
+			target.MaxBuy = ""
+		}
+	}
+
+	if err := database.SaveCopyTarget(a.db, target); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save Copy Trading settings.")
+		return
+	}
+	a.copyTargetHandler(target.ID.String(), m)
+}
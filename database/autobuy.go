@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/l3njo/rochambeau/models"
+)
+
+// DefaultAutoBuyAmount is the native amount per wallet of a new auto-buy
+// config.
+const DefaultAutoBuyAmount = "0.1"
+
+// AutoBuyWalletsPurpose is the default-wallets purpose holding the wallets
+// auto buys on chain use.
+func AutoBuyWalletsPurpose(chain string) string {
+	return "auto_buy_" + strings.ToLower(chain)
+}
+
+// GetAutoBuyConfig returns a chat's auto-buy config for a chain, or a
+// disabled config with default values when none is saved.
+func GetAutoBuyConfig(db *sql.DB, chatID, chain string) (*models.AutoBuyConfig, error) {
+	config := &models.AutoBuyConfig{ChatID: chatID, Chain: chain, Amount: DefaultAutoBuyAmount}
+	err := db.QueryRow(`SELECT enabled, amount, max_tax, min_liquidity, updated_at FROM auto_buy_configs WHERE chat_id = $1 AND chain = $2`, chatID, chain).
+		Scan(&config.Enabled, &config.Amount, &config.MaxTax, &config.MinLiquidity, &config.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveAutoBuyConfig creates or replaces a chat's auto-buy config for a chain.
+func SaveAutoBuyConfig(db *sql.DB, config *models.AutoBuyConfig) error {
+	query := `INSERT INTO auto_buy_configs (chat_id, chain, enabled, amount, max_tax, min_liquidity, updated_at) VALUES ($1, $2, $3, $4, $5, $6, now())
+		ON CONFLICT (chat_id, chain) DO UPDATE SET enabled = EXCLUDED.enabled, amount = EXCLUDED.amount, max_tax = EXCLUDED.max_tax, min_liquidity = EXCLUDED.min_liquidity, updated_at = now()`
+	_, err := db.Exec(query, config.ChatID, config.Chain, config.Enabled, config.Amount, config.MaxTax, config.MinLiquidity)
+	if err != nil {
+		log.Printf("Failed to save auto buy config: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/models"
+)
+
+// CopyTradeWalletsPurpose is the default-wallets purpose holding the wallets
+// copy trades on chain use.
+func CopyTradeWalletsPurpose(chain string) string {
+	return "copy_trade_" + strings.ToLower(chain)
+}
+
+const copyTargetColumns = `id, chat_id, chain, wallet_address, amount, ratio, max_buy, copy_sells, enabled, create_date, updated_at`
+
+func scanCopyTargets(rows *sql.Rows) ([]*models.CopyTarget, error) {
+	defer rows.Close()
+
+	var targets []*models.CopyTarget
+	for rows.Next() {
+		t := &models.CopyTarget{}
+		if err := rows.Scan(&t.ID, &t.ChatID, &t.Chain, &t.WalletAddress, &t.Amount, &t.Ratio, &t.MaxBuy, &t.CopySells, &t.Enabled, &t.Createdate, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// CreateCopyTarget starts following a wallet, or updates the amounts of a
+// wallet the chat already follows on that chain, and fills in its ID.
+func CreateCopyTarget(db *sql.DB, target *models.CopyTarget) error {
+	query := `INSERT INTO copy_targets (chat_id, chain, wallet_address, amount, ratio, max_buy, copy_sells, enabled) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (chat_id, chain, wallet_address) DO UPDATE SET amount = EXCLUDED.amount, ratio = EXCLUDED.ratio, updated_at = now() RETURNING id`
+	err := db.QueryRow(query, target.ChatID, target.Chain, strings.ToLower(target.WalletAddress), target.Amount, target.Ratio, target.MaxBuy, target.CopySells, target.Enabled).Scan(&target.ID)
+	if err != nil {
+		log.Printf("Failed to insert copy target: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetChatCopyTargets returns the wallets a chat follows on chain.
+func GetChatCopyTargets(db *sql.DB, chatID, chain string) ([]*models.CopyTarget, error) {
+	rows, err := db.Query(`SELECT `+copyTargetColumns+` FROM copy_targets WHERE chat_id = $1 AND chain = $2 ORDER BY create_date`, chatID, chain)
+	if err != nil {
+		return nil, err
+	}
+	return scanCopyTargets(rows)
+}
+
+// GetActiveCopyTargets returns the enabled copy targets of every chat.
+func GetActiveCopyTargets(db *sql.DB) ([]*models.CopyTarget, error) {
+	rows, err := db.Query(`SELECT ` + copyTargetColumns + ` FROM copy_targets WHERE enabled ORDER BY create_date`)
+	if err != nil {
+		return nil, err
+	}
+	return scanCopyTargets(rows)
+}
+
+// GetCopyTarget returns one of a chat's copy targets.
+func GetCopyTarget(db *sql.DB, chatID string, id uuid.UUID) (*models.CopyTarget, error) {
+	rows, err := db.Query(`SELECT `+copyTargetColumns+` FROM copy_targets WHERE chat_id = $1 AND id = $2`, chatID, id)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := scanCopyTargets(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return targets[0], nil
+}
+
+// SaveCopyTarget stores the settings of a copy target.
+func SaveCopyTarget(db *sql.DB, target *models.CopyTarget) error {
+	query := `UPDATE copy_targets SET amount = $1, ratio = $2, max_buy = $3, copy_sells = $4, enabled = $5, updated_at = now() WHERE id = $6 AND chat_id = $7`
+	if _, err := db.Exec(query, target.Amount, target.Ratio, target.MaxBuy, target.CopySells, target.Enabled, target.ID, target.ChatID); err != nil {
+		log.Printf("Failed to save copy target: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCopyTarget stops a chat following a wallet.
+func DeleteCopyTarget(db *sql.DB, chatID string, id uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM copy_targets WHERE chat_id = $1 AND id = $2`, chatID, id); err != nil {
+		log.Printf("Failed to delete copy target: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SaveCopyTargetSwap indexes a swap of a followed wallet, ignoring swaps
+// already indexed.
+func SaveCopyTargetSwap(db *sql.DB, swap *models.CopyTargetSwap) error {
+	query := `INSERT INTO copy_target_swaps (chain, wallet_address, token_address, side, native_amount, token_amount, tx_hash, block_number, block_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chain, tx_hash, wallet_address, token_address, side) DO NOTHING`
+	_, err := db.Exec(query, swap.Chain, strings.ToLower(swap.WalletAddress), strings.ToLower(swap.TokenAddress), swap.Side, swap.NativeAmount, swap.TokenAmount, swap.TxHash, swap.BlockNumber, swap.BlockTime)
+	if err != nil {
+		log.Printf("Failed to insert copy target swap: %v", err)
+	}
+	return err
+}
+
+// GetCopyTargetSwaps returns the indexed swaps of a wallet on chain, oldest
+// first.
+func GetCopyTargetSwaps(db *sql.DB, chain, walletAddress string) ([]*models.CopyTargetSwap, error) {
+	query := `SELECT chain, wallet_address, token_address, side, native_amount, token_amount, tx_hash, block_number, block_time FROM copy_target_swaps WHERE chain = $1 AND wallet_address = $2 ORDER BY block_number`
+	rows, err := db.Query(query, chain, strings.ToLower(walletAddress))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var swaps []*models.CopyTargetSwap
+	for rows.Next() {
+		s := &models.CopyTargetSwap{}
+		if err := rows.Scan(&s.Chain, &s.WalletAddress, &s.TokenAddress, &s.Side, &s.NativeAmount, &s.TokenAmount, &s.TxHash, &s.BlockNumber, &s.BlockTime); err != nil {
+			return nil, err
+		}
+		swaps = append(swaps, s)
+	}
+	return swaps, rows.Err()
+}
+
+// SetTradeCopyTarget marks the trade sent in txHash as a copy of target.
+func SetTradeCopyTarget(db *sql.DB, txHash string, targetID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE trades SET copy_target_id = $1 WHERE tx_hash = $2`, targetID, txHash); err != nil {
+		log.Printf("Failed to tag copy trade: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetCopyTargetTrades returns the confirmed trades that copied a target,
+// oldest first.
+func GetCopyTargetTrades(db *sql.DB, targetID uuid.UUID) ([]*models.Trade, error) {
+	rows, err := db.Query(`SELECT `+tradeColumns+` FROM trades WHERE copy_target_id = $1 AND status = $2 ORDER BY create_date`, targetID, TransferStatusConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrades(rows)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +14,17 @@ import (
 
 var ErrRecordNotFound = errors.New("record not found")
 
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusConfirmed = "confirmed"
+	TransferStatusFailed    = "failed"
+	TransferStatusDropped   = "dropped"
+	// TransferStatusCancelling marks a transfer whose transaction was replaced
+	// by a cancellation that has not been mined yet.
+	TransferStatusCancelling = "cancelling"
+	TransferStatusCancelled  = "cancelled"
+)
+
 type TransferRecord struct {
 	ID            uuid.UUID `json:"id"`
 	FromChain     string    `json:"fromChain"`
@@ -24,6 +36,17 @@ type TransferRecord struct {
 	ToAddress     string    `json:"toAddress"`
 	TransactionID string    `json:"transactionId"`
 	Status        string    `json:"status"`
+	TokenAddress  string    `json:"tokenAddress"`
+	ChatID        string    `json:"chatId"`
+	BlockNumber   uint64    `json:"blockNumber"`
+	GasUsed       uint64    `json:"gasUsed"`
+	EffectiveFee  string    `json:"effectiveFee"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Provider      string    `json:"provider"`
+	// ReplacedTransactionIDs holds the hashes of earlier transactions with
+	// the same nonce, any of which may still be the one that gets mined.
+	ReplacedTransactionIDs []string `json:"replacedTransactionIds"`
 }
 
 // CreateWallet inserts a new wallet record into the database.
@@ -145,9 +168,107 @@ func GetUpdatedTime(db *sql.DB, wallet_address string) (time.Time, error) {
 }
 
 func CreateTransferRecord(db *sql.DB, transfer *TransferRecord) error {
-	query := `INSERT INTO transfers (from_chain, to_chain, from_token, to_token, amount, from_address, to_address, transaction_id, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
-	_, err := db.Exec(query, transfer.FromChain, transfer.ToChain, transfer.FromToken, transfer.ToToken, transfer.Amount, transfer.FromAddress, transfer.ToAddress, transfer.TransactionID, transfer.Status)
-	return err
+	query := `INSERT INTO transfers (from_chain, to_chain, from_token, to_token, amount, from_address, to_address, transaction_id, status, token_address, chat_id, provider) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id;`
+	return db.QueryRow(query, transfer.FromChain, transfer.ToChain, transfer.FromToken, transfer.ToToken, transfer.Amount, transfer.FromAddress, transfer.ToAddress, transfer.TransactionID, transfer.Status, transfer.TokenAddress, transfer.ChatID, transfer.Provider).Scan(&transfer.ID)
+}
+
+const transferColumns = `id, from_chain, to_chain, from_token, to_token, amount, from_address, to_address, transaction_id, status, token_address, chat_id, block_number, gas_used, effective_fee, create_date, updated_at, provider, replaced_transaction_ids`
+
+func scanTransferRecords(rows *sql.Rows) ([]*TransferRecord, error) {
+	var transfers []*TransferRecord
+	for rows.Next() {
+		t := &TransferRecord{}
+		var replaced string
+		err := rows.Scan(&t.ID, &t.FromChain, &t.ToChain, &t.FromToken, &t.ToToken, &t.Amount, &t.FromAddress, &t.ToAddress, &t.TransactionID, &t.Status, &t.TokenAddress, &t.ChatID, &t.BlockNumber, &t.GasUsed, &t.EffectiveFee, &t.CreatedAt, &t.UpdatedAt, &t.Provider, &replaced)
+		if err != nil {
+			return nil, err
+		}
+		if replaced != "" {
+			t.ReplacedTransactionIDs = strings.Split(replaced, ",")
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// GetPendingTransferRecords returns every transfer that has not reached a
+// final state yet.
+func GetPendingTransferRecords(db *sql.DB) ([]*TransferRecord, error) {
+	rows, err := db.Query(`SELECT `+transferColumns+` FROM transfers WHERE status IN ($1, $2) ORDER BY create_date`, TransferStatusPending, TransferStatusCancelling)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransferRecords(rows)
+}
+
+// GetPendingTransferRecordsByChat returns the unfinished transfers of a chat.
+func GetPendingTransferRecordsByChat(db *sql.DB, chatID string) ([]*TransferRecord, error) {
+	rows, err := db.Query(`SELECT `+transferColumns+` FROM transfers WHERE chat_id = $1 AND status IN ($2, $3) ORDER BY create_date`, chatID, TransferStatusPending, TransferStatusCancelling)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransferRecords(rows)
+}
+
+// GetTransferRecord retrieves a transfer by its ID.
+func GetTransferRecord(db *sql.DB, id uuid.UUID) (*TransferRecord, error) {
+	rows, err := db.Query(`SELECT `+transferColumns+` FROM transfers WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	transfers, err := scanTransferRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(transfers) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return transfers[0], nil
+}
+
+// ReplaceTransferTransaction points a transfer at the transaction that
+// replaced its current one. The replaced hash is kept, since either
+// transaction may end up mined.
+func ReplaceTransferTransaction(db *sql.DB, id uuid.UUID, transactionID, status string) error {
+	query := `UPDATE transfers SET
+		replaced_transaction_ids = CASE WHEN replaced_transaction_ids = '' THEN transaction_id ELSE replaced_transaction_ids || ',' || transaction_id END,
+		transaction_id = $1, status = $2, updated_at = $3
+		WHERE id = $4`
+	_, err := db.Exec(query, transactionID, status, time.Now(), id)
+	if err != nil {
+		log.Printf("Failed to replace transfer transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateTransferStatus stores the outcome of a tracked transfer, including
+// which of its transactions was mined.
+func UpdateTransferStatus(db *sql.DB, transfer *TransferRecord) error {
+	query := `UPDATE transfers SET status = $1, block_number = $2, gas_used = $3, effective_fee = $4, updated_at = $5, transaction_id = $6 WHERE id = $7`
+	_, err := db.Exec(query, transfer.Status, transfer.BlockNumber, transfer.GasUsed, transfer.EffectiveFee, time.Now(), transfer.TransactionID, transfer.ID)
+	if err != nil {
+		log.Printf("Failed to update transfer: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetWalletByAddress retrieves a wallet record by its address.
+func GetWalletByAddress(db *sql.DB, address string) (*models.Wallet, error) {
+	row := db.QueryRow(`SELECT id, chat_id, chain_scan_label, account_worth, private_key, wallet_address, create_date, updated_at FROM wallet WHERE LOWER(wallet_address) = LOWER($1) LIMIT 1`, address)
+	var wallet models.Wallet
+	err := row.Scan(&wallet.ID, &wallet.ChatId, &wallet.ChainScanLabel, &wallet.AccountWorth, &wallet.PrivateKey, &wallet.Address, &wallet.Createdate, &wallet.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		log.Printf("Failed to query wallet: %v", err)
+		return nil, err
+	}
+	return &wallet, nil
 }
 
 func FindMultipleWalletsByAddress(db *sql.DB, address string) (bool, error) {
@@ -170,24 +291,25 @@ func FindMultipleWalletsByAddress(db *sql.DB, address string) (bool, error) {
 	}
 }
 
+// SetDefaultSettings saves the trading defaults, creating the row when none
+// has been saved yet.
 func SetDefaultSettings(db *sql.DB, settings *models.DefaultSettings) error {
-	// Prepare an SQL statement
-	stmt, err := db.Prepare("UPDATE settings SET slippage=$1, sellgweextra=$2, approvecwei=$3, buytax=$4, selltax=$5, minliquidity=$6, alphamode=$7, multitxorrevert=$8, antirug=$9 WHERE id=1")
-	if err != nil {
-		return err
-	}
-
-	// Execute the statement with the settings values
-	_, err = stmt.Exec(settings.Slippage, settings.SellGweiExtra, settings.ApproveGwei, settings.BuyTax, settings.SellTax, settings.MinLiquidity, settings.AlphaMode, settings.MultitxOrRevert, settings.AntiRug)
-	if err != nil {
+	settings.UpdatedAt = time.Now()
+	if settings.ID == uuid.Nil {
+		settings.ID = uuid.New()
+		settings.Createdate = settings.UpdatedAt
+		_, err := db.Exec(`INSERT INTO default_settings (id, slippage, sell_gwei_extra, approve_gwei, buy_tax, sell_tax, min_liquidity, alpha_mode, multitx_or_revert, anti_rug, unchecked_buys, create_date, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			settings.ID, settings.Slippage, settings.SellGweiExtra, settings.ApproveGwei, settings.BuyTax, settings.SellTax, settings.MinLiquidity, settings.AlphaMode, settings.MultitxOrRevert, settings.AntiRug, settings.UncheckedBuys, settings.Createdate, settings.UpdatedAt)
 		return err
 	}
 
-	return nil
+	_, err := db.Exec(`UPDATE default_settings SET slippage=$1, sell_gwei_extra=$2, approve_gwei=$3, buy_tax=$4, sell_tax=$5, min_liquidity=$6, alpha_mode=$7, multitx_or_revert=$8, anti_rug=$9, unchecked_buys=$10, updated_at=$11 WHERE id=$12`,
+		settings.Slippage, settings.SellGweiExtra, settings.ApproveGwei, settings.BuyTax, settings.SellTax, settings.MinLiquidity, settings.AlphaMode, settings.MultitxOrRevert, settings.AntiRug, settings.UncheckedBuys, settings.UpdatedAt, settings.ID)
+	return err
 }
 
 func GetDefaultSettings(db *sql.DB) ([]*models.DefaultSettings, error) {
-	rows, err := db.Query("SELECT * FROM default_settings")
+	rows, err := db.Query(`SELECT id, slippage, sell_gwei_extra, approve_gwei, buy_tax, sell_tax, min_liquidity, alpha_mode, multitx_or_revert, anti_rug, unchecked_buys, create_date, updated_at FROM default_settings`)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +318,7 @@ func GetDefaultSettings(db *sql.DB) ([]*models.DefaultSettings, error) {
 	var defaultSettings []*models.DefaultSettings
 	for rows.Next() {
 		defaultSetting := &models.DefaultSettings{}
-		err := rows.Scan(&defaultSetting.ID, &defaultSetting.Slippage, &defaultSetting.SellGweiExtra, &defaultSetting.ApproveGwei, &defaultSetting.BuyTax, &defaultSetting.SellTax, &defaultSetting.MinLiquidity, &defaultSetting.AlphaMode, &defaultSetting.MultitxOrRevert, &defaultSetting.AntiRug, &defaultSetting.Createdate, &defaultSetting.UpdatedAt)
+		err := rows.Scan(&defaultSetting.ID, &defaultSetting.Slippage, &defaultSetting.SellGweiExtra, &defaultSetting.ApproveGwei, &defaultSetting.BuyTax, &defaultSetting.SellTax, &defaultSetting.MinLiquidity, &defaultSetting.AlphaMode, &defaultSetting.MultitxOrRevert, &defaultSetting.AntiRug, &defaultSetting.UncheckedBuys, &defaultSetting.Createdate, &defaultSetting.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/models"
+)
+
+// DCA order statuses.
+const (
+	DCAStatusActive    = "active"
+	DCAStatusPaused    = "paused"
+	DCAStatusCompleted = "completed"
+	DCAStatusCancelled = "cancelled"
+)
+
+const dcaOrderColumns = `id, chat_id, chain, token_address, side, amount, budget, spent, interval_seconds, price_limit, runs, wallets, status, next_run, create_date, updated_at`
+
+func scanDCAOrders(rows *sql.Rows) ([]*models.DCAOrder, error) {
+	defer rows.Close()
+
+	var orders []*models.DCAOrder
+	for rows.Next() {
+		o := &models.DCAOrder{}
+		var wallets string
+		if err := rows.Scan(&o.ID, &o.ChatID, &o.Chain, &o.TokenAddress, &o.Side, &o.Amount, &o.Budget, &o.Spent, &o.Interval, &o.PriceLimit, &o.Runs, &wallets, &o.Status, &o.NextRun, &o.Createdate, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if wallets != "" {
+			o.Wallets = strings.Split(wallets, ",")
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// CreateDCAOrder saves an active schedule whose first run is due right away
+// and fills in its ID.
+func CreateDCAOrder(db *sql.DB, order *models.DCAOrder) error {
+	query := `INSERT INTO dca_orders (chat_id, chain, token_address, side, amount, budget, spent, interval_seconds, price_limit, wallets, status) VALUES ($1, $2, $3, $4, $5, $6, '0', $7, $8, $9, $10) RETURNING id, next_run`
+	err := db.QueryRow(query, order.ChatID, order.Chain, strings.ToLower(order.TokenAddress), order.Side, order.Amount, order.Budget, order.Interval, order.PriceLimit, strings.ToLower(strings.Join(order.Wallets, ",")), DCAStatusActive).Scan(&order.ID, &order.NextRun)
+	if err != nil {
+		log.Printf("Failed to insert DCA order: %v", err)
+		return err
+	}
+	order.Spent = "0"
+	order.Status = DCAStatusActive
+	return nil
+}
+
+// GetDueDCAOrders returns the active schedules whose next run is due.
+func GetDueDCAOrders(db *sql.DB) ([]*models.DCAOrder, error) {
+	rows, err := db.Query(`SELECT `+dcaOrderColumns+` FROM dca_orders WHERE status = $1 AND next_run <= now() ORDER BY next_run`, DCAStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	return scanDCAOrders(rows)
+}
+
+// GetChatDCAOrders returns a chat's active and paused schedules.
+func GetChatDCAOrders(db *sql.DB, chatID string) ([]*models.DCAOrder, error) {
+	rows, err := db.Query(`SELECT `+dcaOrderColumns+` FROM dca_orders WHERE chat_id = $1 AND status IN ($2, $3) ORDER BY create_date`, chatID, DCAStatusActive, DCAStatusPaused)
+	if err != nil {
+		return nil, err
+	}
+	return scanDCAOrders(rows)
+}
+
+// ClaimDCARun moves a due schedule's next run one interval ahead and reports
+// whether it was still due, so each run only happens once.
+func ClaimDCARun(db *sql.DB, id uuid.UUID) (bool, error) {
+	query := `UPDATE dca_orders SET next_run = now() + make_interval(secs => interval_seconds), updated_at = now() WHERE id = $1 AND status = $2 AND next_run <= now()`
+	result, err := db.Exec(query, id, DCAStatusActive)
+	if err != nil {
+		log.Printf("Failed to claim DCA run: %v", err)
+		return false, err
+	}
+	claimed, _ := result.RowsAffected()
+	return claimed > 0, nil
+}
+
+// RecordDCARun stores the total a schedule has spent after a run.
+func RecordDCARun(db *sql.DB, id uuid.UUID, spent string) error {
+	if _, err := db.Exec(`UPDATE dca_orders SET spent = $1, runs = runs + 1, updated_at = now() WHERE id = $2`, spent, id); err != nil {
+		log.Printf("Failed to record DCA run: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateDCAOrderStatus moves a schedule from one status to another and
+// reports whether it was still in from.
+func UpdateDCAOrderStatus(db *sql.DB, id uuid.UUID, from, to string) (bool, error) {
+	result, err := db.Exec(`UPDATE dca_orders SET status = $1, updated_at = now() WHERE id = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		log.Printf("Failed to update DCA order: %v", err)
+		return false, err
+	}
+	updated, _ := result.RowsAffected()
+	return updated > 0, nil
+}
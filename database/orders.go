@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/models"
+)
+
+// Limit order statuses.
+const (
+	OrderStatusOpen      = "open"
+	OrderStatusFilled    = "filled"
+	OrderStatusFailed    = "failed"
+	OrderStatusCancelled = "cancelled"
+)
+
+// Limit order triggers: a USD price per token, a USD market cap, or a
+// multiple of the entry price. Take-profits and stop-losses sell at or
+// above, and at or below, a multiple of a position's entry price, and
+// trailing stops once the price falls a percentage from its peak.
+const (
+	OrderTriggerPrice      = "price"
+	OrderTriggerMarketCap  = "mcap"
+	OrderTriggerMultiplier = "multiplier"
+	OrderTriggerTakeProfit = "take_profit"
+	OrderTriggerStopLoss   = "stop_loss"
+	OrderTriggerTrailing   = "trailing"
+)
+
+const limitOrderColumns = `id, chat_id, chain, token_address, side, trigger_type, target, entry_price, peak_price, amount, wallets, status, create_date, updated_at`
+
+func scanLimitOrders(rows *sql.Rows) ([]*models.LimitOrder, error) {
+	defer rows.Close()
+
+	var orders []*models.LimitOrder
+	for rows.Next() {
+		o := &models.LimitOrder{}
+		var wallets string
+		if err := rows.Scan(&o.ID, &o.ChatID, &o.Chain, &o.TokenAddress, &o.Side, &o.Trigger, &o.Target, &o.EntryPrice, &o.PeakPrice, &o.Amount, &wallets, &o.Status, &o.Createdate, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if wallets != "" {
+			o.Wallets = strings.Split(wallets, ",")
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// CreateLimitOrder places an open order and fills in its ID.
+func CreateLimitOrder(db *sql.DB, order *models.LimitOrder) error {
+	query := `INSERT INTO limit_orders (chat_id, chain, token_address, side, trigger_type, target, entry_price, peak_price, amount, wallets, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+	err := db.QueryRow(query, order.ChatID, order.Chain, strings.ToLower(order.TokenAddress), order.Side, order.Trigger, order.Target, order.EntryPrice, order.PeakPrice, order.Amount, strings.ToLower(strings.Join(order.Wallets, ",")), OrderStatusOpen).Scan(&order.ID)
+	if err != nil {
+		log.Printf("Failed to insert limit order: %v", err)
+		return err
+	}
+	order.Status = OrderStatusOpen
+	return nil
+}
+
+// GetOpenLimitOrders returns the orders still waiting for their trigger on
+// every chain.
+func GetOpenLimitOrders(db *sql.DB) ([]*models.LimitOrder, error) {
+	rows, err := db.Query(`SELECT `+limitOrderColumns+` FROM limit_orders WHERE status = $1 ORDER BY create_date`, OrderStatusOpen)
+	if err != nil {
+		return nil, err
+	}
+	return scanLimitOrders(rows)
+}
+
+// GetChatLimitOrders returns a chat's open orders.
+func GetChatLimitOrders(db *sql.DB, chatID string) ([]*models.LimitOrder, error) {
+	rows, err := db.Query(`SELECT `+limitOrderColumns+` FROM limit_orders WHERE chat_id = $1 AND status = $2 ORDER BY create_date`, chatID, OrderStatusOpen)
+	if err != nil {
+		return nil, err
+	}
+	return scanLimitOrders(rows)
+}
+
+// UpdateLimitOrderStatus moves an order from one status to another and
+// reports whether it was still in from, so an order is only ever filled or
+// cancelled once.
+func UpdateLimitOrderStatus(db *sql.DB, id uuid.UUID, from, to string) (bool, error) {
+	result, err := db.Exec(`UPDATE limit_orders SET status = $1, updated_at = now() WHERE id = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		log.Printf("Failed to update limit order: %v", err)
+		return false, err
+	}
+	updated, _ := result.RowsAffected()
+	return updated > 0, nil
+}
+
+// UpdateLimitOrderPeak stores the highest price a trailing stop has seen.
+func UpdateLimitOrderPeak(db *sql.DB, id uuid.UUID, peak float64) error {
+	if _, err := db.Exec(`UPDATE limit_orders SET peak_price = $1, updated_at = now() WHERE id = $2`, peak, id); err != nil {
+		log.Printf("Failed to update limit order peak: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CancelSiblingOrders cancels the other open sells of order's token from
+// the same wallets, once those wallets have nothing left to sell.
+func CancelSiblingOrders(db *sql.DB, order *models.LimitOrder) error {
+	query := `UPDATE limit_orders SET status = $1, updated_at = now() WHERE chat_id = $2 AND chain = $3 AND token_address = $4 AND wallets = $5 AND side = $6 AND status = $7 AND id <> $8`
+	_, err := db.Exec(query, OrderStatusCancelled, order.ChatID, order.Chain, strings.ToLower(order.TokenAddress), strings.ToLower(strings.Join(order.Wallets, ",")), TradeSideSell, OrderStatusOpen, order.ID)
+	if err != nil {
+		log.Printf("Failed to cancel sibling orders: %v", err)
+	}
+	return err
+}
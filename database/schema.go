@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order on every start. Each statement must be
+// safe to run more than once.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS transfers (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		from_chain TEXT NOT NULL,
+		to_chain TEXT NOT NULL,
+		from_token TEXT NOT NULL,
+		to_token TEXT NOT NULL,
+		amount TEXT NOT NULL,
+		from_address TEXT NOT NULL,
+		to_address TEXT NOT NULL,
+		transaction_id TEXT NOT NULL,
+		status TEXT NOT NULL
+	)`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS token_address TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS wallet_tokens (
+		chain TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		PRIMARY KEY (chain, wallet_address, token_address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS address_book (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		label TEXT NOT NULL,
+		address TEXT NOT NULL,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		UNIQUE (chat_id, address)
+	)`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS chat_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS block_number BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS gas_used BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS effective_fee TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS create_date TIMESTAMP NOT NULL DEFAULT now()`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT now()`,
+	`CREATE INDEX IF NOT EXISTS transfers_status_idx ON transfers (status)`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS default_wallets (
+		chat_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		PRIMARY KEY (chat_id, purpose, wallet_address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gas_presets (
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		gwei NUMERIC NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT now(),
+		PRIMARY KEY (chat_id, chain)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trades (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		side TEXT NOT NULL,
+		route TEXT NOT NULL DEFAULT '',
+		native_amount TEXT NOT NULL,
+		token_amount TEXT NOT NULL,
+		tx_hash TEXT NOT NULL,
+		status TEXT NOT NULL,
+		block_number BIGINT NOT NULL DEFAULT 0,
+		gas_fee TEXT NOT NULL DEFAULT '',
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS trades_status_idx ON trades (status)`,
+	`CREATE TABLE IF NOT EXISTS default_settings (
+		id UUID PRIMARY KEY,
+		slippage INTEGER NOT NULL,
+		sell_gwei_extra REAL NOT NULL,
+		approve_gwei REAL NOT NULL,
+		buy_tax REAL NOT NULL,
+		sell_tax REAL NOT NULL,
+		min_liquidity INTEGER NOT NULL,
+		alpha_mode BOOLEAN NOT NULL DEFAULT false,
+		multitx_or_revert BOOLEAN NOT NULL DEFAULT false,
+		anti_rug BOOLEAN NOT NULL DEFAULT false,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS snipe_targets (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		amount TEXT NOT NULL,
+		gas_gwei NUMERIC NOT NULL DEFAULT 0,
+		max_tax REAL NOT NULL DEFAULT 0,
+		wallets TEXT NOT NULL,
+		status TEXT NOT NULL,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS snipe_targets_status_idx ON snipe_targets (chain, status)`,
+	`CREATE TABLE IF NOT EXISTS auto_buy_configs (
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT false,
+		amount TEXT NOT NULL,
+		max_tax REAL NOT NULL DEFAULT 0,
+		min_liquidity INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT now(),
+		PRIMARY KEY (chat_id, chain)
+	)`,
+	`ALTER TABLE trades ADD COLUMN IF NOT EXISTS native_usd TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS trades_chat_idx ON trades (chat_id, chain)`,
+	`CREATE TABLE IF NOT EXISTS trade_confirmations (
+		chat_id TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL DEFAULT false,
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS limit_orders (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		side TEXT NOT NULL,
+		trigger_type TEXT NOT NULL,
+		target DOUBLE PRECISION NOT NULL,
+		entry_price DOUBLE PRECISION NOT NULL DEFAULT 0,
+		amount TEXT NOT NULL,
+		wallets TEXT NOT NULL,
+		status TEXT NOT NULL,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS limit_orders_status_idx ON limit_orders (status)`,
+	`ALTER TABLE limit_orders ADD COLUMN IF NOT EXISTS peak_price DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS dca_orders (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		side TEXT NOT NULL,
+		amount TEXT NOT NULL,
+		budget TEXT NOT NULL,
+		spent TEXT NOT NULL DEFAULT '0',
+		interval_seconds INTEGER NOT NULL,
+		price_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+		runs INTEGER NOT NULL DEFAULT 0,
+		wallets TEXT NOT NULL,
+		status TEXT NOT NULL,
+		next_run TIMESTAMP NOT NULL DEFAULT now(),
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS dca_orders_due_idx ON dca_orders (status, next_run)`,
+	`CREATE TABLE IF NOT EXISTS copy_targets (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		chat_id TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		amount TEXT NOT NULL DEFAULT '',
+		ratio DOUBLE PRECISION NOT NULL DEFAULT 0,
+		max_buy TEXT NOT NULL DEFAULT '',
+		copy_sells BOOLEAN NOT NULL DEFAULT TRUE,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		create_date TIMESTAMP NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP NOT NULL DEFAULT now(),
+		UNIQUE (chat_id, chain, wallet_address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS copy_target_swaps (
+		chain TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		token_address TEXT NOT NULL,
+		side TEXT NOT NULL,
+		native_amount TEXT NOT NULL,
+		token_amount TEXT NOT NULL,
+		tx_hash TEXT NOT NULL,
+		block_number BIGINT NOT NULL,
+		block_time TIMESTAMP NOT NULL,
+		PRIMARY KEY (chain, tx_hash, wallet_address, token_address, side)
+	)`,
+	`CREATE INDEX IF NOT EXISTS copy_target_swaps_wallet_idx ON copy_target_swaps (chain, wallet_address)`,
+	`ALTER TABLE trades ADD COLUMN IF NOT EXISTS copy_target_id UUID`,
+	`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS replaced_transaction_ids TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE default_settings ADD COLUMN IF NOT EXISTS unchecked_buys BOOLEAN NOT NULL DEFAULT false`,
+}
+
+// Migrate creates the tables and columns the bot relies on.
+func Migrate(db *sql.DB) error {
+	for i, stmt := range migrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %d failed: %w", i, err)
+		}
+	}
+	return nil
+}
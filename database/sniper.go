@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/models"
+)
+
+// Snipe target statuses.
+const (
+	SnipeStatusActive    = "active"
+	SnipeStatusSniped    = "sniped"
+	SnipeStatusFailed    = "failed"
+	SnipeStatusCancelled = "cancelled"
+)
+
+const snipeTargetColumns = `id, chat_id, chain, token_address, amount, gas_gwei, max_tax, wallets, status, create_date, updated_at`
+
+func scanSnipeTargets(rows *sql.Rows) ([]*models.SnipeTarget, error) {
+	defer rows.Close()
+
+	var targets []*models.SnipeTarget
+	for rows.Next() {
+		t := &models.SnipeTarget{}
+		var wallets string
+		if err := rows.Scan(&t.ID, &t.ChatID, &t.Chain, &t.TokenAddress, &t.Amount, &t.GasGwei, &t.MaxTax, &wallets, &t.Status, &t.Createdate, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if wallets != "" {
+			t.Wallets = strings.Split(wallets, ",")
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// CreateSnipeTarget registers an active snipe target and fills in its ID.
+func CreateSnipeTarget(db *sql.DB, target *models.SnipeTarget) error {
+	query := `INSERT INTO snipe_targets (chat_id, chain, token_address, amount, gas_gwei, max_tax, wallets, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	err := db.QueryRow(query, target.ChatID, target.Chain, strings.ToLower(target.TokenAddress), target.Amount, target.GasGwei, target.MaxTax, strings.ToLower(strings.Join(target.Wallets, ",")), SnipeStatusActive).Scan(&target.ID)
+	if err != nil {
+		log.Printf("Failed to insert snipe target: %v", err)
+		return err
+	}
+	target.Status = SnipeStatusActive
+	return nil
+}
+
+// GetActiveSnipeTargets returns the targets still waiting for liquidity on a
+// chain.
+func GetActiveSnipeTargets(db *sql.DB, chain string) ([]*models.SnipeTarget, error) {
+	rows, err := db.Query(`SELECT `+snipeTargetColumns+` FROM snipe_targets WHERE chain = $1 AND status = $2 ORDER BY create_date`, chain, SnipeStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnipeTargets(rows)
+}
+
+// GetChatSnipeTargets returns a chat's active targets.
+func GetChatSnipeTargets(db *sql.DB, chatID string) ([]*models.SnipeTarget, error) {
+	rows, err := db.Query(`SELECT `+snipeTargetColumns+` FROM snipe_targets WHERE chat_id = $1 AND status = $2 ORDER BY create_date`, chatID, SnipeStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnipeTargets(rows)
+}
+
+// UpdateSnipeTargetStatus moves a target from one status to another and
+// reports whether it was still in from, so a target is only ever fired or
+// cancelled once.
+func UpdateSnipeTargetStatus(db *sql.DB, id uuid.UUID, from, to string) (bool, error) {
+	result, err := db.Exec(`UPDATE snipe_targets SET status = $1, updated_at = now() WHERE id = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		log.Printf("Failed to update snipe target: %v", err)
+		return false, err
+	}
+	updated, _ := result.RowsAffected()
+	return updated > 0, nil
+}
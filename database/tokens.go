@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/l3njo/rochambeau/models"
+)
+
+// AddWalletToken remembers that a wallet has interacted with a token so it can
+// be offered again in token pickers.
+func AddWalletToken(db *sql.DB, chain, walletAddress, tokenAddress string) error {
+	query := `INSERT INTO wallet_tokens (chain, wallet_address, token_address) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	_, err := db.Exec(query, chain, strings.ToLower(walletAddress), strings.ToLower(tokenAddress))
+	if err != nil {
+		log.Printf("Failed to insert wallet token: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetWalletTokens returns the token addresses known for a wallet on a chain.
+func GetWalletTokens(db *sql.DB, chain, walletAddress string) ([]string, error) {
+	rows, err := db.Query(`SELECT token_address FROM wallet_tokens WHERE chain = $1 AND wallet_address = $2 ORDER BY create_date`, chain, strings.ToLower(walletAddress))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// SaveAddressBookEntry stores a recipient address for a chat. Saving an
+// address that is already present only updates its label.
+func SaveAddressBookEntry(db *sql.DB, entry *models.AddressBookEntry) error {
+	query := `INSERT INTO address_book (chat_id, label, address) VALUES ($1, $2, $3) ON CONFLICT (chat_id, address) DO UPDATE SET label = EXCLUDED.label`
+	_, err := db.Exec(query, entry.ChatID, entry.Label, strings.ToLower(entry.Address))
+	if err != nil {
+		log.Printf("Failed to save address book entry: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetAddressBook lists the saved recipient addresses of a chat.
+func GetAddressBook(db *sql.DB, chatID string) ([]*models.AddressBookEntry, error) {
+	rows, err := db.Query(`SELECT id, chat_id, label, address, create_date FROM address_book WHERE chat_id = $1 ORDER BY create_date`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AddressBookEntry
+	for rows.Next() {
+		entry := &models.AddressBookEntry{}
+		if err := rows.Scan(&entry.ID, &entry.ChatID, &entry.Label, &entry.Address, &entry.Createdate); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetChainTokens returns every token any wallet has interacted with on a
+// chain.
+func GetChainTokens(db *sql.DB, chain string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT token_address FROM wallet_tokens WHERE chain = $1`, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/l3njo/rochambeau/models"
+)
+
+// Purposes a wallet can be preselected for in Settings > Wallets > Default
+// Wallets.
+const (
+	DefaultWalletsSnipe     = "snipe"
+	DefaultWalletsManualBuy = "manual_buy"
+)
+
+const (
+	TradeSideBuy  = "buy"
+	TradeSideSell = "sell"
+)
+
+// ToggleDefaultWallet selects a wallet for purpose, or deselects it if it was
+// already selected, and reports whether it is now selected.
+func ToggleDefaultWallet(db *sql.DB, chatID, purpose, walletAddress string) (bool, error) {
+	walletAddress = strings.ToLower(walletAddress)
+	result, err := db.Exec(`DELETE FROM default_wallets WHERE chat_id = $1 AND purpose = $2 AND wallet_address = $3`, chatID, purpose, walletAddress)
+	if err != nil {
+		log.Printf("Failed to toggle default wallet: %v", err)
+		return false, err
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		return false, nil
+	}
+	_, err = db.Exec(`INSERT INTO default_wallets (chat_id, purpose, wallet_address) VALUES ($1, $2, $3)`, chatID, purpose, walletAddress)
+	if err != nil {
+		log.Printf("Failed to toggle default wallet: %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// GetDefaultWallets returns the addresses of the wallets selected for purpose.
+func GetDefaultWallets(db *sql.DB, chatID, purpose string) ([]string, error) {
+	rows, err := db.Query(`SELECT wallet_address FROM default_wallets WHERE chat_id = $1 AND purpose = $2 ORDER BY create_date`, chatID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []string
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// SetGasPreset stores the gas price, in gwei, a chat uses on a chain.
+func SetGasPreset(db *sql.DB, chatID, chain string, gwei float64) error {
+	query := `INSERT INTO gas_presets (chat_id, chain, gwei) VALUES ($1, $2, $3) ON CONFLICT (chat_id, chain) DO UPDATE SET gwei = EXCLUDED.gwei, updated_at = now()`
+	if _, err := db.Exec(query, chatID, chain, gwei); err != nil {
+		log.Printf("Failed to save gas preset: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetGasPreset returns the chat's gas price for a chain, or 0 when none is
+// set and network fees should be used.
+func GetGasPreset(db *sql.DB, chatID, chain string) (float64, error) {
+	var gwei float64
+	err := db.QueryRow(`SELECT gwei FROM gas_presets WHERE chat_id = $1 AND chain = $2`, chatID, chain).Scan(&gwei)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return gwei, err
+}
+
+// SetTradeConfirmation turns the confirmation dialog before trades on or
+// off for a chat.
+func SetTradeConfirmation(db *sql.DB, chatID string, enabled bool) error {
+	query := `INSERT INTO trade_confirmations (chat_id, enabled) VALUES ($1, $2) ON CONFLICT (chat_id) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = now()`
+	if _, err := db.Exec(query, chatID, enabled); err != nil {
+		log.Printf("Failed to save trade confirmation: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetTradeConfirmation reports whether trades of a chat need confirming.
+func GetTradeConfirmation(db *sql.DB, chatID string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT enabled FROM trade_confirmations WHERE chat_id = $1`, chatID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+const tradeColumns = `id, chat_id, chain, wallet_address, token_address, side, route, native_amount, token_amount, tx_hash, status, block_number, gas_fee, native_usd, create_date, updated_at`
+
+func scanTrades(rows *sql.Rows) ([]*models.Trade, error) {
+	defer rows.Close()
+
+	var trades []*models.Trade
+	for rows.Next() {
+		t := &models.Trade{}
+		if err := rows.Scan(&t.ID, &t.ChatID, &t.Chain, &t.WalletAddress, &t.TokenAddress, &t.Side, &t.Route, &t.NativeAmount, &t.TokenAmount, &t.TxHash, &t.Status, &t.BlockNumber, &t.GasFee, &t.NativeUSD, &t.Createdate, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// CreateTrade records a sent swap and sets trade.ID.
+func CreateTrade(db *sql.DB, trade *models.Trade) error {
+	query := `INSERT INTO trades (chat_id, chain, wallet_address, token_address, side, route, native_amount, token_amount, tx_hash, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+	err := db.QueryRow(query, trade.ChatID, trade.Chain, strings.ToLower(trade.WalletAddress), strings.ToLower(trade.TokenAddress), trade.Side, trade.Route, trade.NativeAmount, trade.TokenAmount, trade.TxHash, trade.Status).Scan(&trade.ID)
+	if err != nil {
+		log.Printf("Failed to insert trade: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetPendingTrades returns the trades whose transactions are not yet mined.
+func GetPendingTrades(db *sql.DB) ([]*models.Trade, error) {
+	rows, err := db.Query(`SELECT `+tradeColumns+` FROM trades WHERE status = $1 ORDER BY create_date`, TransferStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrades(rows)
+}
+
+// GetChatTrades returns a chat's confirmed trades on a chain, oldest first.
+func GetChatTrades(db *sql.DB, chatID, chain string) ([]*models.Trade, error) {
+	rows, err := db.Query(`SELECT `+tradeColumns+` FROM trades WHERE chat_id = $1 AND chain = $2 AND status = $3 ORDER BY create_date`, chatID, chain, TransferStatusConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrades(rows)
+}
+
+// UpdateTradeResult stores the outcome of a mined trade.
+func UpdateTradeResult(db *sql.DB, trade *models.Trade) error {
+	query := `UPDATE trades SET status = $1, native_amount = $2, token_amount = $3, block_number = $4, gas_fee = $5, native_usd = $6, updated_at = now() WHERE id = $7`
+	if _, err := db.Exec(query, trade.Status, trade.NativeAmount, trade.TokenAmount, trade.BlockNumber, trade.GasFee, trade.NativeUSD, trade.ID); err != nil {
+		log.Printf("Failed to update trade: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetTokenTradeChats returns the chats that have traded a token on a chain.
+func GetTokenTradeChats(db *sql.DB, chain, tokenAddress string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT chat_id FROM trades WHERE chain = $1 AND lower(token_address) = lower($2)`, chain, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []string
+	for rows.Next() {
+		var chatID string
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chats = append(chats, chatID)
+	}
+	return chats, rows.Err()
+}
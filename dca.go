@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	// dcaPollInterval is how often the scheduler looks for due DCA runs.
+	dcaPollInterval = 30 * time.Second
+	// minDCAInterval is the shortest time allowed between two runs.
+	minDCAInterval = time.Minute
+)
+
+// watchDCA runs due DCA schedules until ctx is done.
+func (a *application) watchDCA(ctx context.Context) {
+	ticker := time.NewTicker(dcaPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkDCAOrders()
+		}
+	}
+}
+
+func (a *application) checkDCAOrders() {
+	orders, err := database.GetDueDCAOrders(a.db)
+	if err != nil {
+		log.Printf("Error retrieving DCA orders: %v", err)
+		return
+	}
+	for _, order := range orders {
+		claimed, err := database.ClaimDCARun(a.db, order.ID)
+		if err != nil || !claimed {
+			continue
+		}
+		go a.runDCAOrder(order)
+	}
+}
+
+// dcaDecimals is the unit the amounts of order are in.
+func dcaDecimals(order *models.DCAOrder, info *tokenInfo) uint8 {
+	if order.Side == database.TradeSideSell {
+		return info.Decimals
+	}
+	return 18
+}
+
+// dcaUnit names the unit the amounts of order are in.
+func dcaUnit(order *models.DCAOrder, cfg chainConfig) string {
+	if order.Side == database.TradeSideSell {
+		return "tokens"
+	}
+	return cfg.NativeSymbol
+}
+
+// runDCAOrder makes one run of a schedule, spending at most what is left of
+// its budget, and reports it to the chat.
+func (a *application) runDCAOrder(order *models.DCAOrder) {
+	cfg := chainConfigFor(convertChainStatusNameToType(order.Chain))
+	ctx, cancel := context.WithTimeout(context.Background(), orderTimeout)
+	defer cancel()
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		log.Printf("Error connecting to %s: %v", cfg.Name, err)
+		return
+	}
+	quote, err := quoteOrderToken(ctx, client, cfg, common.HexToAddress(order.TokenAddress))
+	if err != nil {
+		log.Printf("Error quoting DCA token %s: %v", order.TokenAddress, err)
+		return
+	}
+	if order.PriceLimit > 0 && quote.PriceUSD != nil {
+		price, _ := quote.PriceUSD.Float64()
+		if (order.Side == database.TradeSideBuy && price > order.PriceLimit) || (order.Side == database.TradeSideSell && price < order.PriceLimit) {
+			log.Printf("Skipping DCA run %s: price %g is past the limit %g", order.ID, price, order.PriceLimit)
+			return
+		}
+	}
+
+	decimals := dcaDecimals(order, quote.Info)
+	amount, err := parseUnits(order.Amount, decimals)
+	if err != nil {
+		log.Printf("Invalid DCA amount %q: %v", order.Amount, err)
+		return
+	}
+	budget, _ := parseUnits(order.Budget, decimals)
+	spent, _ := parseUnits(order.Spent, decimals)
+
+	wallets := a.walletsByAddress(order.Wallets)
+	if len(wallets) == 0 {
+		database.UpdateDCAOrderStatus(a.db, order.ID, database.DCAStatusActive, database.DCAStatusCancelled)
+		a.client.SendMessage(order.ChatID, fmt.Sprintf("🔁 DCA %s of %s cancelled: none of its wallets exist any more.", order.Side, quote.Info.Symbol))
+		return
+	}
+	share := new(big.Int).Div(new(big.Int).Sub(budget, spent), big.NewInt(int64(len(wallets))))
+	if share.Cmp(amount) < 0 {
+		amount = share
+	}
+	if amount.Sign() <= 0 {
+		database.UpdateDCAOrderStatus(a.db, order.ID, database.DCAStatusActive, database.DCAStatusCompleted)
+		return
+	}
+
+	var results []swapResult
+	if order.Side == database.TradeSideBuy {
+		results, _, err = a.buyToken(ctx, cfg, order.ChatID, quote.Info, amount, wallets, buyOptions{})
+	} else {
+		results, err = a.sellToken(ctx, cfg, order.ChatID, quote.Info, sellSpec{Amount: amount}, wallets)
+	}
+	if err == nil && !anySucceeded(results) {
+		err = errors.New("no swap was sent")
+	}
+
+	// A split buy sends several transactions of different sizes, so count
+	// what each sent swap spent rather than the amount asked for.
+	for _, result := range results {
+		if result.Err == nil {
+			spent.Add(spent, result.AmountIn)
+		}
+	}
+	order.Runs++
+	order.Spent = formatUnits(spent, decimals)
+	database.RecordDCARun(a.db, order.ID, order.Spent)
+	progress := fmt.Sprintf("Run %d, %s of %s %s used.", order.Runs, order.Spent, order.Budget, dcaUnit(order, cfg))
+	if spent.Cmp(budget) >= 0 {
+		database.UpdateDCAOrderStatus(a.db, order.ID, database.DCAStatusActive, database.DCAStatusCompleted)
+		progress += " Budget reached, the schedule is complete."
+	}
+
+	outcome := formatSwapResults(cfg, results)
+	if err != nil {
+		outcome += "❌ " + markdownEscaper.Replace(err.Error())
+	}
+	dcaMsg := fmt.Sprintf(`🔁 DCA %s %s (🔗%s)
+
+%s
+
+%s`, order.Side, markdownEscaper.Replace(quote.Info.Symbol), cfg.Name, progress, outcome)
+	a.client.SendMessage(order.ChatID, dcaMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
+
+// formatDCAInterval prints seconds as the largest whole unit, such as "4h".
+func formatDCAInterval(seconds int) string {
+	d := time.Duration(seconds) * time.Second
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
+
+// parseDCAInterval reads "30m", "4h" or "1d".
+func parseDCAInterval(text string) (time.Duration, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(text)
+	}
+	if err != nil || d < minDCAInterval {
+		return 0, fmt.Errorf("invalid interval %q, use at least 1m", text)
+	}
+	return d, nil
+}
+
+// dcaOrderList describes the chat's schedules for the Pending Orders screen,
+// with their Pause, Resume and Cancel buttons.
+func (a *application) dcaOrderList(chatID string) (string, [][]tbot.InlineKeyboardButton) {
+	orders, err := database.GetChatDCAOrders(a.db, chatID)
+	if err != nil {
+		log.Printf("Error getting DCA orders: %v", err)
+	}
+	if len(orders) == 0 {
+		return "No DCA schedules.\n", nil
+	}
+
+	var list strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, order := range orders {
+		cfg := chainConfigFor(convertChainStatusNameToType(order.Chain))
+		unit := dcaUnit(order, cfg)
+		limit := ""
+		if order.PriceLimit > 0 {
+			limit = fmt.Sprintf(", max $%g", order.PriceLimit)
+			if order.Side == database.TradeSideSell {
+				limit = fmt.Sprintf(", min $%g", order.PriceLimit)
+			}
+		}
+		state := ""
+		if order.Status == database.DCAStatusPaused {
+			state = " ⏸"
+		}
+		list.WriteString(fmt.Sprintf("D%d. DCA %s %s (🔗%s)%s\n   %s %s x %d wallets every %s%s\n   %s of %s %s used in %d runs\n",
+			i+1, order.Side, order.TokenAddress, order.Chain, state,
+			order.Amount, unit, len(order.Wallets), formatDCAInterval(order.Interval), limit,
+			order.Spent, order.Budget, unit, order.Runs))
+
+		toggle := tbot.InlineKeyboardButton{Text: fmt.Sprintf("⏸ Pause D%d", i+1), CallbackData: "dca_pause_" + order.ID.String()}
+		if order.Status == database.DCAStatusPaused {
+			toggle = tbot.InlineKeyboardButton{Text: fmt.Sprintf("▶️ Resume D%d", i+1), CallbackData: "dca_resume_" + order.ID.String()}
+		}
+		buttons = append(buttons, []tbot.InlineKeyboardButton{
+			toggle,
+			{Text: fmt.Sprintf("❌ Cancel D%d", i+1), CallbackData: "dca_cancel_" + order.ID.String()},
+		})
+	}
+	return list.String(), buttons
+}
+
+func (a *application) dcaAddHandler(side string, m *tbot.Message) {
+	a.draftsMu.Lock()
+	if a.dcaDrafts == nil {
+		a.dcaDrafts = make(map[string]string)
+	}
+	a.dcaDrafts[m.Chat.ID] = side
+	a.draftsMu.Unlock()
+
+	amount, budget, limit := "native amount per wallet", "total native budget", "max USD price"
+	example := "0x1234...abcd 4h 0.05 1 $0.002"
+	if side == database.TradeSideSell {
+		amount, budget, limit = "tokens per wallet", "total tokens", "min USD price"
+		example = "0x1234...abcd 30m 100000 2000000"
+	}
+	a.waitingForDCAOrder = true
+	a.client.SendMessage(m.Chat.ID, fmt.Sprintf(`Send the DCA %s as:
+<token address> <interval> <%s> <%s> [%s]
+
+The interval is a number of minutes, hours or days such as 30m,
+4h or 1d. The schedule stops once the budget is used up.
+
+For example: %s`, side, amount, budget, limit, example))
+}
+
+// dcaOrderInputHandler saves the schedule entered after "DCA Buy" or
+// "DCA Sell".
+func (a *application) dcaOrderInputHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	side, ok := a.dcaDrafts[m.Chat.ID]
+	delete(a.dcaDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if !cfg.isEVM() || (!cfg.hasDEX() && !cfg.hasV3()) {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("DCA is not available on %s.", cfg.Name))
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	if (len(fields) != 4 && len(fields) != 5) || !isEVMAddress(fields[0]) {
+		a.client.SendMessage(m.Chat.ID, "Invalid schedule. Expected: <token address> <interval> <amount> <budget> [price]")
+		return
+	}
+	interval, err := parseDCAInterval(fields[1])
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error()+".")
+		return
+	}
+	order := &models.DCAOrder{
+		ChatID:       m.Chat.ID,
+		Chain:        cfg.Name,
+		TokenAddress: common.HexToAddress(fields[0]).Hex(),
+		Side:         side,
+		Amount:       fields[2],
+		Budget:       fields[3],
+		Interval:     int(interval / time.Second),
+	}
+	if len(fields) == 5 {
+		if order.PriceLimit, err = parseCompactNumber(strings.TrimPrefix(fields[4], "$")); err != nil || order.PriceLimit <= 0 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid price %q.", fields[4]))
+			return
+		}
+	}
+
+	if order.Wallets, err = database.GetDefaultWallets(a.db, m.Chat.ID, database.DefaultWalletsManualBuy); err != nil {
+		log.Printf("Error getting manual buy wallets: %v", err)
+	}
+	if len(order.Wallets) == 0 {
+		a.client.SendMessage(m.Chat.ID, "No manual buy wallets selected. Choose them in Settings > Wallets > Default Wallets.")
+		return
+	}
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	quote, err := quoteOrderToken(ctx, client, cfg, common.HexToAddress(order.TokenAddress))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to quote token: "+err.Error())
+		return
+	}
+	if order.PriceLimit > 0 && quote.PriceUSD == nil {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("No USD price is available on %s. Leave out the price limit.", cfg.Name))
+		return
+	}
+	decimals := dcaDecimals(order, quote.Info)
+	amount, err := parseUnits(order.Amount, decimals)
+	if err != nil || amount.Sign() <= 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", order.Amount))
+		return
+	}
+	budget, err := parseUnits(order.Budget, decimals)
+	if err != nil || budget.Cmp(amount) < 0 {
+		a.client.SendMessage(m.Chat.ID, "The budget must be at least the amount per run.")
+		return
+	}
+
+	if err := database.CreateDCAOrder(a.db, order); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save the schedule.")
+		return
+	}
+	a.pendingOrdersHandler(m)
+}
+
+// dcaControlHandler pauses, resumes or cancels one of the chat's schedules.
+// data is "<action>_<id>".
+func (a *application) dcaControlHandler(data string, m *tbot.Message) {
+	action, id, _ := strings.Cut(data, "_")
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("Invalid DCA order id: %s", id)
+		return
+	}
+	orders, err := database.GetChatDCAOrders(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting DCA orders: %v", err)
+		return
+	}
+	for _, order := range orders {
+		if order.ID != orderID {
+			continue
+		}
+		switch action {
+		case "pause":
+			database.UpdateDCAOrderStatus(a.db, orderID, database.DCAStatusActive, database.DCAStatusPaused)
+		case "resume":
+			database.UpdateDCAOrderStatus(a.db, orderID, database.DCAStatusPaused, database.DCAStatusActive)
+		case "cancel":
+			database.UpdateDCAOrderStatus(a.db, orderID, order.Status, database.DCAStatusCancelled)
+		}
+		break
+	}
+	a.pendingOrdersHandler(m)
+}
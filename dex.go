@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const uniswapV2FactoryABIJSON = `[
+	{"constant":true,"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"}],"name":"getPair","outputs":[{"name":"pair","type":"address"}],"type":"function"}
+]`
+
+const uniswapV2PairABIJSON = `[
+	{"constant":true,"inputs":[],"name":"token0","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"getReserves","outputs":[{"name":"reserve0","type":"uint112"},{"name":"reserve1","type":"uint112"},{"name":"blockTimestampLast","type":"uint32"}],"type":"function"}
+]`
+
+const uniswapV2RouterABIJSON = `[
+	{"constant":true,"inputs":[{"name":"amountIn","type":"uint256"},{"name":"path","type":"address[]"}],"name":"getAmountsOut","outputs":[{"name":"amounts","type":"uint256[]"}],"type":"function"},
+	{"inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactETHForTokensSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"payable","type":"function"},
+	{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForETHSupportingFeeOnTransferTokens","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var (
+	uniswapV2FactoryABI = mustParseABI(uniswapV2FactoryABIJSON)
+	uniswapV2PairABI    = mustParseABI(uniswapV2PairABIJSON)
+	uniswapV2RouterABI  = mustParseABI(uniswapV2RouterABIJSON)
+)
+
+var errNoPair = errors.New("no liquidity pair found")
+
+// v2Pair is a token's pool against the chain's wrapped native coin.
+type v2Pair struct {
+	Address       common.Address
+	TokenReserve  *big.Int
+	NativeReserve *big.Int
+}
+
+// findV2Pair looks up the token/wrapped-native pair on the chain's V2 factory
+// and reads its reserves.
+func findV2Pair(ctx context.Context, client *ethclient.Client, cfg chainConfig, token common.Address) (*v2Pair, error) {
+	if !cfg.hasDEX() {
+		return nil, errNoPair
+	}
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	out, err := callContract(ctx, client, common.HexToAddress(cfg.V2Factory), uniswapV2FactoryABI, "getPair", token, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	pairAddress := out[0].(common.Address)
+	if pairAddress == (common.Address{}) {
+		return nil, errNoPair
+	}
+
+	token0, err := callContract(ctx, client, pairAddress, uniswapV2PairABI, "token0")
+	if err != nil {
+		return nil, err
+	}
+	reserves, err := callContract(ctx, client, pairAddress, uniswapV2PairABI, "getReserves")
+	if err != nil {
+		return nil, err
+	}
+
+	pair := &v2Pair{Address: pairAddress}
+	reserve0, reserve1 := reserves[0].(*big.Int), reserves[1].(*big.Int)
+	if token0[0].(common.Address) == token {
+		pair.TokenReserve, pair.NativeReserve = reserve0, reserve1
+	} else {
+		pair.TokenReserve, pair.NativeReserve = reserve1, reserve0
+	}
+	return pair, nil
+}
+
+// priceInNative returns the spot price of one whole token in native coin.
+func (p *v2Pair) priceInNative(tokenDecimals uint8) *big.Float {
+	if p.TokenReserve.Sign() == 0 {
+		return new(big.Float)
+	}
+	native := toDecimal(p.NativeReserve, 18)
+	tokens := toDecimal(p.TokenReserve, tokenDecimals)
+	return new(big.Float).Quo(native, tokens)
+}
+
+// liquidityInNative values both sides of the pool in native coin.
+func (p *v2Pair) liquidityInNative() *big.Float {
+	return new(big.Float).Mul(toDecimal(p.NativeReserve, 18), big.NewFloat(2))
+}
+
+// quoteV2 returns the router's output for amountIn along path.
+func quoteV2(ctx context.Context, client *ethclient.Client, cfg chainConfig, amountIn *big.Int, path []common.Address) (*big.Int, error) {
+	out, err := callContract(ctx, client, common.HexToAddress(cfg.V2Router), uniswapV2RouterABI, "getAmountsOut", amountIn, path)
+	if err != nil {
+		return nil, err
+	}
+	amounts := out[0].([]*big.Int)
+	return amounts[len(amounts)-1], nil
+}
+
+// applySlippage returns the minimum acceptable output for a slippage given in
+// percent.
+func applySlippage(amount *big.Int, slippage int) *big.Int {
+	if slippage < 0 {
+		slippage = 0
+	}
+	if slippage > 100 {
+		slippage = 100
+	}
+	minimum := new(big.Int).Mul(amount, big.NewInt(int64(100-slippage)))
+	return minimum.Div(minimum, big.NewInt(100))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const uniswapV3FactoryABIJSON = `[
+	{"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"fee","type":"uint24"}],"name":"getPool","outputs":[{"name":"pool","type":"address"}],"stateMutability":"view","type":"function"}
+]`
+
+const uniswapV3QuoterABIJSON = `[
+	{"inputs":[{"components":[{"name":"tokenIn","type":"address"},{"name":"tokenOut","type":"address"},{"name":"amountIn","type":"uint256"},{"name":"fee","type":"uint24"},{"name":"sqrtPriceLimitX96","type":"uint160"}],"name":"params","type":"tuple"}],"name":"quoteExactInputSingle","outputs":[{"name":"amountOut","type":"uint256"},{"name":"sqrtPriceX96After","type":"uint160"},{"name":"initializedTicksCrossed","type":"uint32"},{"name":"gasEstimate","type":"uint256"}],"stateMutability":"nonpayable","type":"function"}
+]`
+
+const uniswapV3RouterABIJSON = `[
+	{"inputs":[{"components":[{"name":"tokenIn","type":"address"},{"name":"tokenOut","type":"address"},{"name":"fee","type":"uint24"},{"name":"recipient","type":"address"},{"name":"amountIn","type":"uint256"},{"name":"amountOutMinimum","type":"uint256"},{"name":"sqrtPriceLimitX96","type":"uint160"}],"name":"params","type":"tuple"}],"name":"exactInputSingle","outputs":[{"name":"amountOut","type":"uint256"}],"stateMutability":"payable","type":"function"},
+	{"inputs":[{"name":"amountMinimum","type":"uint256"},{"name":"recipient","type":"address"}],"name":"unwrapWETH9","outputs":[],"stateMutability":"payable","type":"function"},
+	{"inputs":[{"name":"deadline","type":"uint256"},{"name":"data","type":"bytes[]"}],"name":"multicall","outputs":[{"name":"","type":"bytes[]"}],"stateMutability":"payable","type":"function"}
+]`
+
+var (
+	uniswapV3FactoryABI = mustParseABI(uniswapV3FactoryABIJSON)
+	uniswapV3QuoterABI  = mustParseABI(uniswapV3QuoterABIJSON)
+	uniswapV3RouterABI  = mustParseABI(uniswapV3RouterABIJSON)
+)
+
+// v3FeeTiers are the pool fees, in hundredths of a basis point, searched for
+// V3 liquidity.
+var v3FeeTiers = []uint32{100, 500, 3000, 10000}
+
+// v3RouterSelf is SwapRouter02's placeholder for its own address, used to
+// keep swap output in the router until it is unwrapped.
+var v3RouterSelf = common.HexToAddress("0x0000000000000000000000000000000000000002")
+
+type v3QuoteParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	AmountIn          *big.Int
+	Fee               *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+type v3SwapParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	Fee               *big.Int
+	Recipient         common.Address
+	AmountIn          *big.Int
+	AmountOutMinimum  *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+// swapRoute is where a swap is executed and what it is quoted to return.
+type swapRoute struct {
+	Version int
+	Fee     uint32
+	Router  common.Address
+	// Pool is the V3 pool the route swaps through; V2 routes leave it unset.
+	Pool      common.Address
+	AmountOut *big.Int
+}
+
+func (r *swapRoute) String() string {
+	if r.Version == 3 {
+		return fmt.Sprintf("V3 %.2f%%", float64(r.Fee)/10000)
+	}
+	return "V2"
+}
+
+// quoteV3 returns the best single-pool V3 quote across fee tiers, or nil when
+// the pair has no V3 pool.
+func quoteV3(ctx context.Context, client *ethclient.Client, cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int) (*swapRoute, error) {
+	if !cfg.hasV3() {
+		return nil, nil
+	}
+	factory := common.HexToAddress(cfg.V3Factory)
+	quoter := common.HexToAddress(cfg.V3Quoter)
+
+	var best *swapRoute
+	for _, fee := range v3FeeTiers {
+		out, err := callContract(ctx, client, factory, uniswapV3FactoryABI, "getPool", tokenIn, tokenOut, new(big.Int).SetUint64(uint64(fee)))
+		if err != nil {
+			return nil, err
+		}
+		pool := out[0].(common.Address)
+		if pool == (common.Address{}) {
+			continue
+		}
+
+		quote, err := callContract(ctx, client, quoter, uniswapV3QuoterABI, "quoteExactInputSingle", v3QuoteParams{
+			TokenIn:           tokenIn,
+			TokenOut:          tokenOut,
+			AmountIn:          amountIn,
+			Fee:               new(big.Int).SetUint64(uint64(fee)),
+			SqrtPriceLimitX96: new(big.Int),
+		})
+		if err != nil {
+			// Pools without liquidity in range revert the quote.
+			continue
+		}
+		amountOut := quote[0].(*big.Int)
+		if best == nil || amountOut.Cmp(best.AmountOut) > 0 {
+			best = &swapRoute{Version: 3, Fee: fee, Router: common.HexToAddress(cfg.V3Router), Pool: pool, AmountOut: amountOut}
+		}
+	}
+	return best, nil
+}
+
+// errNoRoute is returned when neither V2 nor V3 quotes a swap.
+var errNoRoute = errors.New("no V2 or V3 liquidity found")
+
+// bestRoute quotes amountIn on V2 and across V3 fee tiers and returns the
+// route with the larger output.
+func bestRoute(ctx context.Context, client *ethclient.Client, cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int) (*swapRoute, error) {
+	var best *swapRoute
+	if cfg.hasDEX() {
+		amountOut, err := quoteV2(ctx, client, cfg, amountIn, []common.Address{tokenIn, tokenOut})
+		if err == nil {
+			best = &swapRoute{Version: 2, Router: common.HexToAddress(cfg.V2Router), AmountOut: amountOut}
+		}
+	}
+
+	v3, err := quoteV3(ctx, client, cfg, tokenIn, tokenOut, amountIn)
+	if err != nil {
+		log.Printf("Error quoting V3 for %s: %v", tokenOut.Hex(), err)
+	}
+	if v3 != nil && (best == nil || v3.AmountOut.Cmp(best.AmountOut) > 0) {
+		best = v3
+	}
+
+	if best == nil {
+		return nil, errNoRoute
+	}
+	return best, nil
+}
+
+// bestRouteAfter is bestRoute on top of the pending transaction after, so
+// liquidity the transaction adds is quoted. Without after it is bestRoute.
+func bestRouteAfter(ctx context.Context, client *ethclient.Client, cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int, after *types.Transaction) (*swapRoute, error) {
+	if after == nil {
+		return bestRoute(ctx, client, cfg, tokenIn, tokenOut, amountIn)
+	}
+
+	var routes []*swapRoute
+	if cfg.hasDEX() {
+		routes = append(routes, &swapRoute{Version: 2, Router: common.HexToAddress(cfg.V2Router)})
+	}
+	if cfg.hasV3() {
+		for _, fee := range v3FeeTiers {
+			routes = append(routes, &swapRoute{Version: 3, Fee: fee, Router: common.HexToAddress(cfg.V3Router)})
+		}
+	}
+	// Each route is quoted, and each V3 route's pool looked up, in one
+	// simulation behind after.
+	var calls []simCall
+	for _, route := range routes {
+		to, data, err := route.quoteCall(cfg, tokenIn, tokenOut, amountIn)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, testerCall(to, nil, data))
+		if route.Version == 3 {
+			data, err := uniswapV3FactoryABI.Pack("getPool", tokenIn, tokenOut, new(big.Int).SetUint64(uint64(route.Fee)))
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, testerCall(common.HexToAddress(cfg.V3Factory), nil, data))
+		}
+	}
+	results, err := simulateBehind(ctx, client, nil, after, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *swapRoute
+	for _, route := range routes {
+		quoted := results[0]
+		results = results[1:]
+		if route.Version == 3 {
+			pool, err := uniswapV3FactoryABI.Unpack("getPool", results[0].ReturnData)
+			results = results[1:]
+			if err != nil {
+				continue
+			}
+			route.Pool = pool[0].(common.Address)
+		}
+		// Routes without liquidity revert the quote.
+		if quoted.failed() {
+			continue
+		}
+		if route.AmountOut, err = route.unpackQuote(quoted.ReturnData); err != nil {
+			continue
+		}
+		if best == nil || route.AmountOut.Cmp(best.AmountOut) > 0 {
+			best = route
+		}
+	}
+	if best == nil {
+		return nil, errNoRoute
+	}
+	return best, nil
+}
+
+// buyData encodes a swap of the native coin sent as value for token.
+func (r *swapRoute) buyData(cfg chainConfig, token common.Address, amountIn, minOut *big.Int, recipient common.Address, deadline *big.Int) ([]byte, error) {
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	if r.Version == 2 {
+		return uniswapV2RouterABI.Pack("swapExactETHForTokensSupportingFeeOnTransferTokens", minOut, []common.Address{wrapped, token}, recipient, deadline)
+	}
+
+	swap, err := uniswapV3RouterABI.Pack("exactInputSingle", v3SwapParams{
+		TokenIn:           wrapped,
+		TokenOut:          token,
+		Fee:               new(big.Int).SetUint64(uint64(r.Fee)),
+		Recipient:         recipient,
+		AmountIn:          amountIn,
+		AmountOutMinimum:  minOut,
+		SqrtPriceLimitX96: new(big.Int),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uniswapV3RouterABI.Pack("multicall", deadline, [][]byte{swap})
+}
+
+// sellData encodes a swap of amountIn of token for the native coin.
+func (r *swapRoute) sellData(cfg chainConfig, token common.Address, amountIn, minOut *big.Int, recipient common.Address, deadline *big.Int) ([]byte, error) {
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	if r.Version == 2 {
+		return uniswapV2RouterABI.Pack("swapExactTokensForETHSupportingFeeOnTransferTokens", amountIn, minOut, []common.Address{token, wrapped}, recipient, deadline)
+	}
+
+	swap, err := uniswapV3RouterABI.Pack("exactInputSingle", v3SwapParams{
+		TokenIn:           token,
+		TokenOut:          wrapped,
+		Fee:               new(big.Int).SetUint64(uint64(r.Fee)),
+		Recipient:         v3RouterSelf,
+		AmountIn:          amountIn,
+		AmountOutMinimum:  minOut,
+		SqrtPriceLimitX96: new(big.Int),
+	})
+	if err != nil {
+		return nil, err
+	}
+	unwrap, err := uniswapV3RouterABI.Pack("unwrapWETH9", minOut, recipient)
+	if err != nil {
+		return nil, err
+	}
+	return uniswapV3RouterABI.Pack("multicall", deadline, [][]byte{swap, unwrap})
+}
+
+// quoteCall encodes a quote of amountIn along the route's pool, for use in
+// simulations where the quote must see simulated state.
+func (r *swapRoute) quoteCall(cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int) (common.Address, []byte, error) {
+	if r.Version == 2 {
+		data, err := uniswapV2RouterABI.Pack("getAmountsOut", amountIn, []common.Address{tokenIn, tokenOut})
+		return common.HexToAddress(cfg.V2Router), data, err
+	}
+	data, err := uniswapV3QuoterABI.Pack("quoteExactInputSingle", v3QuoteParams{
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		AmountIn:          amountIn,
+		Fee:               new(big.Int).SetUint64(uint64(r.Fee)),
+		SqrtPriceLimitX96: new(big.Int),
+	})
+	return common.HexToAddress(cfg.V3Quoter), data, err
+}
+
+// unpackQuote decodes the output amount of a quoteCall.
+func (r *swapRoute) unpackQuote(output []byte) (*big.Int, error) {
+	if r.Version == 2 {
+		out, err := uniswapV2RouterABI.Unpack("getAmountsOut", output)
+		if err != nil {
+			return nil, err
+		}
+		amounts := out[0].([]*big.Int)
+		return amounts[len(amounts)-1], nil
+	}
+	out, err := uniswapV3QuoterABI.Unpack("quoteExactInputSingle", output)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// quote returns what amountIn of tokenIn swaps for along the route.
+func (r *swapRoute) quote(ctx context.Context, client *ethclient.Client, cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int) (*big.Int, error) {
+	to, data, err := r.quoteCall(cfg, tokenIn, tokenOut, amountIn)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.unpackQuote(output)
+}
+
+// priceImpact returns how much worse, in percent, the route's quote, made for
+// amountIn, is than the price of a trade a thousand times smaller.
+func (r *swapRoute) priceImpact(ctx context.Context, client *ethclient.Client, cfg chainConfig, tokenIn, tokenOut common.Address, amountIn *big.Int) (float64, error) {
+	probe := new(big.Int).Div(amountIn, big.NewInt(1000))
+	if probe.Sign() == 0 {
+		return 0, nil
+	}
+	probeOut, err := r.quote(ctx, client, cfg, tokenIn, tokenOut, probe)
+	if err != nil {
+		return 0, err
+	}
+	if probeOut.Sign() == 0 {
+		return 0, errors.New("pool returns nothing for a small trade")
+	}
+	spotOut := new(big.Int).Mul(probeOut, big.NewInt(1000))
+	return taxPercent(spotOut, r.AmountOut), nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const erc20ABIJSON = `[
+	{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"type":"function"}
+]`
+
+var erc20ABI = mustParseABI(erc20ABIJSON)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("invalid ABI: %v", err))
+	}
+	return parsed
+}
+
+type tokenInfo struct {
+	Address     common.Address
+	Name        string
+	Symbol      string
+	Decimals    uint8
+	TotalSupply *big.Int
+}
+
+// callContract performs a read-only call against the latest block and unpacks
+// the result.
+func callContract(ctx context.Context, client *ethclient.Client, contract common.Address, parsed abi.ABI, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("%s returned no data", method)
+	}
+	return parsed.Unpack(method, output)
+}
+
+func readTokenInfo(ctx context.Context, client *ethclient.Client, token common.Address) (*tokenInfo, error) {
+	code, err := client.CodeAt(ctx, token, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, errors.New("address is not a contract")
+	}
+
+	info := &tokenInfo{Address: token}
+	decimals, err := callContract(ctx, client, token, erc20ABI, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decimals: %w", err)
+	}
+	info.Decimals = decimals[0].(uint8)
+
+	if symbol, err := callContract(ctx, client, token, erc20ABI, "symbol"); err == nil {
+		info.Symbol = symbol[0].(string)
+	}
+	if name, err := callContract(ctx, client, token, erc20ABI, "name"); err == nil {
+		info.Name = name[0].(string)
+	}
+	if supply, err := callContract(ctx, client, token, erc20ABI, "totalSupply"); err == nil {
+		info.TotalSupply = supply[0].(*big.Int)
+	}
+	if info.Symbol == "" {
+		info.Symbol = shortAddress(token.Hex())
+	}
+	return info, nil
+}
+
+func tokenBalance(ctx context.Context, client *ethclient.Client, token, holder common.Address) (*big.Int, error) {
+	out, err := callContract(ctx, client, token, erc20ABI, "balanceOf", holder)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+type tokenHolding struct {
+	Token   *tokenInfo
+	Balance *big.Int
+}
+
+// walletTokenHoldings returns the non-zero balances of holder among tokens.
+// Tokens that cannot be read are skipped.
+func walletTokenHoldings(ctx context.Context, client *ethclient.Client, tokens []string, holder common.Address) []tokenHolding {
+	var holdings []tokenHolding
+	for _, token := range tokens {
+		address := common.HexToAddress(token)
+		info, err := readTokenInfo(ctx, client, address)
+		if err != nil {
+			log.Printf("Error reading token %s: %v", token, err)
+			continue
+		}
+		balance, err := tokenBalance(ctx, client, address, holder)
+		if err != nil || balance.Sign() == 0 {
+			continue
+		}
+		holdings = append(holdings, tokenHolding{Token: info, Balance: balance})
+	}
+	return holdings
+}
+
+// formatUnits renders a base-unit amount with at most six fractional digits.
+func formatUnits(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return "0"
+	}
+	digits := new(big.Int).Abs(amount).String()
+	d := int(decimals)
+	if len(digits) <= d {
+		digits = strings.Repeat("0", d-len(digits)+1) + digits
+	}
+	intPart := digits[:len(digits)-d]
+	fracPart := digits[len(digits)-d:]
+	if len(fracPart) > 6 {
+		fracPart = fracPart[:6]
+	}
+	fracPart = strings.TrimRight(fracPart, "0")
+
+	result := intPart
+	if fracPart != "" {
+		result += "." + fracPart
+	}
+	if amount.Sign() < 0 {
+		result = "-" + result
+	}
+	return result
+}
+
+// parseUnits converts a decimal string such as "1.5" into base units.
+func parseUnits(value string, decimals uint8) (*big.Int, error) {
+	value = strings.TrimSpace(value)
+	intPart, fracPart, _ := strings.Cut(value, ".")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if len(fracPart) > int(decimals) {
+		return nil, fmt.Errorf("too many decimal places (max %d)", decimals)
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	amount, ok := new(big.Int).SetString(intPart+fracPart+strings.Repeat("0", int(decimals)-len(fracPart)), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+func shortAddress(address string) string {
+	if len(address) <= 10 {
+		return address
+	}
+	return address[:6] + "…" + address[len(address)-4:]
+}
@@ -4,32 +4,13 @@ import (
 
 	// Add this line
 
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 
 	"github.com/l3njo/rochambeau/database"
 	"github.com/yanzay/tbot/v2"
 )
 
-type WormholeRequest struct {
-	FromChain   string `json:"fromChain"`
-	ToChain     string `json:"toChain"`
-	FromToken   string `json:"fromToken"`
-	ToToken     string `json:"toToken"`
-	Amount      string `json:"amount"`
-	FromAddress string `json:"fromAddress"`
-	ToAddress   string `json:"toAddress"`
-}
-
-type WormholeResponse struct {
-	TransactionID string `json:"transactionId"`
-	Status        string `json:"status"`
-}
-
 func makeGeneralButtons() *tbot.InlineKeyboardMarkup {
 	btnGroup1 := []tbot.InlineKeyboardButton{
 		{Text: "🚀 Auto Sniper", CallbackData: "auto_sniper"},
@@ -162,10 +143,11 @@ func makeWalletSettingsButtons() *tbot.InlineKeyboardMarkup {
 func makeTransferButtons() *tbot.InlineKeyboardMarkup {
 	balanceTranferBtn := tbot.InlineKeyboardButton{Text: "🗨️Balance Transfer", CallbackData: "balance_transfer"}
 	tokenTranferBtn := tbot.InlineKeyboardButton{Text: "🏧Token Transfer", CallbackData: "token_transfer"}
+	pendingTransferBtn := tbot.InlineKeyboardButton{Text: "⏳Pending Transactions", CallbackData: "pending_transactions"}
 	cancelTransferBtn := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "transfer_back"}
 
 	// Correctly appending all button groups and close button
-	buttons := [][]tbot.InlineKeyboardButton{{balanceTranferBtn}, {tokenTranferBtn}, {cancelTransferBtn}}
+	buttons := [][]tbot.InlineKeyboardButton{{balanceTranferBtn}, {tokenTranferBtn}, {pendingTransferBtn}, {cancelTransferBtn}}
 	return &tbot.InlineKeyboardMarkup{
 		InlineKeyboard: buttons,
 	}
@@ -195,52 +177,6 @@ func makeDefaultButtons() *tbot.InlineKeyboardMarkup {
 	}
 }
 
-func transferTokensViaWormhole(request WormholeRequest) (string, error) {
-	// Convert the request struct to JSON
-	requestData, err := json.Marshal(request)
-	if err != nil {
-		return "", err
-	}
-
-	// Replace with the actual Wormhole API endpoint
-	apiUrl := "https://api.wormholebridge.com/v1/transfer"
-
-	// Create a new request using http
-	req, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(requestData))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Send the request via a client
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// Unmarshal the response
-	var wormholeResponse WormholeResponse
-	err = json.Unmarshal(body, &wormholeResponse)
-	if err != nil {
-		return "", err
-	}
-
-	// Check for a successful response
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to transfer tokens: %s", resp.Status)
-	}
-
-	return wormholeResponse.TransactionID, nil
-}
-
 func makeReferButtons() *tbot.InlineKeyboardMarkup {
 	btnGroup := []tbot.InlineKeyboardButton{
 		{Text: "Change Referal Wallet", CallbackData: "change_referal_wallet"},
@@ -332,11 +268,21 @@ func makePresetButtons() *tbot.InlineKeyboardMarkup {
 	}
 }
 
-func makeGasPresetButtons() *tbot.InlineKeyboardMarkup {
-	btnGroup := []tbot.InlineKeyboardButton{
-		{Text: "10.00", CallbackData: "new_gas_values1"},
-		{Text: "45.00", CallbackData: "new_gas_values2"},
-		{Text: "50.00", CallbackData: "new_gas_values3"},
+// gasPresetValues maps the gas preset buttons to their price in gwei.
+var gasPresetValues = map[string]float64{
+	"new_gas_values1": 10,
+	"new_gas_values2": 45,
+	"new_gas_values3": 50,
+}
+
+func makeGasPresetButtons(selected float64) *tbot.InlineKeyboardMarkup {
+	var btnGroup []tbot.InlineKeyboardButton
+	for _, data := range []string{"new_gas_values1", "new_gas_values2", "new_gas_values3"} {
+		text := fmt.Sprintf("%.2f", gasPresetValues[data])
+		if gasPresetValues[data] == selected {
+			text = "✅" + text
+		}
+		btnGroup = append(btnGroup, tbot.InlineKeyboardButton{Text: text, CallbackData: data})
 	}
 
 	btnDone := tbot.InlineKeyboardButton{
@@ -375,6 +321,13 @@ result := database.SetDefaultSettings(app.db, &newSettings)
 		log.Printf("Failed to set default settings: %v", result)
 	}
 */
+func toggleLabel(on bool) string {
+	if on {
+		return "🟢"
+	}
+	return "🔴"
+}
+
 func makeDefaultSettingsButtons() *tbot.InlineKeyboardMarkup {
 	newSettings, err := database.GetDefaultSettings(app.db)
 	if err != nil {
@@ -423,20 +376,25 @@ func makeDefaultSettingsButtons() *tbot.InlineKeyboardMarkup {
 	}
 
 	alphaModeBtn := tbot.InlineKeyboardButton{
-		Text:         "Alpha Mode:🔴",
+		Text:         "Alpha Mode:" + toggleLabel(newSettings[0].AlphaMode),
 		CallbackData: "alpha_mode_settings",
 	}
 
 	maxTxOrRevertBtn := tbot.InlineKeyboardButton{
-		Text:         "MaxTx or Revert:🔴",
+		Text:         "MaxTx or Revert:" + toggleLabel(newSettings[0].MultitxOrRevert),
 		CallbackData: "max_tx_or_revert_settings",
 	}
 
 	antiRugBtn := tbot.InlineKeyboardButton{
-		Text:         "AntiRug:🔴",
+		Text:         "AntiRug:" + toggleLabel(newSettings[0].AntiRug),
 		CallbackData: "anti_rug_settings",
 	}
 
+	uncheckedBuysBtn := tbot.InlineKeyboardButton{
+		Text:         "Unchecked Buys:" + toggleLabel(newSettings[0].UncheckedBuys),
+		CallbackData: "unchecked_buys_settings",
+	}
+
 	backDefaultButton := tbot.InlineKeyboardButton{
 		Text:         "Back",
 		CallbackData: "back_default_settings",
@@ -452,6 +410,7 @@ func makeDefaultSettingsButtons() *tbot.InlineKeyboardMarkup {
 		{alphaModeBtn},
 		{maxTxOrRevertBtn},
 		{antiRugBtn},
+		{uncheckedBuysBtn},
 		{backDefaultButton},
 	}
 
@@ -506,105 +465,6 @@ func makeAutoBuyChainButtons() *tbot.InlineKeyboardMarkup {
 	}
 }
 
-func makeAutoEthereumButtons() *tbot.InlineKeyboardMarkup {
-	autoBuyETHSettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_buy_settings"}
-	autoBuyETHBackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuyETHSettingsButton},
-		{autoBuyETHBackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeAutoBSCButtons() *tbot.InlineKeyboardMarkup {
-	autoBuyBSCSettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_BSC_buy_settings"}
-	autoBuyBSCBackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_BSC_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuyBSCSettingsButton},
-		{autoBuyBSCBackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeAutoBLAButtons() *tbot.InlineKeyboardMarkup {
-	autoBuyBLASettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_BLA_buy_settings"}
-	autoBuyBLABackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_BLA_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuyBLASettingsButton},
-		{autoBuyBLABackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeAutoBASButtons() *tbot.InlineKeyboardMarkup {
-	autoBuyBASSettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_BAS_buy_settings"}
-	autoBuyBASBackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_BAS_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuyBASSettingsButton},
-		{autoBuyBASBackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeAutoAVAButtons() *tbot.InlineKeyboardMarkup {
-	autoBuyAVASettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_AVA_buy_settings"}
-	autoBuyAVABackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_AVA_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuyAVASettingsButton},
-		{autoBuyAVABackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeAutoSOLButtons() *tbot.InlineKeyboardMarkup {
-	autoBuySOLSettingsButton := tbot.InlineKeyboardButton{Text: "Auto Buy:Off", CallbackData: "auto_SOL_buy_settings"}
-	autoBuySOLBackButton := tbot.InlineKeyboardButton{Text: "Back", CallbackData: "auto_SOL_buy_back"}
-
-	buttons := [][]tbot.InlineKeyboardButton{
-		{autoBuySOLSettingsButton},
-		{autoBuySOLBackButton},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
-func makeTradeConfirmButtons() *tbot.InlineKeyboardMarkup {
-	btnGroup := []tbot.InlineKeyboardButton{
-		{Text: "On", CallbackData: "new_trade_on"},
-		{Text: "Off🟢", CallbackData: "new_trade_off"},
-	}
-
-	btnCancel := tbot.InlineKeyboardButton{
-		Text:         "Cancel",
-		CallbackData: "cancel_trade_confirm",
-	}
-
-	// Correctly appending all button groups and close button
-	buttons := [][]tbot.InlineKeyboardButton{
-		btnGroup,
-		{btnCancel},
-	}
-	return &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-}
-
 func makeCopyTradingChainButtons() *tbot.InlineKeyboardMarkup {
 	ethereumButton := tbot.InlineKeyboardButton{Text: "ETH", CallbackData: "copy_trading_ehteruem_chain_settings"}
 	bscButton := tbot.InlineKeyboardButton{Text: "BSC", CallbackData: "copy_trading_bsc_chain_settings"}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"crypto/ecdsa"
-	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -14,7 +13,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/gochain/gochain/v4/crypto"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/l3njo/rochambeau/database"
 	"github.com/l3njo/rochambeau/models"
 	"github.com/yanzay/tbot/v2"
@@ -428,7 +427,9 @@ Select the wallets that you want to be preselected when you create a new buy or
 
 }
 
-func (a *application) snipeWalletsSelectHandler(m *tbot.Message) {
+// defaultWalletsSelectHandler lists the wallets with their selection for
+// purpose; tapping a wallet toggles it.
+func (a *application) defaultWalletsSelectHandler(purpose string, m *tbot.Message) {
 	currentChainStatus, err := database.GetChainStatus(a.db)
 	if err != nil {
 		log.Printf("Error getting chain status: %v", err)
@@ -442,6 +443,14 @@ func (a *application) snipeWalletsSelectHandler(m *tbot.Message) {
 		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
 		return
 	}
+	selected, err := database.GetDefaultWallets(a.db, m.Chat.ID, purpose)
+	if err != nil {
+		log.Printf("Error retrieving default wallets: %v", err)
+	}
+	isSelected := make(map[string]bool)
+	for _, address := range selected {
+		isSelected[strings.ToLower(address)] = true
+	}
 
 	walletMsg := fmt.Sprintf(`
 Settings > Wallets (🔗%s) > Default Wallets
@@ -449,18 +458,20 @@ Settings > Wallets (🔗%s) > Default Wallets
 Select the wallets to be preselected and click Done to confirm.
 `, currentChainStatus)
 
-	// Correct approach to create inline keyboard buttons with tbot
-	buttons := make([][]tbot.InlineKeyboardButton, len(wallets))
-	for i := range wallets {
+	buttons := make([][]tbot.InlineKeyboardButton, 0, len(wallets)+1)
+	for i, wallet := range wallets {
 		buttonText := fmt.Sprintf("Wallet %d", i+1)
+		if isSelected[strings.ToLower(wallet.Address)] {
+			buttonText = fmt.Sprintf("✅ Wallet %d", i+1)
+		}
 		button := tbot.InlineKeyboardButton{
 			Text:         buttonText,
-			CallbackData: fmt.Sprintf("wallet_select_%d", i+1),
+			CallbackData: fmt.Sprintf("default_wallet_%s_%d", purpose, i),
 		}
-		buttons[i] = []tbot.InlineKeyboardButton{button}
+		buttons = append(buttons, []tbot.InlineKeyboardButton{button})
 	}
+	buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: "✅Done", CallbackData: "default_wallet"}})
 
-	// Assuming tbot provides a method to create inline keyboard markup directly
 	inlineKeyboardMarkup := &tbot.InlineKeyboardMarkup{
 		InlineKeyboard: buttons,
 	}
@@ -468,6 +479,39 @@ Select the wallets to be preselected and click Done to confirm.
 	a.client.SendMessage(m.Chat.ID, walletMsg, tbot.OptInlineKeyboardMarkup(inlineKeyboardMarkup))
 }
 
+// toggleDefaultWalletHandler handles "<purpose>_<index>" from the default
+// wallets screen.
+func (a *application) toggleDefaultWalletHandler(data string, m *tbot.Message) {
+	separator := strings.LastIndex(data, "_")
+	if separator < 0 {
+		log.Printf("Invalid default wallet callback: %s", data)
+		return
+	}
+	purpose := data[:separator]
+	walletIndex, err := strconv.Atoi(data[separator+1:])
+	if err != nil {
+		log.Printf("Parse error: %v", err)
+		return
+	}
+
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if walletIndex < 0 || walletIndex >= len(wallets) {
+		a.client.SendMessage(m.Chat.ID, "Invalid wallet selection.")
+		return
+	}
+
+	if _, err := database.ToggleDefaultWallet(a.db, m.Chat.ID, purpose, wallets[walletIndex].Address); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to update wallet selection.")
+		return
+	}
+	a.defaultWalletsSelectHandler(purpose, m)
+}
+
 func (a *application) selectFromWalletHandler(m *tbot.Message) {
 	currentChainStatus, err := database.GetChainStatus(a.db)
 	if err != nil {
@@ -508,60 +552,6 @@ Select the wallet you want to transfer from.
 
 }
 
-func (a *application) regenerateWalletButtons(selectedWallets map[int]bool) [][]tbot.InlineKeyboardButton {
-	var buttons [][]tbot.InlineKeyboardButton
-
-	// Assuming you have a list of all wallets
-	for i := range a.allWallets {
-		isSelected := selectedWallets[i]
-		buttonText := fmt.Sprintf("Wallet %d", i+1)
-		if isSelected {
-			buttonText = fmt.Sprintf("[Selected] Wallet %d", i+1)
-		}
-
-		button := tbot.InlineKeyboardButton{
-			Text:         buttonText,
-			CallbackData: fmt.Sprintf("wallet_select_%d", i),
-		}
-		buttons = append(buttons, []tbot.InlineKeyboardButton{button})
-	}
-
-	return buttons
-}
-
-func (a *application) UpdateWalletSelection(db *sql.DB, walletIndex int, m *tbot.Message) {
-	// Assuming db is your database connection and you have a way to update the wallet's selection state
-	// This is a placeholder for whatever logic you need to execute to update the wallet's selection state in your database or application state
-	// For example, you might insert or remove an entry in a table or update a field in a document in your database
-	log.Println("UpdateWalletSelection entered")
-	// Toggle the selection state of the wallet
-
-	if _, exists := a.selectedWalletIndices[walletIndex]; exists {
-		delete(a.selectedWalletIndices, walletIndex)
-	} else {
-		if a.selectedWalletIndices == nil {
-			a.selectedWalletIndices = make(map[int]bool)
-		}
-		a.selectedWalletIndices[walletIndex] = true
-	}
-	log.Printf("State toggled: %+v", a.selectedWalletIndices)
-	// After toggling, regenerate the wallet buttons to reflect the new selection state
-	buttons := a.regenerateWalletButtons(a.selectedWalletIndices)
-
-	log.Printf("Regenerated buttons: %+v", buttons)
-	markup := &tbot.InlineKeyboardMarkup{
-		InlineKeyboard: buttons,
-	}
-
-	if _, err := a.client.SendMessage(m.Chat.ID, "Updated Wallet Selection", tbot.OptInlineKeyboardMarkup(markup)); err != nil {
-		log.Printf("Error sending message with buttons: %v", err)
-	}
-
-	formattedMessage := fmt.Sprintf("Your Wallet %d is set as default.", walletIndex)
-	a.client.SendMessage(m.Chat.ID, formattedMessage)
-	// Here, you would send the updated buttons back to the user, similar to the callbackHandler example provided earlier
-}
-
 func (a *application) handleWalletSelectionForTransfer(walletIndex int, m *tbot.Message) {
 	wallets, err := database.GetAllWallets(a.db)
 	if err != nil {
@@ -605,6 +595,28 @@ Select the wallet you want to transfer to:
 	// For example, prompt the user for the recipient address or confirm the action
 }
 
+// toggleDefaultSettingHandler flips one of the on/off trading defaults and
+// redraws the Defaults screen.
+func (a *application) toggleDefaultSettingHandler(setting string, m *tbot.Message) {
+	settings := a.defaultSettings()
+	switch setting {
+	case "alpha_mode":
+		settings.AlphaMode = !settings.AlphaMode
+	case "multitx_or_revert":
+		settings.MultitxOrRevert = !settings.MultitxOrRevert
+	case "anti_rug":
+		settings.AntiRug = !settings.AntiRug
+	case "unchecked_buys":
+		settings.UncheckedBuys = !settings.UncheckedBuys
+	}
+	if err := database.SetDefaultSettings(a.db, settings); err != nil {
+		log.Printf("Error saving default settings: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to save settings.")
+		return
+	}
+	a.defaultSettingsHandler(m)
+}
+
 func (a *application) defaultSettingsHandler(m *tbot.Message) {
 	status, err := database.GetChainStatus(a.db)
 	if err != nil {
@@ -623,38 +635,6 @@ ___________________________________`, status)
 
 }
 
-func (a *application) handleTokenTransfer(m *tbot.Message) {
-	// Example parameters, replace with actual values from the user input or database
-	fromChain := "POL"
-	toChain := "BSC"
-	fromToken := "USDC"
-	toToken := "USDC"
-	amount := "1"
-	fromAddress := "0x60d64E6F87bdf0FB45e424bf6bBC84b2DA0cfCD7"
-	toAddress := "0xA81AB00dDDD0aD908FF5422bbfcBf6daDacA6F25"
-
-	// Create the request
-	transferRequest := WormholeRequest{
-		FromChain:   fromChain,
-		ToChain:     toChain,
-		FromToken:   fromToken,
-		ToToken:     toToken,
-		Amount:      amount,
-		FromAddress: fromAddress,
-		ToAddress:   toAddress,
-	}
-
-	// Call the transfer function
-	transactionID, err := transferTokensViaWormhole(transferRequest)
-	if err != nil {
-		a.client.SendMessage(m.Chat.ID, "Failed to initiate token transfer: "+err.Error(), nil)
-		return
-	}
-
-	// Send a confirmation message with the transaction ID
-	a.client.SendMessage(m.Chat.ID, "Token transfer initiated. Transaction ID: "+transactionID, nil)
-}
-
 func convertChainStatusNameToType(name string) database.ChainStatusOne {
 	switch name {
 	case "Ethereum":
@@ -731,24 +711,35 @@ func (a *application) gasPresetHandler(m *tbot.Message) {
 		log.Printf("Error getting chain status: %v", err)
 		return // Or handle the error in another way suitable for your application's flow.
 	}
+	cfg := chainConfigFor(currentChainStatus)
+	gasGwei, err := database.GetGasPreset(a.db, m.Chat.ID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting gas preset: %v", err)
+	}
+
 	gasPresetMsg := fmt.Sprintf(`
 	Settings > Presets > Gas (🔗%s)
 
 Click on the buttons below to specify new gas values
 	`, currentChainStatus)
-	inlineKeyboard := makeGasPresetButtons()
+	inlineKeyboard := makeGasPresetButtons(gasGwei)
 
 	a.client.SendMessage(m.Chat.ID, gasPresetMsg, tbot.OptInlineKeyboardMarkup(inlineKeyboard))
 }
-func (a *application) sendCodeSnippet(m *tbot.Message) {
-	code := "my fortuna bot"
-	formattedCode := fmt.Sprintf("```\n%s\n```", code) // Markdown formatting for code block
-	_, err := a.client.SendMessage(m.Chat.ID, formattedCode, tbot.OptParseModeMarkdown)
+
+// setGasPresetHandler saves the chosen gas price for the active chain.
+func (a *application) setGasPresetHandler(gasGwei float64, m *tbot.Message) {
+	cfg, err := a.currentChain()
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if err := database.SetGasPreset(a.db, m.Chat.ID, cfg.Name, gasGwei); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save gas preset.")
+		return
 	}
+	a.gasPresetHandler(m)
 }
-
 func (a *application) presetSettingsHander(m *tbot.Message) {
 	status, err := database.GetChainStatus(a.db)
 	if err != nil {
@@ -875,110 +866,45 @@ Select a preferred language below:
 	a.client.SendMessage(m.Chat.ID, languageMsg, tbot.OptInlineKeyboardMarkup(languageButtons))
 }
 
-func (a *application) autoBuyEthereumHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗ETH)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoEthereumButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) autoBuyBSCHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗BSC)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoBSCButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) autoBuyBLAHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗Blast)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoBLAButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) autoBuyBASHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗Blast)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoBASButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) autoBuyAVAHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗Blast)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoAVAButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) autoBuySOLHandler(m *tbot.Message) {
-	autoBuyMsg := `Settings > Auto Buy (🔗Solana)
-
-Auto Buy will automatically purchase any contract address that
-sent to the bot when this setting is on. Configure the settings 
-below to control how to buy the token.`
-
-	buttons := makeAutoSOLButtons()
-
-	a.client.SendMessage(m.Chat.ID, autoBuyMsg, tbot.OptInlineKeyboardMarkup(buttons))
-
-}
-
-func (a *application) tradeConfirmHandler(m *tbot.Message) {
-	tradeConfirmMsg := `Settings > Trade Confirmation
-
-When on, this option will show an additional confirmation dialog 
-before tokens are bought or sold. This helps to avoid accidental 
-transactions.`
-
-	buttons := makeTradeConfirmButtons()
-
-	a.client.SendMessage(m.Chat.ID, tradeConfirmMsg, tbot.OptInlineKeyboardMarkup(buttons))
-}
-
 func (a *application) callbackHandler(cq *tbot.CallbackQuery) {
 	switch cq.Data {
 	case "auto_sniper":
-		a.sendCodeSnippet(cq.Message)
+		a.autoSniperHandler(cq.Message)
+
+	case "snipe_add":
+		a.snipeAddHandler(cq.Message)
 		// Existing cases...
 	case "manual_buyer":
-		// Existing cases...
+		a.manualBuyerHandler(cq.Message)
 	case "positions_management":
-		// Existing cases...
+		a.positionsHandler(cq.Message)
 	case "copy_trading":
 		a.copyTradingHandler(cq.Message)
+	case "copy_trading_ehteruem_chain_settings":
+		a.copyTradingChainHandler(database.Ethereum, cq.Message)
+	case "copy_trading_bsc_chain_settings":
+		a.copyTradingChainHandler(database.BSC, cq.Message)
+	case "copy_trading_blast_chain_settings":
+		a.copyTradingChainHandler(database.Blast, cq.Message)
+	case "copy_trading_base_chain_settings":
+		a.copyTradingChainHandler(database.Base, cq.Message)
+	case "copy_trading_avax_chain_settings":
+		a.copyTradingChainHandler(database.Avax, cq.Message)
+	case "copy_trading_solana_chain_settings":
+		a.copyTradingChainHandler(database.Solana, cq.Message)
+	case "copy_trading_chain_setting_cancel":
+		a.startHandler(cq.Message)
 		// Existing cases...
 	case "pending_orders":
-		// Existing cases...
+		a.pendingOrdersHandler(cq.Message)
+	case "order_add_buy":
+		a.orderAddHandler(database.TradeSideBuy, cq.Message)
+	case "order_add_sell":
+		a.orderAddHandler(database.TradeSideSell, cq.Message)
+	case "dca_add_buy":
+		a.dcaAddHandler(database.TradeSideBuy, cq.Message)
+	case "dca_add_sell":
+		a.dcaAddHandler(database.TradeSideSell, cq.Message)
 	case "settings_":
 		currentChainStatus, err := database.GetChainStatus(a.db)
 		if err != nil {
@@ -1016,6 +942,12 @@ func (a *application) callbackHandler(cq *tbot.CallbackQuery) {
 	case "gas_preset_buttons":
 		a.gasPresetHandler(cq.Message)
 
+	case "new_gas_values1", "new_gas_values2", "new_gas_values3":
+		a.setGasPresetHandler(gasPresetValues[cq.Data], cq.Message)
+
+	case "confirm_gas_fee":
+		a.presetSettingsHander(cq.Message)
+
 	case "remove_wallets":
 		a.waitingForRemove = true
 		a.walletHandler(cq.Message)
@@ -1049,18 +981,46 @@ func (a *application) callbackHandler(cq *tbot.CallbackQuery) {
 		a.selectFromWalletHandler(cq.Message)
 
 	case "token_transfer":
-		a.selectFromWalletHandler(cq.Message)
+		a.tokenTransferWalletHandler(cq.Message)
+
+	case "token_transfer_paste":
+		a.waitingForTokenContract = true
+		a.client.SendMessage(cq.Message.Chat.ID, "Please paste the token contract address:")
+
+	case "pending_transactions":
+		a.pendingTransactionsHandler(cq.Message)
+
+	case "token_transfer_to_paste":
+		a.waitingForTokenRecipient = true
+		a.client.SendMessage(cq.Message.Chat.ID, "Please paste the destination address:")
 
 	case "snipe_wallets":
-		a.snipeWalletsSelectHandler(cq.Message)
+		a.defaultWalletsSelectHandler(database.DefaultWalletsSnipe, cq.Message)
 
 	case "manual_buy_wallets":
-		a.snipeWalletsSelectHandler(cq.Message)
+		a.defaultWalletsSelectHandler(database.DefaultWalletsManualBuy, cq.Message)
 
 	case "ethereum_bridge":
-		a.handleTokenTransfer(cq.Message)
+		a.bridgeDestinationHandler(database.Ethereum, cq.Message)
+
+	case "avax_bridge":
+		a.bridgeDestinationHandler(database.Avax, cq.Message)
+
+	case "bsc_bridge":
+		a.bridgeDestinationHandler(database.BSC, cq.Message)
+
+	case "base_bridge":
+		a.bridgeDestinationHandler(database.Base, cq.Message)
+
+	case "bridge_paste":
+		a.waitingForBridgeContract = true
+		a.client.SendMessage(cq.Message.Chat.ID, "Please paste the token contract address:")
+
+	case "bridge_confirm":
+		a.bridgeConfirmHandler(cq.Message)
 
 	case "cancel_bridge":
+		a.setBridgeDraft(cq.Message.Chat.ID, nil)
 		a.walletHandler(cq.Message)
 
 	case "wallet_settings":
@@ -1155,6 +1115,18 @@ Enter your wallet address to earn:`
 	case "default_settings":
 		a.defaultSettingsHandler(cq.Message)
 
+	case "alpha_mode_settings":
+		a.toggleDefaultSettingHandler("alpha_mode", cq.Message)
+
+	case "max_tx_or_revert_settings":
+		a.toggleDefaultSettingHandler("multitx_or_revert", cq.Message)
+
+	case "anti_rug_settings":
+		a.toggleDefaultSettingHandler("anti_rug", cq.Message)
+
+	case "unchecked_buys_settings":
+		a.toggleDefaultSettingHandler("unchecked_buys", cq.Message)
+
 	case "buy_preset_buttons":
 		a.defaultPresetBuyHandler(cq.Message)
 
@@ -1162,36 +1134,38 @@ Enter your wallet address to earn:`
 		a.defaultPresetAutoBuyHandler(cq.Message)
 
 	case "auto_buy_ehteruem_chain_settings":
-		a.autoBuyEthereumHandler(cq.Message)
+		a.autoBuyHandler(database.Ethereum, cq.Message)
 
 	case "auto_buy_bsc_chain_settings":
-		a.autoBuyBSCHandler(cq.Message)
+		a.autoBuyHandler(database.BSC, cq.Message)
 
 	case "auto_buy_blast_chain_settings":
-		a.autoBuyBLAHandler(cq.Message)
+		a.autoBuyHandler(database.Blast, cq.Message)
 
 	case "auto_buy_base_chain_settings":
-		a.autoBuyBASHandler(cq.Message)
+		a.autoBuyHandler(database.Base, cq.Message)
 
 	case "auto_buy_avax_chain_settings":
-		a.autoBuyAVAHandler(cq.Message)
+		a.autoBuyHandler(database.Avax, cq.Message)
 
 	case "auto_buy_solana_chain_settings":
-		a.autoBuySOLHandler(cq.Message)
+		a.autoBuyHandler(database.Solana, cq.Message)
 
 	case "trade_confirm_buttons":
 		a.tradeConfirmHandler(cq.Message)
 
+	case "new_trade_on":
+		a.setTradeConfirmationHandler(true, cq.Message)
+
+	case "new_trade_off":
+		a.setTradeConfirmationHandler(false, cq.Message)
+
+	case "cancel_trade_confirm":
+		a.presetSettingsHander(cq.Message)
+
 	default:
-		if strings.HasPrefix(cq.Data, "wallet_select_") {
-			walletIndexStr := strings.TrimPrefix(cq.Data, "wallet_select_")
-			walletIndex, err := strconv.Atoi(walletIndexStr) // Handle both returned values
-			if err != nil {
-				log.Printf("Parse error: %v", err)
-				return
-			}
-			log.Printf("Index: %d", walletIndex) // Confirm index parsing
-			a.UpdateWalletSelection(a.db, walletIndex, cq.Message)
+		if strings.HasPrefix(cq.Data, "default_wallet_") {
+			a.toggleDefaultWalletHandler(strings.TrimPrefix(cq.Data, "default_wallet_"), cq.Message)
 		} else if strings.HasPrefix(cq.Data, "wallet_from_select_") {
 			walletIndexStr := strings.TrimPrefix(cq.Data, "wallet_from_select_")
 			walletIndex, err := strconv.Atoi(walletIndexStr) // Convert the suffix to an integer index
@@ -1210,6 +1184,85 @@ Enter your wallet address to earn:`
 			}
 			log.Printf("Selected wallet index: %d", walletIndex) // Confirm index parsing
 			a.handleWalletAmountToTransfer(walletIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_transfer_from_") {
+			walletIndex, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "token_transfer_from_"))
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				return
+			}
+			a.tokenTransferTokenHandler(walletIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_transfer_token_") {
+			a.tokenTransferSelectToken(strings.TrimPrefix(cq.Data, "token_transfer_token_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_transfer_to_wallet_") {
+			walletIndex, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "token_transfer_to_wallet_"))
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				return
+			}
+			a.tokenTransferToWallet(walletIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_transfer_to_book_") {
+			entryIndex, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "token_transfer_to_book_"))
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				return
+			}
+			a.tokenTransferToAddressBook(entryIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "bridge_from_") {
+			walletIndex, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "bridge_from_"))
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				return
+			}
+			a.bridgeTokenHandler(walletIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "bridge_pick_") {
+			quoteIndex, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "bridge_pick_"))
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				return
+			}
+			a.bridgePickHandler(quoteIndex, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "bridge_token_") {
+			a.bridgeSelectToken(strings.TrimPrefix(cq.Data, "bridge_token_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_buy_") {
+			a.tokenBuyHandler(strings.TrimPrefix(cq.Data, "token_buy_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_sell_") {
+			a.tokenSellHandler(strings.TrimPrefix(cq.Data, "token_sell_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "token_card_") {
+			a.tokenCardHandler(strings.TrimPrefix(cq.Data, "token_card_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "auto_buy_set_") {
+			a.autoBuySettingHandler(strings.TrimPrefix(cq.Data, "auto_buy_set_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "snipe_cancel_") {
+			a.snipeCancelHandler(strings.TrimPrefix(cq.Data, "snipe_cancel_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_chain_") {
+			a.copyTradingChainHandler(convertChainStatusNameToType(strings.TrimPrefix(cq.Data, "copy_chain_")), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_stats_") {
+			a.copyLeaderboardHandler(strings.TrimPrefix(cq.Data, "copy_stats_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_add_") {
+			a.copyTargetAddHandler(strings.TrimPrefix(cq.Data, "copy_add_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_wallets_") {
+			a.defaultWalletsSelectHandler(database.CopyTradeWalletsPurpose(strings.TrimPrefix(cq.Data, "copy_wallets_")), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_target_") {
+			a.copyTargetHandler(strings.TrimPrefix(cq.Data, "copy_target_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "copy_set_") {
+			a.copyTargetSettingHandler(strings.TrimPrefix(cq.Data, "copy_set_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "dca_") {
+			a.dcaControlHandler(strings.TrimPrefix(cq.Data, "dca_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "order_cancel_") {
+			a.orderCancelHandler(strings.TrimPrefix(cq.Data, "order_cancel_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "position_rules_add_") {
+			a.positionRulesAddHandler(strings.TrimPrefix(cq.Data, "position_rules_add_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "position_rules_") {
+			a.positionRulesHandler(strings.TrimPrefix(cq.Data, "position_rules_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "position_sell_") {
+			a.positionSellHandler(strings.TrimPrefix(cq.Data, "position_sell_"), cq.Message)
+		} else if strings.HasPrefix(cq.Data, "trade_ok_") {
+			a.tradeConfirmResponseHandler(strings.TrimPrefix(cq.Data, "trade_ok_"), true, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "trade_no_") {
+			a.tradeConfirmResponseHandler(strings.TrimPrefix(cq.Data, "trade_no_"), false, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "tx_speedup_") {
+			a.replaceTransferHandler(strings.TrimPrefix(cq.Data, "tx_speedup_"), false, cq.Message)
+		} else if strings.HasPrefix(cq.Data, "tx_cancel_") {
+			a.replaceTransferHandler(strings.TrimPrefix(cq.Data, "tx_cancel_"), true, cq.Message)
 		} else {
 			log.Println("Unhandled callback data:", cq.Data)
 		}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// tradingEnableSelectors are owner functions tokens commonly use to open
+// trading after liquidity has been added.
+var tradingEnableSelectors = map[[4]byte]string{}
+
+func init() {
+	for _, signature := range []string{
+		"enableTrading()",
+		"openTrading()",
+		"startTrading()",
+		"activateTrading()",
+		"enableTrade()",
+		"openTrade()",
+		"launch()",
+		"goLive()",
+		"setTradingEnabled(bool)",
+		"setTrading(bool)",
+		"setTradingOpen(bool)",
+		"tradingStatus(bool)",
+		"enableTrading(uint256)",
+	} {
+		tradingEnableSelectors[selector(signature)] = signature
+	}
+}
+
+// enablesTrading reports whether data calls a trading-enable function.
+// Functions taking a bool only count when it is true, so
+// setTradingEnabled(false) does not.
+func enablesTrading(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	signature, ok := tradingEnableSelectors[[4]byte(data[:4])]
+	if !ok {
+		return false
+	}
+	if strings.HasSuffix(signature, "(bool)") {
+		return len(data) >= 36 && new(big.Int).SetBytes(data[4:36]).Cmp(big.NewInt(1)) == 0
+	}
+	return true
+}
+
+// isTradingEnableCall reports whether a pending transaction calls a
+// trading-enable function on any contract.
+func isTradingEnableCall(e *mempoolEvent) bool {
+	return e.Tx.To() != nil && enablesTrading(e.Tx.Data())
+}
+
+// isTradingEnable reports whether tx calls a trading-enable function on
+// token.
+func isTradingEnable(tx *types.Transaction, token common.Address) bool {
+	return tx.To() != nil && *tx.To() == token && enablesTrading(tx.Data())
+}
+
+// tradingLive simulates a small buy of token and reports whether it goes
+// through, which is the case once liquidity is added and trading is open.
+// When after is set the buy is quoted and simulated on top of that pending
+// transaction, so a call that adds liquidity and opens trading at once
+// counts, and a pending transaction that reverts leaves trading closed.
+func tradingLive(ctx context.Context, client *ethclient.Client, cfg chainConfig, token common.Address, after *types.Transaction) (bool, error) {
+	route, err := bestRouteAfter(ctx, client, cfg, common.HexToAddress(cfg.WrappedNative), token, safetyProbeAmount, after)
+	switch {
+	case errors.Is(err, errNoRoute), errors.Is(err, errPendingReverts):
+		return false, nil
+	case err != nil && after == nil:
+		// Quotes against the latest block fail on tokens without a pool.
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+	data, err := route.buyData(cfg, token, safetyProbeAmount, new(big.Int), safetyTester, deadline)
+	if err != nil {
+		return false, err
+	}
+
+	funding := new(big.Int).Add(safetyProbeAmount, big.NewInt(1e18))
+	results, err := simulateBehind(ctx, client, safetyOverrides(funding), after, []simCall{testerCall(route.Router, safetyProbeAmount, data)})
+	switch {
+	case errors.Is(err, errPendingReverts):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return !results[0].failed(), nil
+}
+
+// enabledInBlock reports whether block contains a successful trading-enable
+// call on token. It is the launch signal when the node cannot simulate a
+// probe buy.
+func enabledInBlock(ctx context.Context, client *ethclient.Client, block *types.Block, token common.Address) (bool, error) {
+	for _, tx := range block.Transactions() {
+		if !isTradingEnable(tx, token) {
+			continue
+		}
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return false, err
+		}
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchFees prices a transaction like tx, so a backrun sent with them is
+// ordered right behind it.
+func matchFees(tx *types.Transaction) *feeQuote {
+	if tx.Type() == types.DynamicFeeTxType {
+		return &feeQuote{Dynamic: true, TipCap: tx.GasTipCap(), FeeCap: tx.GasFeeCap()}
+	}
+	return &feeQuote{GasPrice: tx.GasPrice()}
+}
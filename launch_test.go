@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// signPending signs a pending call of signature on the stub router, as the
+// owner of a gated market would send it.
+func signPending(t *testing.T, signature string) *types.Transaction {
+	t.Helper()
+	key, _ := crypto.GenerateKey()
+	data := selector(signature)
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(testChainID)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(testChainID),
+		GasTipCap: big.NewInt(3 * params.GWei),
+		GasFeeCap: big.NewInt(5 * params.GWei),
+		Gas:       100_000,
+		To:        &stubRouter,
+		Data:      data[:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTradingLiveBehindPendingCall(t *testing.T) {
+	market := newStubMarket()
+	market.gated = true
+	chain, client := newTestChain(t, market.alloc(t))
+	chain.simulates = true
+	cfg := market.chain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The router quotes nothing before the pending call, so a token waiting
+	// for liquidity is live only behind a call that opens it.
+	for _, test := range []struct {
+		name  string
+		after *types.Transaction
+		want  bool
+	}{
+		{"latest block", nil, false},
+		{"behind openTrading", signPending(t, "openTrading()"), true},
+		{"behind a reverting call", signPending(t, "enableTrading()"), false},
+	} {
+		live, err := tradingLive(ctx, client, cfg, stubToken, test.after)
+		if err != nil || live != test.want {
+			t.Errorf("%s: live %v, err %v, want %v", test.name, live, err, test.want)
+		}
+	}
+}
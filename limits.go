@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/models"
+)
+
+const tokenLimitsABIJSON = `[
+	{"constant":true,"inputs":[],"name":"_maxTxAmount","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxTxAmount","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxTransactionAmount","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"_maxTxAmountBuy","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxBuyAmount","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"_maxWalletSize","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxWallet","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxWalletSize","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"_maxWalletToken","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"maxWalletAmount","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+var tokenLimitsABI = mustParseABI(tokenLimitsABIJSON)
+
+// Tokens name their limit getters differently; the first one that answers
+// is used.
+var (
+	maxTxGetters     = []string{"_maxTxAmount", "maxTxAmount", "maxTransactionAmount", "_maxTxAmountBuy", "maxBuyAmount"}
+	maxWalletGetters = []string{"_maxWalletSize", "maxWallet", "maxWalletSize", "_maxWalletToken", "maxWalletAmount"}
+)
+
+// limitMarginPercent keeps planned buys this far under a limit so price
+// movement between quote and execution does not push them over.
+const limitMarginPercent = 95
+
+// tradeLimits are a token's per-transaction and per-wallet caps, nil when the
+// token has none.
+type tradeLimits struct {
+	MaxTx     *big.Int
+	MaxWallet *big.Int
+}
+
+func readLimit(ctx context.Context, client *ethclient.Client, token common.Address, getters []string) *big.Int {
+	for _, getter := range getters {
+		out, err := callContract(ctx, client, token, tokenLimitsABI, getter)
+		if err != nil {
+			continue
+		}
+		if limit := out[0].(*big.Int); limit.Sign() > 0 {
+			return limit
+		}
+	}
+	return nil
+}
+
+// readTradeLimits looks up the max-transaction and max-wallet limits of token.
+func readTradeLimits(ctx context.Context, client *ethclient.Client, token common.Address) tradeLimits {
+	return tradeLimits{
+		MaxTx:     readLimit(ctx, client, token, maxTxGetters),
+		MaxWallet: readLimit(ctx, client, token, maxWalletGetters),
+	}
+}
+
+// plannedBuy is one buy transaction of a split buy.
+type plannedBuy struct {
+	Wallet   *models.Wallet
+	AmountIn *big.Int
+}
+
+// planBuys spreads amountIn per wallet over transactions that respect the
+// token's limits, valuing tokens at the rate route quotes for amountIn.
+// Without split the buy must fit the limits unchanged. With split the total
+// is regrouped into max-size transactions across wallets, filling each
+// wallet up to its max-wallet room. Either way nothing is planned when the
+// total cannot be bought within the limits.
+func planBuys(ctx context.Context, client *ethclient.Client, token *tokenInfo, route *swapRoute, amountIn *big.Int, wallets []*models.Wallet, limits tradeLimits, split bool) ([]plannedBuy, error) {
+	var plan []plannedBuy
+	if limits.MaxTx == nil && limits.MaxWallet == nil {
+		for _, wallet := range wallets {
+			plan = append(plan, plannedBuy{Wallet: wallet, AmountIn: amountIn})
+		}
+		return plan, nil
+	}
+	if route.AmountOut.Sign() == 0 {
+		return nil, fmt.Errorf("route quotes no %s for the buy", token.Symbol)
+	}
+
+	// nativeFor converts a token amount, less the margin, to native input.
+	nativeFor := func(tokens *big.Int) *big.Int {
+		native := new(big.Int).Mul(tokens, amountIn)
+		native.Mul(native, big.NewInt(limitMarginPercent))
+		return native.Div(native, new(big.Int).Mul(route.AmountOut, big.NewInt(100)))
+	}
+
+	perTx := amountIn
+	if limits.MaxTx != nil {
+		perTx = nativeFor(limits.MaxTx)
+	}
+	if perTx.Sign() <= 0 {
+		return nil, fmt.Errorf("max transaction of %s %s is too small to buy", formatUnits(limits.MaxTx, token.Decimals), token.Symbol)
+	}
+
+	total := new(big.Int).Mul(amountIn, big.NewInt(int64(len(wallets))))
+	remaining := new(big.Int).Set(total)
+	for _, wallet := range wallets {
+		room := amountIn
+		if split {
+			room = remaining
+		}
+		if limits.MaxWallet != nil {
+			balance, err := tokenBalance(ctx, client, token.Address, common.HexToAddress(wallet.Address))
+			if err != nil {
+				return nil, err
+			}
+			walletRoom := nativeFor(new(big.Int).Sub(limits.MaxWallet, balance))
+			if walletRoom.Cmp(room) < 0 {
+				if !split {
+					return nil, fmt.Errorf("%s would exceed the max wallet of %s %s", shortAddress(wallet.Address), formatUnits(limits.MaxWallet, token.Decimals), token.Symbol)
+				}
+				room = walletRoom
+			}
+		}
+		if !split && room.Cmp(perTx) > 0 {
+			return nil, fmt.Errorf("buy exceeds the max transaction of %s %s", formatUnits(limits.MaxTx, token.Decimals), token.Symbol)
+		}
+
+		for room.Sign() > 0 && remaining.Sign() > 0 {
+			chunk := minBig(minBig(room, perTx), remaining)
+			plan = append(plan, plannedBuy{Wallet: wallet, AmountIn: chunk})
+			room = new(big.Int).Sub(room, chunk)
+			remaining = new(big.Int).Sub(remaining, chunk)
+		}
+	}
+	if remaining.Sign() > 0 {
+		placed := new(big.Int).Sub(total, remaining)
+		return nil, fmt.Errorf("token limits leave room for only %s of the %s requested", formatUnits(placed, 18), formatUnits(total, 18))
+	}
+	return plan, nil
+}
+
+func minBig(x, y *big.Int) *big.Int {
+	if x.Cmp(y) <= 0 {
+		return x
+	}
+	return y
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/joho/godotenv"
 	"github.com/l3njo/rochambeau/database"
 	"github.com/l3njo/rochambeau/models"
@@ -68,11 +71,42 @@ type application struct {
 	waitingForRearrange        bool
 	messageChannel             chan *tbot.Message
 	client                     *tbot.Client
-	selectedWalletIndices      map[int]bool
-	allWallets                 []*Wallet
 	waitingForReferAndEarn     bool
 	waitingChangeReferalWallet bool
 	userLanguage               map[int]string
+	waitingForTokenContract    bool
+	waitingForTokenAmount      bool
+	waitingForTokenRecipient   bool
+	tokenTransfers             map[string]*tokenTransferDraft
+	draftsMu                   sync.Mutex
+	ethClients                 map[string]*ethclient.Client
+	ethClientsMu               sync.Mutex
+	mempools                   map[string]*mempool
+	mempoolsMu                 sync.Mutex
+	nonces                     nonceManager
+	bridges                    []BridgeProvider
+	bridgeDrafts               map[string]*bridgeDraft
+	waitingForBridgeContract   bool
+	waitingForBridgeAmount     bool
+	buyDrafts                  map[string]string
+	waitingForBuyAmount        bool
+	sellDrafts                 map[string]string
+	waitingForSellAmount       bool
+	waitingForSnipeTarget      bool
+	autoBuyEdits               map[string]autoBuyEdit
+	pendingTrades              map[string]*pendingTrade
+	positionLists              map[string][]*position
+	ruleDrafts                 map[string]int
+	waitingForPositionRules    bool
+	orderDrafts                map[string]string
+	waitingForLimitOrder       bool
+	dcaDrafts                  map[string]string
+	waitingForDCAOrder         bool
+	waitingForAutoBuyValue     bool
+	copyTargetDrafts           map[string]string
+	waitingForCopyTarget       bool
+	copyTargetEdits            map[string]copyTargetEdit
+	waitingForCopyTargetValue  bool
 	//balanceMsg     []models.Wallet
 	db *sql.DB
 }
@@ -85,6 +119,9 @@ var (
 
 func init() {
 	app.db = database.ConnectDatabase()
+	if err := database.Migrate(app.db); err != nil {
+		log.Printf("Error migrating database: %v", err)
+	}
 	e := godotenv.Load()
 	if e != nil {
 		log.Println(e)
@@ -100,11 +137,112 @@ func init() {
 }
 
 func main() {
+	bridges, err := bridgeProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure bridges: %v", err)
+	}
+	app.bridges = bridges
+
 	bot.HandleMessage("/start", app.startHandler)
 	bot.HandleCallback(app.callbackHandler)
 
 	bot.HandleMessage("", func(m *tbot.Message) {
 
+		if app.waitingForPositionRules {
+			app.waitingForPositionRules = false
+			app.positionRulesInputHandler(m)
+			return
+		}
+
+		if app.waitingForDCAOrder {
+			app.waitingForDCAOrder = false
+			app.dcaOrderInputHandler(m)
+			return
+		}
+
+		if app.waitingForLimitOrder {
+			app.waitingForLimitOrder = false
+			app.limitOrderInputHandler(m)
+			return
+		}
+
+		if app.waitingForCopyTarget {
+			app.waitingForCopyTarget = false
+			app.copyTargetInputHandler(m)
+			return
+		}
+
+		if app.waitingForCopyTargetValue {
+			app.waitingForCopyTargetValue = false
+			app.copyTargetValueHandler(m)
+			return
+		}
+
+		if app.waitingForAutoBuyValue {
+			app.waitingForAutoBuyValue = false
+			app.autoBuyValueHandler(m)
+			return
+		}
+
+		if app.waitingForSnipeTarget {
+			app.waitingForSnipeTarget = false
+			app.snipeTargetInputHandler(m)
+			return
+		}
+
+		if app.waitingForSellAmount {
+			app.waitingForSellAmount = false
+			app.tokenSellAmountHandler(m)
+			return
+		}
+
+		if app.waitingForBuyAmount {
+			app.waitingForBuyAmount = false
+			app.tokenBuyAmountHandler(m)
+			return
+		}
+
+		if app.waitingForBridgeAmount {
+			app.waitingForBridgeAmount = false
+			app.bridgeAmountHandler(m)
+			return
+		}
+
+		if app.waitingForBridgeContract {
+			app.waitingForBridgeContract = false
+			app.bridgeSelectToken(strings.TrimSpace(m.Text), m)
+			return
+		}
+
+		if app.waitingForTokenRecipient {
+			app.waitingForTokenRecipient = false
+			app.tokenTransferRecipientHandler(m)
+			return
+		}
+
+		if app.waitingForTokenAmount {
+			app.waitingForTokenAmount = false
+			app.tokenTransferAmountHandler(m)
+			return
+		}
+
+		if app.waitingForTokenContract {
+			app.waitingForTokenContract = false
+			app.tokenTransferSelectToken(strings.TrimSpace(m.Text), m)
+			return
+		}
+
+		if !app.waitingForKey && !app.waitingForRemove && !app.waitingForRearrange && !app.waitingForReferAndEarn && !app.waitingChangeReferalWallet {
+			if address := strings.TrimSpace(m.Text); isEVMAddress(address) || isSolanaAddress(address) {
+				// Auto Buy only fires on a pasted address, never on a
+				// card refresh.
+				if card := app.tokenCardHandler(address, m); card != nil {
+					app.autoBuy(card.Chain, card.Info.Address.Hex(), m)
+				}
+				return
+			}
+		}
+
 		if app.waitingForKey {
 			app.waitingForKey = false
 			privateKey := m.Text
@@ -330,5 +468,12 @@ Stats:
 
 	})
 
+	go app.trackTransfers(context.Background())
+	go app.guardAgainstRugs(context.Background())
+	go app.runSniper(context.Background())
+	go app.watchOrders(context.Background())
+	go app.watchDCA(context.Background())
+	go app.watchCopyTargets(context.Background())
+
 	log.Fatal(bot.Start())
 }
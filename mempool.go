@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// mempoolRetryDelay is how long a mempool waits before resubscribing
+	// after its source fails.
+	mempoolRetryDelay = 15 * time.Second
+	// mempoolDedupSize is how many recent transaction hashes are remembered
+	// to drop transactions a source sends twice.
+	mempoolDedupSize = 8192
+	// mempoolBuffer is how many events a slow subscriber may fall behind
+	// before events to it are dropped.
+	mempoolBuffer = 256
+)
+
+const routerSwapABIJSON = `[
+	{"inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactETHForTokens","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactETHForTokensSupportingFeeOnTransferTokens","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountOut","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapETHForExactTokens","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForETH","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForETHSupportingFeeOnTransferTokens","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForTokens","outputs":[],"type":"function"},
+	{"inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"swapExactTokensForTokensSupportingFeeOnTransferTokens","outputs":[],"type":"function"},
+	{"inputs":[{"components":[{"name":"tokenIn","type":"address"},{"name":"tokenOut","type":"address"},{"name":"fee","type":"uint24"},{"name":"recipient","type":"address"},{"name":"amountIn","type":"uint256"},{"name":"amountOutMinimum","type":"uint256"},{"name":"sqrtPriceLimitX96","type":"uint160"}],"name":"params","type":"tuple"}],"name":"exactInputSingle","outputs":[],"type":"function"},
+	{"inputs":[{"components":[{"name":"path","type":"bytes"},{"name":"recipient","type":"address"},{"name":"amountIn","type":"uint256"},{"name":"amountOutMinimum","type":"uint256"}],"name":"params","type":"tuple"}],"name":"exactInput","outputs":[],"type":"function"},
+	{"inputs":[{"name":"deadline","type":"uint256"},{"name":"data","type":"bytes[]"}],"name":"multicall","outputs":[],"type":"function"},
+	{"inputs":[{"name":"data","type":"bytes[]"}],"name":"multicall","outputs":[],"type":"function"}
+]`
+
+var routerSwapABI = mustParseABI(routerSwapABIJSON)
+
+const uniswapV2AddLiquidityABIJSON = `[
+	{"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"amountADesired","type":"uint256"},{"name":"amountBDesired","type":"uint256"},{"name":"amountAMin","type":"uint256"},{"name":"amountBMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"addLiquidity","outputs":[],"type":"function"},
+	{"inputs":[{"name":"token","type":"address"},{"name":"amountTokenDesired","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"name":"addLiquidityETH","outputs":[],"type":"function"}
+]`
+
+const uniswapV2CreatePairABIJSON = `[
+	{"inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"}],"name":"createPair","outputs":[{"name":"pair","type":"address"}],"type":"function"}
+]`
+
+var (
+	uniswapV2AddLiquidityABI = mustParseABI(uniswapV2AddLiquidityABIJSON)
+	uniswapV2CreatePairABI   = mustParseABI(uniswapV2CreatePairABIJSON)
+)
+
+// mempoolKind is what a pending transaction does, as far as its call can be
+// decoded.
+type mempoolKind string
+
+const (
+	mempoolCall            mempoolKind = "call"
+	mempoolSwap            mempoolKind = "swap"
+	mempoolAddLiquidity    mempoolKind = "add_liquidity"
+	mempoolRemoveLiquidity mempoolKind = "remove_liquidity"
+	mempoolCreatePair      mempoolKind = "create_pair"
+)
+
+// callDecoders are the router and factory calls decodeCall knows.
+var callDecoders = []struct {
+	kind   mempoolKind
+	parsed abi.ABI
+}{
+	{mempoolSwap, routerSwapABI},
+	{mempoolAddLiquidity, uniswapV2AddLiquidityABI},
+	{mempoolRemoveLiquidity, uniswapV2LiquidityABI},
+	{mempoolCreatePair, uniswapV2CreatePairABI},
+}
+
+// decodeCall decodes a router or factory call, looking inside multicalls,
+// into its kind, method name and arguments by name. Other calls are
+// mempoolCall with no method.
+func decodeCall(data []byte) (mempoolKind, string, map[string]interface{}) {
+	if len(data) < 4 {
+		return mempoolCall, "", nil
+	}
+	for _, decoder := range callDecoders {
+		method, err := decoder.parsed.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		args := make(map[string]interface{})
+		if err := method.Inputs.UnpackIntoMap(args, data[4:]); err != nil {
+			return mempoolCall, "", nil
+		}
+		if method.RawName != "multicall" {
+			return decoder.kind, method.RawName, args
+		}
+		calls, _ := args["data"].([][]byte)
+		for _, call := range calls {
+			if kind, name, inner := decodeCall(call); kind != mempoolCall {
+				return kind, name, inner
+			}
+		}
+		return mempoolCall, "", nil
+	}
+	return mempoolCall, "", nil
+}
+
+// mempoolEvent is a pending transaction with its call decoded.
+type mempoolEvent struct {
+	Tx     *types.Transaction
+	Kind   mempoolKind
+	Method string
+	Args   map[string]interface{}
+
+	senderOnce sync.Once
+	sender     common.Address
+}
+
+func newMempoolEvent(tx *types.Transaction) *mempoolEvent {
+	e := &mempoolEvent{Tx: tx}
+	e.Kind, e.Method, e.Args = decodeCall(tx.Data())
+	return e
+}
+
+// From recovers the sender of the transaction, or the zero address when the
+// signature is invalid. It is only worked out when first asked for, as most
+// subscribers never need it.
+func (e *mempoolEvent) From() common.Address {
+	e.senderOnce.Do(func() {
+		e.sender, _ = types.Sender(types.LatestSignerForChainID(e.Tx.ChainId()), e.Tx)
+	})
+	return e.sender
+}
+
+// swapLeg returns the token a swap sells, the token it buys and the amount
+// it sells. Native coin is reported as the wrapped native token. Swaps whose
+// amount in is not known up front, such as exact-output and multi-hop V3
+// swaps, are not reported.
+func (e *mempoolEvent) swapLeg() (common.Address, common.Address, *big.Int, bool) {
+	if e.Kind != mempoolSwap {
+		return common.Address{}, common.Address{}, nil, false
+	}
+	if path, ok := e.Args["path"].([]common.Address); ok && len(path) >= 2 {
+		amountIn, ok := e.Args["amountIn"].(*big.Int)
+		if !ok {
+			if e.Method == "swapETHForExactTokens" {
+				return common.Address{}, common.Address{}, nil, false
+			}
+			amountIn = e.Tx.Value()
+		}
+		return path[0], path[len(path)-1], amountIn, true
+	}
+	if e.Method == "exactInputSingle" {
+		params, ok := abi.ConvertType(e.Args["params"], new(v3SwapParams)).(*v3SwapParams)
+		if ok {
+			return params.TokenIn, params.TokenOut, params.AmountIn, true
+		}
+	}
+	return common.Address{}, common.Address{}, nil, false
+}
+
+// mempoolSource streams the pending transactions of one chain until the
+// returned subscription is unsubscribed or fails.
+type mempoolSource interface {
+	subscribe(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error)
+}
+
+// wsMempoolSource subscribes to newPendingTransactions on a websocket
+// endpoint, in full transaction mode where the node supports it and by
+// hash otherwise.
+type wsMempoolSource struct {
+	url string
+}
+
+func (s wsMempoolSource) subscribe(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	client, err := rpc.DialContext(ctx, s.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to websocket: %w", err)
+	}
+
+	sub, err := gethclient.New(client).SubscribeFullPendingTransactions(ctx, ch)
+	if err == nil {
+		return event.NewSubscription(func(quit <-chan struct{}) error {
+			defer client.Close()
+			defer sub.Unsubscribe()
+			select {
+			case <-quit:
+				return nil
+			case err := <-sub.Err():
+				return subscriptionEnded(err)
+			}
+		}), nil
+	}
+
+	hashes := make(chan common.Hash, mempoolBuffer)
+	hashSub, err := gethclient.New(client).SubscribePendingTransactions(ctx, hashes)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to subscribe to pending transactions: %w", err)
+	}
+	lookup := ethclient.NewClient(client)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer client.Close()
+		defer hashSub.Unsubscribe()
+		for {
+			select {
+			case <-quit:
+				return nil
+			case err := <-hashSub.Err():
+				return subscriptionEnded(err)
+			case hash := <-hashes:
+				lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				tx, _, err := lookup.TransactionByHash(lookupCtx, hash)
+				cancel()
+				if err != nil {
+					continue
+				}
+				select {
+				case ch <- tx:
+				case <-quit:
+					return nil
+				}
+			}
+		}
+	}), nil
+}
+
+// fileMempoolSource replays pending transactions from a file holding one
+// JSON transaction per line, such as one written by a mempool recording
+// to <CHAIN>_MEMPOOL_RECORD. It stands in for a node in tests and dry runs.
+// The subscription ends with io.EOF once the file is replayed.
+type fileMempoolSource struct {
+	path string
+	// interval spaces the replayed transactions.
+	interval time.Duration
+}
+
+func (s fileMempoolSource) subscribe(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalJSON(scanner.Bytes()); err != nil {
+				return fmt.Errorf("%s:%d: %w", s.path, line, err)
+			}
+			select {
+			case ch <- tx:
+			case <-quit:
+				return nil
+			}
+			select {
+			case <-time.After(s.interval):
+			case <-quit:
+				return nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}), nil
+}
+
+// mempool fans the deduplicated, decoded pending transactions of one chain
+// out to its subscribers. It only streams from its source while it has
+// subscribers.
+type mempool struct {
+	name   string
+	source mempoolSource
+	// record, when set, is a file every transaction is appended to.
+	record string
+
+	mu     sync.Mutex
+	subs   map[*mempoolSubscriber]bool
+	cancel context.CancelFunc
+	seen   map[common.Hash]bool
+	recent []common.Hash
+	next   int
+}
+
+type mempoolSubscriber struct {
+	events chan *mempoolEvent
+	filter func(*mempoolEvent) bool
+}
+
+// mempool returns the shared mempool of cfg, reading from
+// <CHAIN>_MEMPOOL_FILE when it is set and from the websocket otherwise.
+func (a *application) mempool(cfg chainConfig) (*mempool, error) {
+	a.mempoolsMu.Lock()
+	defer a.mempoolsMu.Unlock()
+
+	if pool, ok := a.mempools[cfg.Name]; ok {
+		return pool, nil
+	}
+	var source mempoolSource
+	switch {
+	case cfg.MempoolFile != "":
+		source = fileMempoolSource{path: cfg.MempoolFile, interval: 100 * time.Millisecond}
+	case cfg.WSURL != "":
+		source = wsMempoolSource{url: cfg.WSURL}
+	default:
+		return nil, fmt.Errorf("set %s_WS_URL to watch the %s mempool", cfg.envPrefix(), cfg.Name)
+	}
+	pool := &mempool{
+		name:   cfg.Name,
+		source: source,
+		record: cfg.MempoolRecord,
+		subs:   make(map[*mempoolSubscriber]bool),
+		seen:   make(map[common.Hash]bool),
+		recent: make([]common.Hash, mempoolDedupSize),
+	}
+	if a.mempools == nil {
+		a.mempools = make(map[string]*mempool)
+	}
+	a.mempools[cfg.Name] = pool
+	return pool, nil
+}
+
+// subscribe delivers the events filter accepts, or every event when filter
+// is nil, until the returned function is called. Events are dropped while
+// the subscriber is mempoolBuffer events behind.
+func (p *mempool) subscribe(filter func(*mempoolEvent) bool) (<-chan *mempoolEvent, func()) {
+	sub := &mempoolSubscriber{events: make(chan *mempoolEvent, mempoolBuffer), filter: filter}
+
+	p.mu.Lock()
+	p.subs[sub] = true
+	if p.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		go p.run(ctx)
+	}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(p.subs, sub)
+			if len(p.subs) == 0 && p.cancel != nil {
+				p.cancel()
+				p.cancel = nil
+			}
+		})
+	}
+}
+
+// run streams from the source, resubscribing when it fails, until ctx is
+// cancelled or a replayed source runs out.
+func (p *mempool) run(ctx context.Context) {
+	var recorder *os.File
+	if p.record != "" {
+		var err error
+		if recorder, err = os.OpenFile(p.record, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+			log.Printf("Error opening %s mempool recording: %v", p.name, err)
+		} else {
+			defer recorder.Close()
+		}
+	}
+
+	for {
+		err := p.stream(ctx, recorder)
+		if errors.Is(err, io.EOF) {
+			log.Printf("%s mempool replay finished", p.name)
+			return
+		}
+		if err != nil {
+			log.Printf("%s mempool stream stopped: %v", p.name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(mempoolRetryDelay):
+		}
+	}
+}
+
+func (p *mempool) stream(ctx context.Context, recorder *os.File) error {
+	txs := make(chan *types.Transaction, mempoolBuffer)
+	sub, err := p.source.subscribe(ctx, txs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			// A source that ran out may still have transactions buffered.
+			for len(txs) > 0 {
+				p.dispatch(<-txs, recorder)
+			}
+			return err
+		case tx := <-txs:
+			p.dispatch(tx, recorder)
+		}
+	}
+}
+
+// dispatch sends tx to the subscribers that want it, unless it was seen
+// recently.
+func (p *mempool) dispatch(tx *types.Transaction, recorder *os.File) {
+	hash := tx.Hash()
+	p.mu.Lock()
+	if p.seen[hash] {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.seen, p.recent[p.next])
+	p.recent[p.next] = hash
+	p.next = (p.next + 1) % len(p.recent)
+	p.seen[hash] = true
+	subs := make([]*mempoolSubscriber, 0, len(p.subs))
+	for sub := range p.subs {
+		subs = append(subs, sub)
+	}
+	p.mu.Unlock()
+
+	if recorder != nil {
+		if data, err := tx.MarshalJSON(); err == nil {
+			recorder.Write(append(data, '\n'))
+		}
+	}
+
+	e := newMempoolEvent(tx)
+	for _, sub := range subs {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// recordMempool writes txs to a file in the format of a mempool recording,
+// with a blank line the replay must skip.
+func recordMempool(t *testing.T, txs ...*types.Transaction) string {
+	t.Helper()
+	var lines bytes.Buffer
+	for i, tx := range txs {
+		data, err := tx.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines.Write(append(data, '\n'))
+		if i == 0 {
+			lines.WriteByte('\n')
+		}
+	}
+	path := filepath.Join(t.TempDir(), "mempool.jsonl")
+	if err := os.WriteFile(path, lines.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMempoolReplaysRecording(t *testing.T) {
+	var (
+		router  = common.HexToAddress("0x00000000000000000000000000000000000000e1")
+		factory = common.HexToAddress("0x00000000000000000000000000000000000000e2")
+		token   = common.HexToAddress("0x00000000000000000000000000000000000000e3")
+		wrapped = common.HexToAddress("0x00000000000000000000000000000000000000e4")
+	)
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	deadline := big.NewInt(time.Now().Add(time.Hour).Unix())
+
+	var nonce uint64
+	sign := func(to common.Address, value *big.Int, parsed abi.ABI, method string, args ...interface{}) *types.Transaction {
+		t.Helper()
+		var data []byte
+		if method != "" {
+			var err error
+			if data, err = parsed.Pack(method, args...); err != nil {
+				t.Fatalf("packing %s: %v", method, err)
+			}
+		}
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1)), &types.DynamicFeeTx{
+			ChainID:   big.NewInt(1),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1e9),
+			GasFeeCap: big.NewInt(3e10),
+			Gas:       300_000,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce++
+		return tx
+	}
+
+	buy := sign(router, big.NewInt(1e17), routerSwapABI, "swapExactETHForTokens", big.NewInt(1), []common.Address{wrapped, token}, from, deadline)
+	liquidity := sign(router, big.NewInt(5e18), uniswapV2AddLiquidityABI, "addLiquidityETH", token, big.NewInt(1e6), big.NewInt(0), big.NewInt(0), from, deadline)
+	single, err := routerSwapABI.Pack("exactInputSingle", v3SwapParams{
+		TokenIn:           token,
+		TokenOut:          wrapped,
+		Fee:               big.NewInt(3000),
+		Recipient:         from,
+		AmountIn:          big.NewInt(1e6),
+		AmountOutMinimum:  big.NewInt(0),
+		SqrtPriceLimitX96: big.NewInt(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multicall := sign(router, nil, routerSwapABI, "multicall", deadline, [][]byte{single})
+	pair := sign(factory, nil, uniswapV2CreatePairABI, "createPair", token, wrapped)
+	transfer := sign(from, big.NewInt(1), abi.ABI{}, "")
+
+	// The buy is recorded twice, as a node resending it would.
+	path := recordMempool(t, buy, liquidity, buy, multicall, pair, transfer)
+	recording := filepath.Join(t.TempDir(), "recorded.jsonl")
+
+	app := &application{}
+	pool, err := app.mempool(chainConfig{Name: "Replay", MempoolFile: path, MempoolRecord: recording})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, stopAll := pool.subscribe(nil)
+	defer stopAll()
+	swaps, stopSwaps := pool.subscribe(func(e *mempoolEvent) bool { return e.Kind == mempoolSwap })
+	defer stopSwaps()
+
+	receive := func(events <-chan *mempoolEvent) *mempoolEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a mempool event")
+			return nil
+		}
+	}
+
+	want := []struct {
+		tx     *types.Transaction
+		kind   mempoolKind
+		method string
+	}{
+		{buy, mempoolSwap, "swapExactETHForTokens"},
+		{liquidity, mempoolAddLiquidity, "addLiquidityETH"},
+		{multicall, mempoolSwap, "exactInputSingle"},
+		{pair, mempoolCreatePair, "createPair"},
+		{transfer, mempoolCall, ""},
+	}
+	for i, w := range want {
+		e := receive(all)
+		if e.Tx.Hash() != w.tx.Hash() {
+			t.Fatalf("event %d is %s, want %s", i, e.Tx.Hash().Hex(), w.tx.Hash().Hex())
+		}
+		if e.Kind != w.kind || e.Method != w.method {
+			t.Errorf("event %d decoded as %s %q, want %s %q", i, e.Kind, e.Method, w.kind, w.method)
+		}
+		if e.From() != from {
+			t.Errorf("event %d sent by %s, want %s", i, e.From().Hex(), from.Hex())
+		}
+	}
+
+	e := receive(swaps)
+	tokenIn, tokenOut, amountIn, ok := e.swapLeg()
+	if e.Tx.Hash() != buy.Hash() || !ok || tokenIn != wrapped || tokenOut != token || amountIn.Cmp(buy.Value()) != 0 {
+		t.Errorf("first swap leg %s → %s for %v, want the buy", tokenIn.Hex(), tokenOut.Hex(), amountIn)
+	}
+	e = receive(swaps)
+	tokenIn, tokenOut, amountIn, ok = e.swapLeg()
+	if e.Tx.Hash() != multicall.Hash() || !ok || tokenIn != token || tokenOut != wrapped || amountIn.Cmp(big.NewInt(1e6)) != 0 {
+		t.Errorf("second swap leg %s → %s for %v, want the V3 sell inside the multicall", tokenIn.Hex(), tokenOut.Hex(), amountIn)
+	}
+
+	// The replay stops at the end of the file instead of starting over,
+	// and the duplicate buy is dropped rather than delivered twice.
+	done := make(chan struct{})
+	go func() {
+		pool.run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(mempoolRetryDelay / 2):
+		t.Fatal("mempool kept streaming after the recording ran out")
+	}
+	select {
+	case e := <-all:
+		t.Errorf("unexpected event %s after the replay", e.Tx.Hash().Hex())
+	case e := <-swaps:
+		t.Errorf("unexpected swap %s after the replay", e.Tx.Hash().Hex())
+	default:
+	}
+
+	recorded, err := os.Open(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorded.Close()
+	var lines int
+	for scanner := bufio.NewScanner(recorded); scanner.Scan(); lines++ {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalJSON(scanner.Bytes()); err != nil || tx.Hash() != want[lines].tx.Hash() {
+			t.Fatalf("recorded line %d does not match the replayed transaction: %v", lines+1, err)
+		}
+	}
+	if lines != len(want) {
+		t.Errorf("recorded %d transactions, want %d", lines, len(want))
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AddressBookEntry struct {
+	ID         uuid.UUID `gorm:"id"`
+	ChatID     string    `gorm:"chat_id"`
+	Label      string    `gorm:"label"`
+	Address    string    `gorm:"address"`
+	Createdate time.Time `gorm:"column:create_date;type:timestamp"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AutoBuyConfig controls buying contract addresses pasted by a chat on one
+// chain. MaxTax and MinLiquidity of 0 use the default settings.
+type AutoBuyConfig struct {
+	ChatID       string    `gorm:"chat_id"`
+	Chain        string    `gorm:"chain"`
+	Enabled      bool      `gorm:"enabled"`
+	Amount       string    `gorm:"amount"`
+	MaxTax       float64   `gorm:"max_tax"`
+	MinLiquidity int       `gorm:"min_liquidity"`
+	UpdatedAt    time.Time `gorm:"column:updated_at;type:timestamp"`
+}
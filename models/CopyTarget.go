@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CopyTarget is a wallet whose swaps a chat mirrors on one chain. Buys spend
+// Ratio times the native amount the target spent when Ratio is set, and the
+// fixed native Amount per wallet otherwise, capped at MaxBuy when it is not
+// empty. Sells sell the same share of the balance the target sold.
+type CopyTarget struct {
+	ID            uuid.UUID `gorm:"id"`
+	ChatID        string    `gorm:"chat_id"`
+	Chain         string    `gorm:"chain"`
+	WalletAddress string    `gorm:"wallet_address"`
+	Amount        string    `gorm:"amount"`
+	Ratio         float64   `gorm:"ratio"`
+	MaxBuy        string    `gorm:"max_buy"`
+	CopySells     bool      `gorm:"copy_sells"`
+	Enabled       bool      `gorm:"enabled"`
+	Createdate    time.Time `gorm:"column:create_date;type:timestamp"`
+	UpdatedAt     time.Time `gorm:"column:updated_at;type:timestamp"`
+}
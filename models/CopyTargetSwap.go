@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CopyTargetSwap is an on-chain swap of a followed wallet, indexed to rate
+// the wallet. NativeAmount is what a buy spent or a sell returned in wei and
+// TokenAmount the tokens bought or sold in base units.
+type CopyTargetSwap struct {
+	Chain         string    `gorm:"chain"`
+	WalletAddress string    `gorm:"wallet_address"`
+	TokenAddress  string    `gorm:"token_address"`
+	Side          string    `gorm:"side"`
+	NativeAmount  string    `gorm:"native_amount"`
+	TokenAmount   string    `gorm:"token_amount"`
+	TxHash        string    `gorm:"tx_hash"`
+	BlockNumber   uint64    `gorm:"block_number"`
+	BlockTime     time.Time `gorm:"column:block_time;type:timestamp"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DCAOrder is a recurring buy or sell of a token. Every Interval seconds it
+// swaps Amount from each wallet until Spent reaches Budget. Amounts are
+// native units for buys and token units for sells. PriceLimit is a USD price
+// per token that buys skip above and sells skip below, or 0 for none.
+type DCAOrder struct {
+	ID           uuid.UUID `gorm:"id"`
+	ChatID       string    `gorm:"chat_id"`
+	Chain        string    `gorm:"chain"`
+	TokenAddress string    `gorm:"token_address"`
+	Side         string    `gorm:"side"`
+	Amount       string    `gorm:"amount"`
+	Budget       string    `gorm:"budget"`
+	Spent        string    `gorm:"spent"`
+	Interval     int       `gorm:"interval_seconds"`
+	PriceLimit   float64   `gorm:"price_limit"`
+	Runs         int       `gorm:"runs"`
+	Wallets      []string  `gorm:"wallets"`
+	Status       string    `gorm:"status"`
+	NextRun      time.Time `gorm:"column:next_run;type:timestamp"`
+	Createdate   time.Time `gorm:"column:create_date;type:timestamp"`
+	UpdatedAt    time.Time `gorm:"column:updated_at;type:timestamp"`
+}
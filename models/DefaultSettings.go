@@ -17,6 +17,7 @@ type DefaultSettings struct {
 	AlphaMode       bool      `gorm:"alpha_mode"`
 	MultitxOrRevert bool      `gorm:"multitx_or_revert"`
 	AntiRug         bool      `gorm:"anti_rug"`
+	UncheckedBuys   bool      `gorm:"unchecked_buys"`
 	Createdate      time.Time `gorm:"column:create_date;type:timestamp"`
 	UpdatedAt       time.Time `gorm:"column:updated_at;type:timestamp"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LimitOrder is a buy or sell to run once a token reaches a target price,
+// market cap or multiple of its price when the order was placed. Amount is
+// the native amount per wallet for buys and the percentage of the balance
+// for sells; EntryPrice is the native price per token when the order was
+// placed, or the position's average entry price for stop-losses and
+// take-profits. PeakPrice is the highest native price a trailing stop has
+// seen, and its Target the percentage drop from it that triggers the sell.
+type LimitOrder struct {
+	ID           uuid.UUID `gorm:"id"`
+	ChatID       string    `gorm:"chat_id"`
+	Chain        string    `gorm:"chain"`
+	TokenAddress string    `gorm:"token_address"`
+	Side         string    `gorm:"side"`
+	Trigger      string    `gorm:"trigger_type"`
+	Target       float64   `gorm:"target"`
+	EntryPrice   float64   `gorm:"entry_price"`
+	PeakPrice    float64   `gorm:"peak_price"`
+	Amount       string    `gorm:"amount"`
+	Wallets      []string  `gorm:"wallets"`
+	Status       string    `gorm:"status"`
+	Createdate   time.Time `gorm:"column:create_date;type:timestamp"`
+	UpdatedAt    time.Time `gorm:"column:updated_at;type:timestamp"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnipeTarget is a token to buy as soon as liquidity is added for it.
+// Amount is the native amount per wallet as entered; GasGwei of 0 uses the
+// chat's gas preset and MaxTax of 0 the default tax limits.
+type SnipeTarget struct {
+	ID           uuid.UUID `gorm:"id"`
+	ChatID       string    `gorm:"chat_id"`
+	Chain        string    `gorm:"chain"`
+	TokenAddress string    `gorm:"token_address"`
+	Amount       string    `gorm:"amount"`
+	GasGwei      float64   `gorm:"gas_gwei"`
+	MaxTax       float64   `gorm:"max_tax"`
+	Wallets      []string  `gorm:"wallets"`
+	Status       string    `gorm:"status"`
+	Createdate   time.Time `gorm:"column:create_date;type:timestamp"`
+	UpdatedAt    time.Time `gorm:"column:updated_at;type:timestamp"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trade is a swap sent from one wallet. Amounts are in base units; until the
+// trade confirms TokenAmount holds the minimum accepted output for buys.
+type Trade struct {
+	ID            uuid.UUID `gorm:"id"`
+	ChatID        string    `gorm:"chat_id"`
+	Chain         string    `gorm:"chain"`
+	WalletAddress string    `gorm:"wallet_address"`
+	TokenAddress  string    `gorm:"token_address"`
+	Side          string    `gorm:"side"`
+	Route         string    `gorm:"route"`
+	NativeAmount  string    `gorm:"native_amount"`
+	TokenAmount   string    `gorm:"token_amount"`
+	TxHash        string    `gorm:"tx_hash"`
+	Status        string    `gorm:"status"`
+	BlockNumber   uint64    `gorm:"block_number"`
+	GasFee        string    `gorm:"gas_fee"`
+	// NativeUSD is the USD price of the native coin when the trade
+	// confirmed, or "" when no price feed was available.
+	NativeUSD  string    `gorm:"native_usd"`
+	Createdate time.Time `gorm:"column:create_date;type:timestamp"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;type:timestamp"`
+}
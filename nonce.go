@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+type nonceKey struct {
+	chain   string
+	address common.Address
+}
+
+type nonceState struct {
+	mu     sync.Mutex
+	synced bool
+	next   uint64
+}
+
+// nonceManager hands out nonces per (chain, address) so transactions sent
+// concurrently from the same wallet do not collide.
+type nonceManager struct {
+	mu     sync.Mutex
+	states map[nonceKey]*nonceState
+}
+
+func (n *nonceManager) state(chain string, address common.Address) *nonceState {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.states == nil {
+		n.states = make(map[nonceKey]*nonceState)
+	}
+	key := nonceKey{chain: chain, address: address}
+	state, ok := n.states[key]
+	if !ok {
+		state = &nonceState{}
+		n.states[key] = state
+	}
+	return state
+}
+
+// reserve returns the next nonce for address. The first reservation, and the
+// first one after a resync, starts from the node's pending nonce.
+func (n *nonceManager) reserve(ctx context.Context, client *ethclient.Client, chain string, address common.Address) (uint64, error) {
+	state := n.state(chain, address)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if !state.synced {
+		pending, err := client.PendingNonceAt(ctx, address)
+		if err != nil {
+			return 0, err
+		}
+		state.next = pending
+		state.synced = true
+	}
+	nonce := state.next
+	state.next++
+	return nonce, nil
+}
+
+// resync forgets the locally tracked nonce so the next reservation reads the
+// pending nonce from the node again.
+func (n *nonceManager) resync(chain string, address common.Address) {
+	state := n.state(chain, address)
+	state.mu.Lock()
+	state.synced = false
+	state.mu.Unlock()
+}
+
+// Replacement transactions must pay at least 10% more than the original; use
+// 12.5% to stay clear of rounding in node implementations.
+var (
+	replacementBumpNumerator   = big.NewInt(1125)
+	replacementBumpDenominator = big.NewInt(1000)
+)
+
+func bumpFee(original, suggested *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(original, replacementBumpNumerator)
+	bumped.Div(bumped, replacementBumpDenominator)
+	if suggested != nil && suggested.Cmp(bumped) > 0 {
+		return new(big.Int).Set(suggested)
+	}
+	return bumped
+}
+
+var errTransactionNotPending = errors.New("transaction is no longer pending")
+
+// replaceTransaction resubmits a stuck transaction with the same nonce and
+// bumped fees. With cancel set, the replacement is an empty transfer to the
+// sender itself, which voids the original.
+func (a *application) replaceTransaction(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, hash common.Hash, cancel bool) (*types.Transaction, error) {
+	original, pending, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transaction: %w", err)
+	}
+	if !pending {
+		return nil, errTransactionNotPending
+	}
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	// to stays nil when the original deploys a contract.
+	to := original.To()
+	value := original.Value()
+	data := original.Data()
+	gas := original.Gas()
+	if cancel {
+		to = &from
+		value = new(big.Int)
+		data = nil
+		gas = 21000
+	}
+
+	suggested, err := suggestFees(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var txData types.TxData
+	if original.Type() == types.DynamicFeeTxType {
+		tip := bumpFee(original.GasTipCap(), suggested.TipCap)
+		feeCap := bumpFee(original.GasFeeCap(), suggested.FeeCap)
+		if feeCap.Cmp(tip) < 0 {
+			feeCap = new(big.Int).Set(tip)
+		}
+		txData = &types.DynamicFeeTx{
+			ChainID:   cfg.chainID(),
+			Nonce:     original.Nonce(),
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       gas,
+			To:        to,
+			Value:     value,
+			Data:      data,
+		}
+	} else {
+		txData = &types.LegacyTx{
+			Nonce:    original.Nonce(),
+			GasPrice: bumpFee(original.GasPrice(), suggested.GasPrice),
+			Gas:      gas,
+			To:       to,
+			Value:    value,
+			Data:     data,
+		}
+	}
+	return a.signAndSend(ctx, client, cfg, key, txData)
+}
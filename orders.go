@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	// orderPollInterval is how often open orders are checked against the
+	// current prices.
+	orderPollInterval = 15 * time.Second
+	// orderTimeout bounds the swaps of one filled order.
+	orderTimeout = 2 * time.Minute
+)
+
+// orderQuote is the market of a token that orders are checked against. USD
+// fields are nil when the chain has no USD price feed.
+type orderQuote struct {
+	Info         *tokenInfo
+	PriceNative  *big.Float
+	PriceUSD     *big.Float
+	MarketCapUSD *big.Float
+}
+
+func quoteOrderToken(ctx context.Context, client *ethclient.Client, cfg chainConfig, token common.Address) (*orderQuote, error) {
+	info, err := readTokenInfo(ctx, client, token)
+	if err != nil {
+		return nil, err
+	}
+	price, err := tokenNativePrice(ctx, client, cfg, info)
+	if err != nil {
+		return nil, err
+	}
+	quote := &orderQuote{Info: info, PriceNative: price}
+	if nativeUSD, err := nativeUSDPrice(ctx, client, cfg); err == nil {
+		quote.PriceUSD = new(big.Float).Mul(price, nativeUSD)
+		if info.TotalSupply != nil {
+			quote.MarketCapUSD = new(big.Float).Mul(quote.PriceUSD, toDecimal(info.TotalSupply, info.Decimals))
+		}
+	}
+	return quote, nil
+}
+
+// metric returns the value order's trigger compares against its target.
+func (q *orderQuote) metric(order *models.LimitOrder) (float64, bool) {
+	var value *big.Float
+	switch order.Trigger {
+	case database.OrderTriggerPrice:
+		value = q.PriceUSD
+	case database.OrderTriggerMarketCap:
+		value = q.MarketCapUSD
+	case database.OrderTriggerMultiplier, database.OrderTriggerTakeProfit, database.OrderTriggerStopLoss:
+		if order.EntryPrice > 0 {
+			value = new(big.Float).Quo(q.PriceNative, big.NewFloat(order.EntryPrice))
+		}
+	}
+	if value == nil {
+		return 0, false
+	}
+	v, _ := value.Float64()
+	return v, true
+}
+
+// triggered reports whether order should fill at q: buys and stop-losses
+// fill at or below their target, other sells at or above it, and trailing
+// stops once the price is Target percent below its peak.
+func (q *orderQuote) triggered(order *models.LimitOrder) bool {
+	if order.Trigger == database.OrderTriggerTrailing {
+		price, _ := q.PriceNative.Float64()
+		return order.PeakPrice > 0 && price <= order.PeakPrice*(1-order.Target/100)
+	}
+	value, ok := q.metric(order)
+	if !ok {
+		return false
+	}
+	if order.Side == database.TradeSideBuy || order.Trigger == database.OrderTriggerStopLoss {
+		return value <= order.Target
+	}
+	return value >= order.Target
+}
+
+// trackPeak raises the peak of a trailing stop to the price in q.
+func (a *application) trackPeak(order *models.LimitOrder, q *orderQuote) {
+	price, _ := q.PriceNative.Float64()
+	if order.Trigger != database.OrderTriggerTrailing || price <= order.PeakPrice {
+		return
+	}
+	if err := database.UpdateLimitOrderPeak(a.db, order.ID, price); err == nil {
+		order.PeakPrice = price
+	}
+}
+
+// parseOrderTrigger reads "2x" as a multiplier, "mc250k" as a market cap
+// and "$0.0012" or "0.0012" as a price.
+func parseOrderTrigger(text string) (string, float64, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	trigger := database.OrderTriggerPrice
+	switch {
+	case strings.HasSuffix(text, "x"):
+		trigger, text = database.OrderTriggerMultiplier, strings.TrimSuffix(text, "x")
+	case strings.HasPrefix(text, "mc"):
+		trigger, text = database.OrderTriggerMarketCap, strings.TrimPrefix(text, "mc")
+	}
+	target, err := parseCompactNumber(strings.TrimPrefix(text, "$"))
+	if err != nil || target <= 0 {
+		return "", 0, fmt.Errorf("invalid trigger %q", text)
+	}
+	return trigger, target, nil
+}
+
+// parseCompactNumber reads numbers with an optional K, M or B suffix.
+func parseCompactNumber(text string) (float64, error) {
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(text, "k"):
+		scale, text = 1e3, strings.TrimSuffix(text, "k")
+	case strings.HasSuffix(text, "m"):
+		scale, text = 1e6, strings.TrimSuffix(text, "m")
+	case strings.HasSuffix(text, "b"):
+		scale, text = 1e9, strings.TrimSuffix(text, "b")
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	return value * scale, err
+}
+
+func formatOrderTrigger(order *models.LimitOrder) string {
+	switch order.Trigger {
+	case database.OrderTriggerMarketCap:
+		return "MC " + formatUSD(big.NewFloat(order.Target))
+	case database.OrderTriggerMultiplier:
+		return fmt.Sprintf("%.2fx", order.Target)
+	case database.OrderTriggerTakeProfit:
+		return fmt.Sprintf("take-profit %.2fx", order.Target)
+	case database.OrderTriggerStopLoss:
+		return fmt.Sprintf("stop-loss %.2fx", order.Target)
+	case database.OrderTriggerTrailing:
+		return fmt.Sprintf("trailing stop %.1f%% below peak", order.Target)
+	}
+	return formatUSD(big.NewFloat(order.Target))
+}
+
+// orderTitle heads the notification of a filled order.
+func orderTitle(order *models.LimitOrder) string {
+	switch order.Trigger {
+	case database.OrderTriggerTakeProfit:
+		return "🎯 Take-profit"
+	case database.OrderTriggerStopLoss:
+		return "🛑 Stop-loss"
+	case database.OrderTriggerTrailing:
+		return "📉 Trailing stop"
+	}
+	return "🔀 Limit " + order.Side
+}
+
+// watchOrders fills open orders whose trigger is reached until ctx is
+// cancelled.
+func (a *application) watchOrders(ctx context.Context) {
+	ticker := time.NewTicker(orderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkOrders(ctx)
+		}
+	}
+}
+
+func (a *application) checkOrders(ctx context.Context) {
+	orders, err := database.GetOpenLimitOrders(a.db)
+	if err != nil {
+		log.Printf("Error retrieving limit orders: %v", err)
+		return
+	}
+
+	// Each token is quoted once per round however many orders it has, and
+	// its triggered orders fill one after another so sells of the same
+	// balance do not race.
+	quotes := make(map[string]*orderQuote)
+	triggered := make(map[string][]*models.LimitOrder)
+	var keys []string
+	for _, order := range orders {
+		cfg := chainConfigFor(convertChainStatusNameToType(order.Chain))
+		key := order.Chain + order.TokenAddress
+		quote, quoted := quotes[key]
+		if !quoted {
+			client, err := a.ethClient(cfg)
+			if err != nil {
+				log.Printf("Error connecting to %s: %v", cfg.Name, err)
+				continue
+			}
+			quoteCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			quote, err = quoteOrderToken(quoteCtx, client, cfg, common.HexToAddress(order.TokenAddress))
+			cancel()
+			if err != nil {
+				log.Printf("Error quoting %s for limit orders: %v", order.TokenAddress, err)
+			}
+			quotes[key] = quote
+		}
+		if quote == nil {
+			continue
+		}
+		a.trackPeak(order, quote)
+		if !quote.triggered(order) {
+			continue
+		}
+
+		// Claiming the order first keeps a slow swap from filling it twice.
+		if claimed, _ := database.UpdateLimitOrderStatus(a.db, order.ID, database.OrderStatusOpen, database.OrderStatusFilled); !claimed {
+			continue
+		}
+		if len(triggered[key]) == 0 {
+			keys = append(keys, key)
+		}
+		triggered[key] = append(triggered[key], order)
+	}
+
+	for _, key := range keys {
+		go func(orders []*models.LimitOrder, info *tokenInfo) {
+			for _, order := range orders {
+				a.executeOrder(chainConfigFor(convertChainStatusNameToType(order.Chain)), order, info)
+			}
+		}(triggered[key], quotes[key].Info)
+	}
+}
+
+// executeOrder runs a triggered order through the swap engine and reports to
+// its chat.
+func (a *application) executeOrder(cfg chainConfig, order *models.LimitOrder, info *tokenInfo) {
+	ctx, cancel := context.WithTimeout(context.Background(), orderTimeout)
+	defer cancel()
+
+	var results []swapResult
+	wallets := a.walletsByAddress(order.Wallets)
+	err := errors.New("none of the order's wallets exist any more")
+	if len(wallets) > 0 {
+		results, err = a.fillOrder(ctx, cfg, order, info, wallets)
+	}
+	if err == nil && !anySucceeded(results) {
+		err = errors.New("no swap was sent")
+	}
+	if err != nil {
+		database.UpdateLimitOrderStatus(a.db, order.ID, database.OrderStatusFilled, database.OrderStatusFailed)
+	} else if order.Side == database.TradeSideSell && order.Amount == "100" {
+		database.CancelSiblingOrders(a.db, order)
+	}
+
+	outcome := formatSwapResults(cfg, results)
+	if err != nil {
+		outcome += "❌ " + markdownEscaper.Replace(err.Error())
+	}
+	orderMsg := fmt.Sprintf(`%s %s (🔗%s)
+
+%s reached, selling %s%% of the balance.
+
+%s`, orderTitle(order), markdownEscaper.Replace(info.Symbol), cfg.Name, formatOrderTrigger(order), order.Amount, outcome)
+	if order.Side == database.TradeSideBuy {
+		orderMsg = fmt.Sprintf(`%s %s (🔗%s)
+
+%s reached, buying %s %s per wallet.
+
+%s`, orderTitle(order), markdownEscaper.Replace(info.Symbol), cfg.Name, formatOrderTrigger(order), order.Amount, cfg.NativeSymbol, outcome)
+	}
+
+	a.client.SendMessage(order.ChatID, orderMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
+
+func (a *application) fillOrder(ctx context.Context, cfg chainConfig, order *models.LimitOrder, info *tokenInfo, wallets []*models.Wallet) ([]swapResult, error) {
+	if order.Side == database.TradeSideBuy {
+		amountIn, err := parseUnits(order.Amount, 18)
+		if err != nil {
+			return nil, err
+		}
+		results, _, err := a.buyToken(ctx, cfg, order.ChatID, info, amountIn, wallets, buyOptions{})
+		return results, err
+	}
+	percent, err := strconv.Atoi(order.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return a.sellToken(ctx, cfg, order.ChatID, info, sellSpec{Percent: percent}, wallets)
+}
+
+func (a *application) pendingOrdersHandler(m *tbot.Message) {
+	orders, err := database.GetChatLimitOrders(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting limit orders: %v", err)
+	}
+
+	var orderList strings.Builder
+	var cancelButtons [][]tbot.InlineKeyboardButton
+	for i, order := range orders {
+		cfg := chainConfigFor(convertChainStatusNameToType(order.Chain))
+		amount := fmt.Sprintf("%s%% of balance", order.Amount)
+		if order.Side == database.TradeSideBuy {
+			amount = fmt.Sprintf("%s %s x %d wallets", order.Amount, cfg.NativeSymbol, len(order.Wallets))
+		}
+		orderList.WriteString(fmt.Sprintf("%d. %s %s (🔗%s)\n   at %s, %s\n",
+			i+1, strings.ToUpper(order.Side[:1])+order.Side[1:], order.TokenAddress, order.Chain, formatOrderTrigger(order), amount))
+		cancelButtons = append(cancelButtons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("❌ Cancel %d", i+1), CallbackData: "order_cancel_" + order.ID.String()},
+		})
+	}
+	if len(orders) == 0 {
+		orderList.WriteString("No pending orders.\n")
+	}
+
+	dcaList, dcaButtons := a.dcaOrderList(m.Chat.ID)
+
+	ordersMsg := fmt.Sprintf(`🔀 Pending Orders
+
+Limit buys fill at or below their target and limit sells at or
+above it. Buys and DCA schedules use your manual buy wallets.
+
+Orders:
+%s
+DCA:
+%s`, orderList.String(), dcaList)
+
+	buttons := append(append(cancelButtons, dcaButtons...),
+		[]tbot.InlineKeyboardButton{
+			{Text: "➕ Limit Buy", CallbackData: "order_add_buy"},
+			{Text: "➕ Limit Sell", CallbackData: "order_add_sell"},
+		},
+		[]tbot.InlineKeyboardButton{
+			{Text: "➕ DCA Buy", CallbackData: "dca_add_buy"},
+			{Text: "➕ DCA Sell", CallbackData: "dca_add_sell"},
+		},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "back_to_mainboard"}},
+	)
+	a.client.SendMessage(m.Chat.ID, ordersMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) orderAddHandler(side string, m *tbot.Message) {
+	a.draftsMu.Lock()
+	if a.orderDrafts == nil {
+		a.orderDrafts = make(map[string]string)
+	}
+	a.orderDrafts[m.Chat.ID] = side
+	a.draftsMu.Unlock()
+
+	amount := "amount per wallet"
+	example := "0x1234...abcd $0.0012 0.1"
+	if side == database.TradeSideSell {
+		amount = "percent of balance"
+		example = "0x1234...abcd 2x 50%"
+	}
+	a.waitingForLimitOrder = true
+	a.client.SendMessage(m.Chat.ID, fmt.Sprintf(`Send the limit %s as:
+<token address> <trigger> <%s>
+
+The trigger is a USD price such as $0.0012, a market cap such as
+mc250k, or a multiple of the current price such as 2x.
+
+For example: %s`, side, amount, example))
+}
+
+// limitOrderInputHandler places the order entered after "Limit Buy" or
+// "Limit Sell".
+func (a *application) limitOrderInputHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	side, ok := a.orderDrafts[m.Chat.ID]
+	delete(a.orderDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if !cfg.isEVM() || (!cfg.hasDEX() && !cfg.hasV3()) {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Limit orders are not available on %s.", cfg.Name))
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	if len(fields) != 3 || !isEVMAddress(fields[0]) {
+		a.client.SendMessage(m.Chat.ID, "Invalid order. Expected: <token address> <trigger> <amount>")
+		return
+	}
+	order := &models.LimitOrder{
+		ChatID:       m.Chat.ID,
+		Chain:        cfg.Name,
+		TokenAddress: common.HexToAddress(fields[0]).Hex(),
+		Side:         side,
+	}
+	if order.Trigger, order.Target, err = parseOrderTrigger(fields[1]); err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error()+".")
+		return
+	}
+
+	if side == database.TradeSideBuy {
+		if amount, err := parseUnits(fields[2], 18); err != nil || amount.Sign() <= 0 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", fields[2]))
+			return
+		}
+		order.Amount = fields[2]
+		if order.Wallets, err = database.GetDefaultWallets(a.db, m.Chat.ID, database.DefaultWalletsManualBuy); err != nil {
+			log.Printf("Error getting manual buy wallets: %v", err)
+		}
+		if len(order.Wallets) == 0 {
+			a.client.SendMessage(m.Chat.ID, "No manual buy wallets selected. Choose them in Settings > Wallets > Default Wallets.")
+			return
+		}
+	} else {
+		spec, err := parseSellSpec(fields[2], 0, true)
+		if err != nil {
+			a.client.SendMessage(m.Chat.ID, "Invalid amount: "+err.Error())
+			return
+		}
+		order.Amount = strconv.Itoa(spec.Percent)
+		wallets, err := database.GetAllWallets(a.db)
+		if err != nil {
+			log.Printf("Error retrieving wallets: %v", err)
+			a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+			return
+		}
+		for _, wallet := range wallets {
+			order.Wallets = append(order.Wallets, wallet.Address)
+		}
+	}
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	quote, err := quoteOrderToken(ctx, client, cfg, common.HexToAddress(order.TokenAddress))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to quote token: "+err.Error())
+		return
+	}
+	order.EntryPrice, _ = quote.PriceNative.Float64()
+	value, ok := quote.metric(order)
+	if !ok {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("No USD price is available on %s. Use a multiplier such as 2x instead.", cfg.Name))
+		return
+	}
+	// An order whose target the market has already reached would fill on
+	// the next poll as a plain market order.
+	if quote.triggered(order) {
+		current := *order
+		current.Target = value
+		direction := "above"
+		if side == database.TradeSideBuy {
+			direction = "below"
+		}
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("The market is already at %s, so this order would fill right away. Set a limit %s target %s the current market.",
+			formatOrderTrigger(&current), side, direction))
+		return
+	}
+
+	if err := database.CreateLimitOrder(a.db, order); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save the order.")
+		return
+	}
+	a.pendingOrdersHandler(m)
+}
+
+// orderCancelHandler cancels one of the chat's open orders by ID.
+func (a *application) orderCancelHandler(id string, m *tbot.Message) {
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("Invalid limit order id: %s", id)
+		return
+	}
+	orders, err := database.GetChatLimitOrders(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting limit orders: %v", err)
+		return
+	}
+	for _, order := range orders {
+		if order.ID != orderID {
+			continue
+		}
+		if cancelled, _ := database.UpdateLimitOrderStatus(a.db, orderID, database.OrderStatusOpen, database.OrderStatusCancelled); !cancelled {
+			a.client.SendMessage(m.Chat.ID, "That order has already filled.")
+		}
+		break
+	}
+	a.pendingOrdersHandler(m)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// lpBurnAddresses hold LP tokens that can never be withdrawn.
+var lpBurnAddresses = []common.Address{
+	common.HexToAddress("0x0000000000000000000000000000000000000000"),
+	common.HexToAddress("0x000000000000000000000000000000000000dEaD"),
+}
+
+const (
+	// minBurnedLPPercent is the share of LP tokens that must be burned for
+	// the liquidity to count as locked.
+	minBurnedLPPercent = 50
+	// maxOwnerLPPercent is the share of LP tokens the token owner may hold
+	// before it is flagged.
+	maxOwnerLPPercent = 10
+	// minPoolSupplyPercent is the share of total supply below which a pool is
+	// considered lopsided.
+	minPoolSupplyPercent = 1
+)
+
+// poolHealth describes the pool a buy would trade against.
+type poolHealth struct {
+	Pool          common.Address
+	NativeReserve *big.Int
+	TokenReserve  *big.Int
+	// PairedUSD is the USD value of the native side of the pool, or nil when
+	// no native price is available.
+	PairedUSD *big.Float
+	Warnings  []string
+}
+
+// checkPool reads the reserves of the pool route trades through, values its
+// native side in USD and collects warnings about the liquidity.
+func checkPool(ctx context.Context, client *ethclient.Client, cfg chainConfig, token *tokenInfo, route *swapRoute) (*poolHealth, error) {
+	health := &poolHealth{}
+	if route.Version == 2 {
+		pair, err := findV2Pair(ctx, client, cfg, token.Address)
+		if err != nil {
+			return nil, err
+		}
+		health.Pool, health.NativeReserve, health.TokenReserve = pair.Address, pair.NativeReserve, pair.TokenReserve
+		if err := health.checkLP(ctx, client, token.Address); err != nil {
+			log.Printf("Error reading LP holders of %s: %v", pair.Address.Hex(), err)
+		}
+	} else {
+		var err error
+		health.Pool = route.Pool
+		if health.NativeReserve, err = tokenBalance(ctx, client, common.HexToAddress(cfg.WrappedNative), route.Pool); err != nil {
+			return nil, err
+		}
+		if health.TokenReserve, err = tokenBalance(ctx, client, token.Address, route.Pool); err != nil {
+			return nil, err
+		}
+	}
+	health.assess(ctx, client, cfg, token)
+	return health, nil
+}
+
+// checkPoolAfter is checkPool on top of the pending transaction after, so a
+// pool the transaction funds is read as it will be. The pool's balances stand
+// in for its reserves, which match once liquidity is minted, and LP holders
+// are not checked. Without after it is checkPool.
+func checkPoolAfter(ctx context.Context, client *ethclient.Client, cfg chainConfig, token *tokenInfo, route *swapRoute, after *types.Transaction) (*poolHealth, error) {
+	if after == nil {
+		return checkPool(ctx, client, cfg, token, route)
+	}
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	health := &poolHealth{Pool: route.Pool}
+	if route.Version == 2 {
+		data, err := uniswapV2FactoryABI.Pack("getPair", token.Address, wrapped)
+		if err != nil {
+			return nil, err
+		}
+		results, err := simulateBehind(ctx, client, nil, after, []simCall{testerCall(common.HexToAddress(cfg.V2Factory), nil, data)})
+		if err != nil {
+			return nil, err
+		}
+		out, err := uniswapV2FactoryABI.Unpack("getPair", results[0].ReturnData)
+		if err != nil {
+			return nil, err
+		}
+		health.Pool = out[0].(common.Address)
+	}
+
+	balanceData, err := erc20ABI.Pack("balanceOf", health.Pool)
+	if err != nil {
+		return nil, err
+	}
+	results, err := simulateBehind(ctx, client, nil, after, []simCall{
+		testerCall(wrapped, nil, balanceData),
+		testerCall(token.Address, nil, balanceData),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.failed() {
+			return nil, errors.New("reading pool balances reverts: " + result.reason())
+		}
+	}
+	health.NativeReserve = new(big.Int).SetBytes(results[0].ReturnData)
+	health.TokenReserve = new(big.Int).SetBytes(results[1].ReturnData)
+	health.assess(ctx, client, cfg, token)
+	return health, nil
+}
+
+// assess values the native side of the pool in USD and warns about a pool
+// holding little of the supply or nothing on one side.
+func (h *poolHealth) assess(ctx context.Context, client *ethclient.Client, cfg chainConfig, token *tokenInfo) {
+	if nativeUSD, err := nativeUSDPrice(ctx, client, cfg); err == nil {
+		h.PairedUSD = new(big.Float).Mul(toDecimal(h.NativeReserve, 18), nativeUSD)
+	} else {
+		log.Printf("Error reading %s price: %v", cfg.NativeSymbol, err)
+		h.Warnings = append(h.Warnings, fmt.Sprintf("No %s/USD price, liquidity could not be valued", cfg.NativeSymbol))
+	}
+
+	if token.TotalSupply != nil && token.TotalSupply.Sign() > 0 {
+		share := percentOf(h.TokenReserve, token.TotalSupply)
+		if share < minPoolSupplyPercent {
+			h.Warnings = append(h.Warnings, fmt.Sprintf("Pool holds only %.2f%% of the supply", share))
+		}
+	}
+	if h.NativeReserve.Sign() == 0 || h.TokenReserve.Sign() == 0 {
+		h.Warnings = append(h.Warnings, "One side of the pool is empty")
+	}
+}
+
+// checkLP warns when V2 LP tokens are not burned or are held by the token
+// owner, which leaves the liquidity removable.
+func (h *poolHealth) checkLP(ctx context.Context, client *ethclient.Client, token common.Address) error {
+	out, err := callContract(ctx, client, h.Pool, erc20ABI, "totalSupply")
+	if err != nil {
+		return err
+	}
+	lpSupply := out[0].(*big.Int)
+	if lpSupply.Sign() == 0 {
+		return nil
+	}
+
+	burned := new(big.Int)
+	for _, address := range lpBurnAddresses {
+		balance, err := tokenBalance(ctx, client, h.Pool, address)
+		if err != nil {
+			return err
+		}
+		burned.Add(burned, balance)
+	}
+	if percentOf(burned, lpSupply) < minBurnedLPPercent {
+		h.Warnings = append(h.Warnings, "Liquidity is not burned and may be unlocked")
+	}
+
+	owner, err := callContract(ctx, client, token, ownableABI, "owner")
+	if err != nil || owner[0].(common.Address) == (common.Address{}) {
+		return nil
+	}
+	balance, err := tokenBalance(ctx, client, h.Pool, owner[0].(common.Address))
+	if err != nil {
+		return err
+	}
+	if share := percentOf(balance, lpSupply); share > maxOwnerLPPercent {
+		h.Warnings = append(h.Warnings, fmt.Sprintf("Deployer holds %.0f%% of the liquidity", share))
+	}
+	return nil
+}
+
+// belowMinimum reports whether the paired side is worth less than minUSD.
+// Pools that could not be valued are not rejected.
+func (h *poolHealth) belowMinimum(minUSD int) bool {
+	if h.PairedUSD == nil || minUSD <= 0 {
+		return false
+	}
+	return h.PairedUSD.Cmp(big.NewFloat(float64(minUSD))) < 0
+}
+
+func percentOf(part, whole *big.Int) float64 {
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(part), new(big.Float).SetInt(whole)).Float64()
+	return ratio * 100
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// position aggregates the confirmed trades of one token from one wallet.
+// Token amounts are in the token's base units and native amounts in wei.
+type position struct {
+	Chain    chainConfig
+	Wallet   string
+	Token    *tokenInfo
+	Bought   *big.Int
+	Sold     *big.Int
+	Cost     *big.Int
+	Proceeds *big.Int
+	Fees     *big.Int
+	// CostUSD is the cost at the native price of each buy; buys without a
+	// recorded price are left out.
+	CostUSD *big.Float
+	// Balance is what the wallet holds now and Value what selling all of
+	// it would return.
+	Balance *big.Int
+	Value   *big.Int
+}
+
+func newPosition(cfg chainConfig, wallet string, token *tokenInfo) *position {
+	return &position{
+		Chain:    cfg,
+		Wallet:   wallet,
+		Token:    token,
+		Bought:   new(big.Int),
+		Sold:     new(big.Int),
+		Cost:     new(big.Int),
+		Proceeds: new(big.Int),
+		Fees:     new(big.Int),
+		CostUSD:  new(big.Float),
+		Balance:  new(big.Int),
+		Value:    new(big.Int),
+	}
+}
+
+// add folds a confirmed trade into the position.
+func (p *position) add(trade *models.Trade) {
+	native, _ := new(big.Int).SetString(trade.NativeAmount, 10)
+	tokens, _ := new(big.Int).SetString(trade.TokenAmount, 10)
+	if native == nil || tokens == nil {
+		return
+	}
+	if fee, ok := new(big.Int).SetString(trade.GasFee, 10); ok {
+		p.Fees.Add(p.Fees, fee)
+	}
+	if trade.Side == database.TradeSideSell {
+		p.Sold.Add(p.Sold, tokens)
+		p.Proceeds.Add(p.Proceeds, native)
+		return
+	}
+	p.Bought.Add(p.Bought, tokens)
+	p.Cost.Add(p.Cost, native)
+	if price, ok := new(big.Float).SetString(trade.NativeUSD); ok {
+		p.CostUSD.Add(p.CostUSD, new(big.Float).Mul(toDecimal(native, 18), price))
+	}
+}
+
+// entryPrice is the average native price paid per whole token.
+func (p *position) entryPrice() float64 {
+	if p.Bought.Sign() == 0 {
+		return 0
+	}
+	price, _ := new(big.Float).Quo(toDecimal(p.Cost, 18), toDecimal(p.Bought, p.Token.Decimals)).Float64()
+	return price
+}
+
+// basisOf is the share of the cost that amount of the bought tokens carries,
+// at the average entry price.
+func (p *position) basisOf(amount *big.Int) *big.Float {
+	if p.Bought.Sign() == 0 {
+		return new(big.Float)
+	}
+	basis := new(big.Float).Mul(toDecimal(p.Cost, 18), new(big.Float).SetInt(amount))
+	return basis.Quo(basis, new(big.Float).SetInt(p.Bought))
+}
+
+// realized is the native profit of the tokens sold so far.
+func (p *position) realized() *big.Float {
+	return new(big.Float).Sub(toDecimal(p.Proceeds, 18), p.basisOf(p.Sold))
+}
+
+// unrealized is the native profit of the tokens still held.
+func (p *position) unrealized() *big.Float {
+	return new(big.Float).Sub(toDecimal(p.Value, 18), p.basisOf(p.Balance))
+}
+
+// multiplier is what the position returned, or is worth, per native coin put
+// in.
+func (p *position) multiplier() float64 {
+	if p.Cost.Sign() == 0 {
+		return 0
+	}
+	returned := new(big.Float).SetInt(new(big.Int).Add(p.Value, p.Proceeds))
+	multiplier, _ := returned.Quo(returned, new(big.Float).SetInt(p.Cost)).Float64()
+	return multiplier
+}
+
+// loadPositions aggregates the chat's confirmed trades on cfg per wallet and
+// token, and values what each wallet still holds.
+func (a *application) loadPositions(ctx context.Context, client *ethclient.Client, cfg chainConfig, chatID string) ([]*position, error) {
+	trades, err := database.GetChatTrades(a.db, chatID, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	positions := aggregatePositions(ctx, client, cfg, trades)
+	valuePositions(ctx, client, cfg, positions)
+	return positions, nil
+}
+
+// aggregatePositions folds trades into one position per wallet and token.
+func aggregatePositions(ctx context.Context, client *ethclient.Client, cfg chainConfig, trades []*models.Trade) []*position {
+	tokens := make(map[string]*tokenInfo)
+	byKey := make(map[string]*position)
+	var positions []*position
+	for _, trade := range trades {
+		token, ok := tokens[trade.TokenAddress]
+		if !ok {
+			var err error
+			token, err = readTokenInfo(ctx, client, common.HexToAddress(trade.TokenAddress))
+			if err != nil {
+				log.Printf("Error reading token %s: %v", trade.TokenAddress, err)
+			}
+			tokens[trade.TokenAddress] = token
+		}
+		if token == nil {
+			continue
+		}
+
+		key := trade.WalletAddress + trade.TokenAddress
+		p, ok := byKey[key]
+		if !ok {
+			p = newPosition(cfg, trade.WalletAddress, token)
+			byKey[key] = p
+			positions = append(positions, p)
+		}
+		p.add(trade)
+	}
+	return positions
+}
+
+// valuePositions reads what each position's wallet holds and what selling
+// it would return.
+func valuePositions(ctx context.Context, client *ethclient.Client, cfg chainConfig, positions []*position) {
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	for _, p := range positions {
+		balance, err := tokenBalance(ctx, client, p.Token.Address, common.HexToAddress(p.Wallet))
+		if err != nil {
+			log.Printf("Error reading balance of %s: %v", p.Wallet, err)
+			continue
+		}
+		p.Balance = balance
+		if balance.Sign() == 0 {
+			continue
+		}
+		route, err := bestRoute(ctx, client, cfg, p.Token.Address, wrapped, balance)
+		if err != nil {
+			log.Printf("Error quoting %s: %v", p.Token.Address.Hex(), err)
+			continue
+		}
+		p.Value = route.AmountOut
+	}
+}
+
+// formatPnL renders a signed native amount with its USD value when the
+// native price is known.
+func formatPnL(native, nativeUSD *big.Float, symbol string) string {
+	sign := "+"
+	if native.Sign() < 0 {
+		sign = "-"
+	}
+	abs := new(big.Float).Abs(native)
+	text := fmt.Sprintf("%s%s %s", sign, formatCompact(abs), symbol)
+	if nativeUSD != nil {
+		text += fmt.Sprintf(" (%s%s)", sign, formatUSD(new(big.Float).Mul(abs, nativeUSD)))
+	}
+	return text
+}
+
+func (p *position) String(nativeUSD *big.Float) string {
+	cfg := p.Chain
+	symbol := markdownEscaper.Replace(p.Token.Symbol)
+	var lines strings.Builder
+	lines.WriteString(fmt.Sprintf("*%s* | %s\n", symbol, shortAddress(p.Wallet)))
+
+	value := toDecimal(p.Value, 18)
+	holding := fmt.Sprintf("Holding: %s %s ≈ %s %s", formatCompact(toDecimal(p.Balance, p.Token.Decimals)), symbol, formatCompact(value), cfg.NativeSymbol)
+	if nativeUSD != nil {
+		holding += fmt.Sprintf(" (%s)", formatUSD(new(big.Float).Mul(value, nativeUSD)))
+	}
+	lines.WriteString(holding + "\n")
+
+	if p.Bought.Sign() > 0 {
+		bought := toDecimal(p.Bought, p.Token.Decimals)
+		entry := fmt.Sprintf("Entry: %s %s", formatCompact(big.NewFloat(p.entryPrice())), cfg.NativeSymbol)
+		cost := fmt.Sprintf("Cost: %s %s", formatCompact(toDecimal(p.Cost, 18)), cfg.NativeSymbol)
+		if p.CostUSD.Sign() > 0 {
+			entry += fmt.Sprintf(" (%s)", formatUSD(new(big.Float).Quo(p.CostUSD, bought)))
+			cost += fmt.Sprintf(" (%s)", formatUSD(p.CostUSD))
+		}
+		lines.WriteString(entry + " | " + cost + "\n")
+	}
+
+	lines.WriteString(fmt.Sprintf("Unrealized: %s\n", formatPnL(p.unrealized(), nativeUSD, cfg.NativeSymbol)))
+	lines.WriteString(fmt.Sprintf("Realized: %s\n", formatPnL(p.realized(), nativeUSD, cfg.NativeSymbol)))
+	lines.WriteString(fmt.Sprintf("Fees: %s %s | Multiplier: %.2fx\n", formatCompact(toDecimal(p.Fees, 18)), cfg.NativeSymbol, p.multiplier()))
+	return lines.String()
+}
+
+func makePositionButtons(positions []*position) *tbot.InlineKeyboardMarkup {
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, p := range positions {
+		if p.Balance.Sign() == 0 {
+			continue
+		}
+		buttons = append(buttons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("#%d Sell 50%%", i+1), CallbackData: fmt.Sprintf("position_sell_%d_50", i+1)},
+			{Text: fmt.Sprintf("#%d Sell 100%%", i+1), CallbackData: fmt.Sprintf("position_sell_%d_100", i+1)},
+			{Text: fmt.Sprintf("#%d Rules", i+1), CallbackData: fmt.Sprintf("position_rules_%d", i+1)},
+		})
+	}
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "🔄 Refresh", CallbackData: "positions_management"}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "back_to_mainboard"}},
+	)
+	return &tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
+
+// positionsHandler lists the chat's positions on the current chain with
+// their PnL and quick-sell buttons.
+func (a *application) positionsHandler(m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if !cfg.isEVM() {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Positions are not available on %s yet.", cfg.Name))
+		return
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	positions, err := a.loadPositions(ctx, client, cfg, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error loading positions: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to load positions.")
+		return
+	}
+	// Without a price feed PnL is shown in the native coin only.
+	nativeUSD, _ := nativeUSDPrice(ctx, client, cfg)
+
+	a.draftsMu.Lock()
+	if a.positionLists == nil {
+		a.positionLists = make(map[string][]*position)
+	}
+	a.positionLists[m.Chat.ID] = positions
+	a.draftsMu.Unlock()
+
+	positionsMsg := fmt.Sprintf("🏦 Positions (🔗%s)\n\n", cfg.Name)
+	if len(positions) == 0 {
+		positionsMsg += "No trades yet. Paste a token contract address to buy one."
+	}
+	for i, p := range positions {
+		positionsMsg += fmt.Sprintf("%d. %s\n", i+1, p.String(nativeUSD))
+	}
+
+	buttons := makePositionButtons(positions)
+	a.client.SendMessage(m.Chat.ID, positionsMsg, tbot.OptParseModeMarkdown, tbot.OptInlineKeyboardMarkup(buttons), tbot.OptDisableWebPagePreview)
+}
+
+// listedPosition returns the position numbered number on the chat's last
+// positions screen, or tells the chat it is gone.
+func (a *application) listedPosition(m *tbot.Message, number int) *position {
+	a.draftsMu.Lock()
+	positions := a.positionLists[m.Chat.ID]
+	a.draftsMu.Unlock()
+	if number < 1 || number > len(positions) {
+		a.client.SendMessage(m.Chat.ID, "Position not found. Please open Positions again.")
+		return nil
+	}
+	return positions[number-1]
+}
+
+// positionSellHandler handles a quick-sell button of the positions screen.
+// data is "<position number>_<percent>".
+func (a *application) positionSellHandler(data string, m *tbot.Message) {
+	number, percentText, ok := strings.Cut(data, "_")
+	index, err := strconv.Atoi(number)
+	percent, percentErr := strconv.Atoi(percentText)
+	if !ok || err != nil || percentErr != nil {
+		log.Printf("Invalid position sell callback: %s", data)
+		return
+	}
+
+	p := a.listedPosition(m, index)
+	if p == nil {
+		return
+	}
+	cfg := p.Chain
+
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	wallet, err := database.GetWalletByAddress(a.db, p.Wallet)
+	if err != nil {
+		log.Printf("Error getting wallet %s: %v", p.Wallet, err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallet.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	spec := sellSpec{Percent: percent}
+	wallets := []*models.Wallet{wallet}
+	a.confirmTrade(m, func() (string, error) {
+		return a.sellPreview(ctx, client, cfg, m.Chat.ID, p.Token, spec, wallets)
+	}, func() {
+		a.sellAndReport(cfg, p.Token, spec, wallets, m)
+	})
+}
+
+// positionRules returns the open stop-loss, take-profit and trailing-stop
+// orders of p.
+func (a *application) positionRules(chatID string, p *position) ([]*models.LimitOrder, error) {
+	orders, err := database.GetChatLimitOrders(a.db, chatID)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*models.LimitOrder
+	for _, order := range orders {
+		if order.Chain == p.Chain.Name && strings.EqualFold(order.TokenAddress, p.Token.Address.Hex()) &&
+			len(order.Wallets) == 1 && strings.EqualFold(order.Wallets[0], p.Wallet) {
+			rules = append(rules, order)
+		}
+	}
+	return rules, nil
+}
+
+// positionRulesHandler shows the exit rules of a position. data is the
+// position number.
+func (a *application) positionRulesHandler(data string, m *tbot.Message) {
+	number, err := strconv.Atoi(data)
+	if err != nil {
+		log.Printf("Invalid position rules callback: %s", data)
+		return
+	}
+	p := a.listedPosition(m, number)
+	if p == nil {
+		return
+	}
+	rules, err := a.positionRules(m.Chat.ID, p)
+	if err != nil {
+		log.Printf("Error getting position rules: %v", err)
+	}
+
+	var ruleList strings.Builder
+	var cancelButtons [][]tbot.InlineKeyboardButton
+	for i, rule := range rules {
+		ruleList.WriteString(fmt.Sprintf("%d. Sell %s%% at %s\n", i+1, rule.Amount, formatOrderTrigger(rule)))
+		cancelButtons = append(cancelButtons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("❌ Cancel %d", i+1), CallbackData: "order_cancel_" + rule.ID.String()},
+		})
+	}
+	if len(rules) == 0 {
+		ruleList.WriteString("No rules set.\n")
+	}
+
+	rulesMsg := fmt.Sprintf(`🛡 Exit rules for %s | %s (🔗%s)
+
+Entry: %s %s
+
+Rules:
+%s`, p.Token.Symbol, shortAddress(p.Wallet), p.Chain.Name, formatCompact(big.NewFloat(p.entryPrice())), p.Chain.NativeSymbol, ruleList.String())
+
+	buttons := append(cancelButtons,
+		[]tbot.InlineKeyboardButton{{Text: "➕ Add Rules", CallbackData: fmt.Sprintf("position_rules_add_%d", number)}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "positions_management"}},
+	)
+	a.client.SendMessage(m.Chat.ID, rulesMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) positionRulesAddHandler(data string, m *tbot.Message) {
+	number, err := strconv.Atoi(data)
+	if err != nil {
+		log.Printf("Invalid position rules callback: %s", data)
+		return
+	}
+	if a.listedPosition(m, number) == nil {
+		return
+	}
+	a.draftsMu.Lock()
+	if a.ruleDrafts == nil {
+		a.ruleDrafts = make(map[string]int)
+	}
+	a.ruleDrafts[m.Chat.ID] = number
+	a.draftsMu.Unlock()
+
+	a.waitingForPositionRules = true
+	a.client.SendMessage(m.Chat.ID, `Send one or more rules separated by commas:
+sl <multiple> [percent]: stop-loss below a multiple of your entry
+tp <multiple> [percent]: take-profit above a multiple of your entry
+trail <percent drop> [percent]: trailing stop below the highest price
+
+For example: sl 0.6x, tp 2x 50%, tp 5x 100%, trail 25%
+Each rule sells 100% of the balance left unless a percent is given.`)
+}
+
+// parsePositionRule reads one rule such as "tp 2x 50%" into an order.
+func parsePositionRule(text string) (*models.LimitOrder, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid rule %q", text)
+	}
+	order := &models.LimitOrder{Side: database.TradeSideSell, Amount: "100"}
+	switch fields[0] {
+	case "sl":
+		order.Trigger = database.OrderTriggerStopLoss
+	case "tp":
+		order.Trigger = database.OrderTriggerTakeProfit
+	case "trail":
+		order.Trigger = database.OrderTriggerTrailing
+	default:
+		return nil, fmt.Errorf("unknown rule %q", fields[0])
+	}
+
+	var err error
+	if order.Trigger == database.OrderTriggerTrailing {
+		order.Target, err = strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil || order.Target <= 0 || order.Target >= 100 {
+			return nil, fmt.Errorf("invalid trailing percent %q", fields[1])
+		}
+	} else {
+		order.Target, err = strconv.ParseFloat(strings.TrimSuffix(fields[1], "x"), 64)
+		if err != nil || order.Target <= 0 {
+			return nil, fmt.Errorf("invalid multiple %q", fields[1])
+		}
+	}
+	if len(fields) == 3 {
+		spec, err := parseSellSpec(fields[2], 0, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent %q", fields[2])
+		}
+		order.Amount = strconv.Itoa(spec.Percent)
+	}
+	return order, nil
+}
+
+// positionRulesInputHandler saves the rules entered after "Add Rules".
+func (a *application) positionRulesInputHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	number, ok := a.ruleDrafts[m.Chat.ID]
+	delete(a.ruleDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+	if !ok {
+		return
+	}
+	p := a.listedPosition(m, number)
+	if p == nil {
+		return
+	}
+	if p.entryPrice() == 0 {
+		a.client.SendMessage(m.Chat.ID, "This position has no recorded buys to set rules against.")
+		return
+	}
+
+	var rules []*models.LimitOrder
+	for _, text := range strings.FieldsFunc(m.Text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		rule, err := parsePositionRule(text)
+		if err != nil {
+			a.client.SendMessage(m.Chat.ID, err.Error()+".")
+			return
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		a.client.SendMessage(m.Chat.ID, "No rules given.")
+		return
+	}
+
+	// Trailing stops start from the current price.
+	peak := p.entryPrice()
+	if client, err := a.ethClient(p.Chain); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if price, err := tokenNativePrice(ctx, client, p.Chain, p.Token); err == nil {
+			peak, _ = price.Float64()
+		}
+		cancel()
+	}
+
+	for _, rule := range rules {
+		rule.ChatID = m.Chat.ID
+		rule.Chain = p.Chain.Name
+		rule.TokenAddress = p.Token.Address.Hex()
+		rule.Wallets = []string{p.Wallet}
+		rule.EntryPrice = p.entryPrice()
+		if rule.Trigger == database.OrderTriggerTrailing {
+			rule.PeakPrice = peak
+		}
+		if err := database.CreateLimitOrder(a.db, rule); err != nil {
+			a.client.SendMessage(m.Chat.ID, "Failed to save the rules.")
+			return
+		}
+	}
+	a.positionRulesHandler(strconv.Itoa(number), m)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const chainlinkAggregatorABIJSON = `[
+	{"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}
+]`
+
+var chainlinkAggregatorABI = mustParseABI(chainlinkAggregatorABIJSON)
+
+// toDecimal converts a base-unit amount into a float of whole units.
+func toDecimal(amount *big.Int, decimals uint8) *big.Float {
+	if amount == nil {
+		return new(big.Float)
+	}
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	return new(big.Float).Quo(new(big.Float).SetInt(amount), scale)
+}
+
+// nativeUSDPrice reads the USD price of the chain's native coin from its
+// Chainlink feed.
+func nativeUSDPrice(ctx context.Context, client *ethclient.Client, cfg chainConfig) (*big.Float, error) {
+	if cfg.NativeUSDFeed == "" {
+		return nil, errors.New("no USD price feed configured for " + cfg.Name)
+	}
+	feed := common.HexToAddress(cfg.NativeUSDFeed)
+	decimals, err := callContract(ctx, client, feed, chainlinkAggregatorABI, "decimals")
+	if err != nil {
+		return nil, err
+	}
+	round, err := callContract(ctx, client, feed, chainlinkAggregatorABI, "latestRoundData")
+	if err != nil {
+		return nil, err
+	}
+	answer := round[1].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, errors.New("price feed returned no price")
+	}
+	return toDecimal(answer, decimals[0].(uint8)), nil
+}
+
+// formatUSD renders a dollar amount compactly, e.g. $1.25M or $0.000041.
+func formatUSD(value *big.Float) string {
+	if value == nil {
+		return "N/A"
+	}
+	return "$" + formatCompact(value)
+}
+
+// formatCompact renders a number with K/M/B suffixes for large values and
+// four significant digits for small ones.
+func formatCompact(value *big.Float) string {
+	v, _ := value.Float64()
+	switch {
+	case v >= 1e9:
+		return fmt.Sprintf("%.2fB", v/1e9)
+	case v >= 1e6:
+		return fmt.Sprintf("%.2fM", v/1e6)
+	case v >= 1e3:
+		return fmt.Sprintf("%.2fK", v/1e3)
+	case v >= 1:
+		return fmt.Sprintf("%.2f", v)
+	case v == 0:
+		return "0"
+	default:
+		rounded, _ := strconv.ParseFloat(fmt.Sprintf("%.4g", v), 64)
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	}
+}
+
+// tokenNativePrice quotes a small buy of token and returns the native price
+// paid per whole token.
+func tokenNativePrice(ctx context.Context, client *ethclient.Client, cfg chainConfig, token *tokenInfo) (*big.Float, error) {
+	route, err := bestRoute(ctx, client, cfg, common.HexToAddress(cfg.WrappedNative), token.Address, safetyProbeAmount)
+	if err != nil {
+		return nil, err
+	}
+	return routeNativePrice(route, token)
+}
+
+// routeNativePrice is the price of one whole token in native coin implied by
+// route, which must be quoted for safetyProbeAmount.
+func routeNativePrice(route *swapRoute, token *tokenInfo) (*big.Float, error) {
+	if route.AmountOut.Sign() == 0 {
+		return nil, errors.New("pool returns no tokens")
+	}
+	return new(big.Float).Quo(toDecimal(safetyProbeAmount, 18), toDecimal(route.AmountOut, token.Decimals)), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/models"
+)
+
+// The safety check trades from a throwaway address funded through a state
+// override, so it never touches a real wallet.
+var (
+	safetyTester    = common.BytesToAddress(crypto.Keccak256([]byte("rochambeau.safety.tester"))[12:])
+	safetyRecipient = common.BytesToAddress(crypto.Keccak256([]byte("rochambeau.safety.recipient"))[12:])
+	// safetyBalanceReader is overridden with code that returns the native
+	// balance of the address passed as calldata:
+	// PUSH1 0 CALLDATALOAD BALANCE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	safetyBalanceReader     = common.BytesToAddress(crypto.Keccak256([]byte("rochambeau.safety.reader"))[12:])
+	safetyBalanceReaderCode = hexutil.Bytes(common.FromHex("0x6000353160005260206000f3"))
+)
+
+// safetyProbeAmount is the native amount the token card simulates a buy with.
+var safetyProbeAmount = big.NewInt(1e16)
+
+// tokenSafety is the outcome of a simulated buy, transfer and sell.
+type tokenSafety struct {
+	// BuyTax and SellTax are in percent of the quoted output.
+	BuyTax             float64
+	SellTax            float64
+	Honeypot           bool
+	BuyBlocked         bool
+	TransferRestricted bool
+	Reason             string
+}
+
+// safetyOverrides funds the tester and installs the balance reader.
+func safetyOverrides(funding *big.Int) map[common.Address]simAccountOverride {
+	return map[common.Address]simAccountOverride{
+		safetyTester:        {Balance: (*hexutil.Big)(funding)},
+		safetyBalanceReader: {Code: &safetyBalanceReaderCode},
+	}
+}
+
+func testerCall(to common.Address, value *big.Int, data []byte) simCall {
+	call := simCall{From: safetyTester, To: to, Data: data, Gas: simulationGasCap}
+	if value != nil {
+		call.Value = (*hexutil.Big)(value)
+	}
+	return call
+}
+
+func taxPercent(expected, received *big.Int) float64 {
+	if expected.Sign() == 0 || received.Cmp(expected) >= 0 {
+		return 0
+	}
+	lost := new(big.Float).SetInt(new(big.Int).Sub(expected, received))
+	ratio, _ := new(big.Float).Quo(lost, new(big.Float).SetInt(expected)).Float64()
+	return ratio * 100
+}
+
+// analyzeTokenSafety simulates buying token with amountIn through route,
+// transferring part of it and selling half of it back, and measures the
+// effective taxes against the route's quotes. When after is set the
+// simulation runs on top of that pending transaction.
+func analyzeTokenSafety(ctx context.Context, client *ethclient.Client, cfg chainConfig, token *tokenInfo, route *swapRoute, amountIn *big.Int, after *types.Transaction) (*tokenSafety, error) {
+	funding := new(big.Int).Add(new(big.Int).Mul(amountIn, big.NewInt(10)), big.NewInt(1e18))
+	simulate := func(calls []simCall) ([]simCallResult, error) {
+		return simulateBehind(ctx, client, safetyOverrides(funding), after, calls)
+	}
+	deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+
+	buyData, err := route.buyData(cfg, token.Address, amountIn, new(big.Int), safetyTester, deadline)
+	if err != nil {
+		return nil, err
+	}
+	balanceData, err := erc20ABI.Pack("balanceOf", safetyTester)
+	if err != nil {
+		return nil, err
+	}
+	buy := testerCall(route.Router, amountIn, buyData)
+
+	results, err := simulate([]simCall{buy, testerCall(token.Address, nil, balanceData)})
+	if err != nil {
+		return nil, err
+	}
+	safety := &tokenSafety{}
+	if results[0].failed() {
+		safety.BuyBlocked = true
+		safety.Reason = "buy reverts: " + results[0].reason()
+		return safety, nil
+	}
+	balance, err := erc20ABI.Unpack("balanceOf", results[1].ReturnData)
+	if err != nil {
+		return nil, err
+	}
+	received := balance[0].(*big.Int)
+	safety.BuyTax = taxPercent(route.AmountOut, received)
+	if received.Sign() == 0 {
+		safety.Honeypot = true
+		safety.Reason = "buy delivers no tokens"
+		return safety, nil
+	}
+
+	// Replay the buy, then transfer 1% away and sell half of what was bought.
+	transferData, err := erc20ABI.Pack("transfer", safetyRecipient, new(big.Int).Div(received, big.NewInt(100)))
+	if err != nil {
+		return nil, err
+	}
+	approveData, err := erc20ABI.Pack("approve", route.Router, maxUint256)
+	if err != nil {
+		return nil, err
+	}
+	sellAmount := new(big.Int).Div(received, big.NewInt(2))
+	quoteTo, quoteData, err := route.quoteCall(cfg, token.Address, wrapped, sellAmount)
+	if err != nil {
+		return nil, err
+	}
+	sellData, err := route.sellData(cfg, token.Address, sellAmount, new(big.Int), safetyTester, deadline)
+	if err != nil {
+		return nil, err
+	}
+	readBalance := testerCall(safetyBalanceReader, nil, common.LeftPadBytes(safetyTester.Bytes(), 32))
+
+	results, err = simulate([]simCall{
+		buy,
+		testerCall(token.Address, nil, transferData),
+		testerCall(token.Address, nil, approveData),
+		testerCall(quoteTo, nil, quoteData),
+		readBalance,
+		testerCall(route.Router, nil, sellData),
+		readBalance,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if results[1].failed() {
+		safety.TransferRestricted = true
+		safety.Reason = "transfers revert: " + results[1].reason()
+	}
+	// The V3 quoter quotes by executing the swap, so a token that cannot be
+	// sold makes the quote revert as well.
+	if results[3].failed() {
+		safety.Honeypot = true
+		safety.Reason = "sell quote reverts: " + results[3].reason()
+		return safety, nil
+	}
+	if results[5].failed() {
+		safety.Honeypot = true
+		safety.Reason = "sell reverts: " + results[5].reason()
+		return safety, nil
+	}
+	expectedNative, err := route.unpackQuote(results[3].ReturnData)
+	if err != nil {
+		return nil, err
+	}
+
+	nativeBefore := new(big.Int).SetBytes(results[4].ReturnData)
+	nativeAfter := new(big.Int).SetBytes(results[6].ReturnData)
+	nativeOut := new(big.Int).Sub(nativeAfter, nativeBefore)
+	safety.SellTax = taxPercent(expectedNative, nativeOut)
+	if nativeOut.Sign() <= 0 {
+		safety.Honeypot = true
+		safety.Reason = "sell returns nothing"
+	}
+	return safety, nil
+}
+
+// afterBuyTax returns what is left of amount once the measured buy tax is
+// taken.
+func (s *tokenSafety) afterBuyTax(amount *big.Int) *big.Int {
+	if s.BuyTax <= 0 {
+		return amount
+	}
+	kept := new(big.Float).Mul(new(big.Float).SetInt(amount), big.NewFloat(1-min(s.BuyTax, 100)/100))
+	out, _ := kept.Int(nil)
+	return out
+}
+
+// violation returns why a buy should be refused under settings, or "".
+func (s *tokenSafety) violation(settings *models.DefaultSettings) string {
+	switch {
+	case s.BuyBlocked, s.Honeypot:
+		return s.Reason
+	case s.BuyTax > float64(settings.BuyTax):
+		return fmt.Sprintf("buy tax %.1f%% exceeds your limit of %.1f%%", s.BuyTax, settings.BuyTax)
+	case s.SellTax > float64(settings.SellTax):
+		return fmt.Sprintf("sell tax %.1f%% exceeds your limit of %.1f%%", s.SellTax, settings.SellTax)
+	}
+	return ""
+}
+
+func (s *tokenSafety) String() string {
+	switch {
+	case s.Honeypot:
+		return "🚨 Honeypot: " + s.Reason
+	case s.BuyBlocked:
+		return "⛔ Not tradable: " + s.Reason
+	}
+	summary := fmt.Sprintf("Buy tax %.1f%% | Sell tax %.1f%%", s.BuyTax, s.SellTax)
+	if s.TransferRestricted {
+		return "⚠️ " + summary + "\n⚠️ " + s.Reason
+	}
+	return "✅ " + summary
+}
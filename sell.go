@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// approvalTimeout bounds how long a sell waits for its approval to be mined.
+const approvalTimeout = 2 * time.Minute
+
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// addGwei returns fees raised by extra gwei on the tip, or on the gas price
+// for legacy chains.
+func (f *feeQuote) addGwei(extra float64) *feeQuote {
+	if extra <= 0 {
+		return f
+	}
+	wei, _ := new(big.Float).Mul(big.NewFloat(extra), gwei).Int(nil)
+	if f.Dynamic {
+		return &feeQuote{
+			Dynamic: true,
+			TipCap:  new(big.Int).Add(f.TipCap, wei),
+			FeeCap:  new(big.Int).Add(f.FeeCap, wei),
+		}
+	}
+	return &feeQuote{GasPrice: new(big.Int).Add(f.GasPrice, wei)}
+}
+
+// ensureAllowance approves spender for token when the current allowance is
+// below amount and waits for the approval to be mined. Approvals are priced
+// at the ApproveGwei default when it is set.
+func (a *application) ensureAllowance(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, token, spender common.Address, amount *big.Int) error {
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	out, err := callContract(ctx, client, token, erc20ABI, "allowance", owner, spender)
+	if err != nil {
+		return fmt.Errorf("failed to read allowance: %w", err)
+	}
+	if out[0].(*big.Int).Cmp(amount) >= 0 {
+		return nil
+	}
+
+	var fees *feeQuote
+	if approveGwei := a.defaultSettings().ApproveGwei; approveGwei > 0 {
+		fees, err = presetFees(ctx, client, float64(approveGwei))
+		if err != nil {
+			return err
+		}
+	}
+	data, err := erc20ABI.Pack("approve", spender, maxUint256)
+	if err != nil {
+		return err
+	}
+	tx, err := a.sendTransaction(ctx, client, cfg, key, token, nil, data, fees)
+	if err != nil {
+		return fmt.Errorf("approval failed: %w", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, approvalTimeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(waitCtx, client, tx)
+	if err != nil {
+		return fmt.Errorf("approval %s not mined: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status == 0 {
+		return fmt.Errorf("approval %s reverted", tx.Hash().Hex())
+	}
+	return nil
+}
+
+// escapeSellGas is the gas limit of a sell sent right behind its approval
+// when the node cannot simulate the pair to estimate it.
+const escapeSellGas = 600_000
+
+// sendApprovedSell sends a sell of amount of token through spender, first
+// approving spender when the allowance is short. The approval and the sell
+// go out back to back on consecutive nonces at fees, so an urgent sell never
+// waits for its approval to be mined.
+func (a *application) sendApprovedSell(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, token, spender common.Address, amount *big.Int, data []byte, fees *feeQuote) (*types.Transaction, error) {
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	out, err := callContract(ctx, client, token, erc20ABI, "allowance", owner, spender)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowance: %w", err)
+	}
+	if out[0].(*big.Int).Cmp(amount) >= 0 {
+		return a.sendTransaction(ctx, client, cfg, key, spender, nil, data, fees)
+	}
+
+	approveData, err := erc20ABI.Pack("approve", spender, maxUint256)
+	if err != nil {
+		return nil, err
+	}
+	approval, err := a.sendTransaction(ctx, client, cfg, key, token, nil, approveData, fees)
+	if err != nil {
+		return nil, fmt.Errorf("approval failed: %w", err)
+	}
+	tx, err := a.sendTransactionAfter(ctx, client, cfg, key, spender, nil, data, fees, approval)
+	if !errors.Is(err, errSimulationUnsupported) {
+		return tx, err
+	}
+
+	// Without eth_simulateV1 the sell cannot be checked against the pending
+	// approval; send it unsimulated with a fixed gas limit.
+	nonce, err := a.nonces.reserve(ctx, client, cfg.Name, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	signed, err := types.SignNewTx(key, types.LatestSignerForChainID(cfg.chainID()), fees.txData(cfg, nonce, escapeSellGas, spender, new(big.Int), data))
+	if err == nil {
+		err = client.SendTransaction(ctx, signed)
+	}
+	if err != nil {
+		a.nonces.resync(cfg.Name, owner)
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+	return signed, nil
+}
+
+// sellSpec is how much of each wallet's balance to sell: either a percentage
+// or a fixed token amount.
+type sellSpec struct {
+	Percent int
+	Amount  *big.Int
+}
+
+// parseSellSpec reads "50%" or "50" as a percentage when percentOnly is set,
+// and otherwise treats input without a percent sign as a token amount.
+func parseSellSpec(text string, decimals uint8, percentOnly bool) (sellSpec, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasSuffix(text, "%") || percentOnly {
+		percent, err := strconv.Atoi(strings.TrimSuffix(text, "%"))
+		if err != nil || percent <= 0 || percent > 100 {
+			return sellSpec{}, fmt.Errorf("percentage must be between 1 and 100")
+		}
+		return sellSpec{Percent: percent}, nil
+	}
+	amount, err := parseUnits(text, decimals)
+	if err != nil {
+		return sellSpec{}, err
+	}
+	if amount.Sign() <= 0 {
+		return sellSpec{}, fmt.Errorf("amount must be positive")
+	}
+	return sellSpec{Amount: amount}, nil
+}
+
+func (s sellSpec) amountOf(balance *big.Int) *big.Int {
+	if s.Amount != nil {
+		return s.Amount
+	}
+	amount := new(big.Int).Mul(balance, big.NewInt(int64(s.Percent)))
+	return amount.Div(amount, big.NewInt(100))
+}
+
+// sellToken sells part of token from every wallet holding it through the
+// best V2 or V3 route for its amount and records each sent swap as a trade.
+func (a *application) sellToken(ctx context.Context, cfg chainConfig, chatID string, token *tokenInfo, spec sellSpec, wallets []*models.Wallet) ([]swapResult, error) {
+	if !cfg.hasDEX() && !cfg.hasV3() {
+		return nil, fmt.Errorf("no DEX is configured for %s", cfg.Name)
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fees, err := a.sellFees(ctx, client, cfg, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return a.sellTokenWithFees(ctx, cfg, chatID, token, spec, wallets, fees, false)
+}
+
+// sellFees prices sells at the chat's gas preset, or the network fees, plus
+// the SellGweiExtra default.
+func (a *application) sellFees(ctx context.Context, client *ethclient.Client, cfg chainConfig, chatID string) (*feeQuote, error) {
+	fees, err := a.chatFees(ctx, client, cfg, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if fees == nil {
+		if fees, err = suggestFees(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+	return fees.addGwei(float64(a.defaultSettings().SellGweiExtra)), nil
+}
+
+// sellTokenWithFees is sellToken priced at fees. Urgent sells send a missing
+// approval right ahead of the sell instead of waiting for it to be mined.
+func (a *application) sellTokenWithFees(ctx context.Context, cfg chainConfig, chatID string, token *tokenInfo, spec sellSpec, wallets []*models.Wallet, fees *feeQuote, urgent bool) ([]swapResult, error) {
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	settings := a.defaultSettings()
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+
+	var results []swapResult
+	for _, wallet := range wallets {
+		holder := common.HexToAddress(wallet.Address)
+		balance, err := tokenBalance(ctx, client, token.Address, holder)
+		if err != nil || balance.Sign() == 0 {
+			continue
+		}
+
+		result := swapResult{Wallet: wallet}
+		results = append(results, result)
+		last := &results[len(results)-1]
+
+		amountIn := spec.amountOf(balance)
+		last.AmountIn = amountIn
+		if amountIn.Sign() == 0 || amountIn.Cmp(balance) > 0 {
+			last.Err = fmt.Errorf("balance is %s %s", formatUnits(balance, token.Decimals), token.Symbol)
+			continue
+		}
+		key, err := loadPrivateKey(wallet)
+		if err != nil {
+			last.Err = err
+			continue
+		}
+		route, err := bestRoute(ctx, client, cfg, token.Address, wrapped, amountIn)
+		if err != nil {
+			last.Err = fmt.Errorf("failed to quote swap: %w", err)
+			continue
+		}
+		last.Route = route
+
+		minOut := applySlippage(route.AmountOut, settings.Slippage)
+		deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+		data, err := route.sellData(cfg, token.Address, amountIn, minOut, holder, deadline)
+		if err != nil {
+			last.Err = err
+			continue
+		}
+		if urgent {
+			last.Tx, last.Err = a.sendApprovedSell(ctx, client, cfg, key, token.Address, route.Router, amountIn, data, fees)
+		} else if last.Err = a.ensureAllowance(ctx, client, cfg, key, token.Address, route.Router, amountIn); last.Err == nil {
+			last.Tx, last.Err = a.sendTransaction(ctx, client, cfg, key, route.Router, nil, data, fees)
+		}
+		if last.Err != nil {
+			continue
+		}
+
+		database.CreateTrade(a.db, &models.Trade{
+			ChatID:        chatID,
+			Chain:         cfg.Name,
+			WalletAddress: wallet.Address,
+			TokenAddress:  token.Address.Hex(),
+			Side:          database.TradeSideSell,
+			Route:         route.String(),
+			NativeAmount:  minOut.String(),
+			TokenAmount:   amountIn.String(),
+			TxHash:        last.Tx.Hash().Hex(),
+			Status:        database.TransferStatusPending,
+		})
+	}
+	return results, nil
+}
+
+// tokenSellHandler handles a sell button of a token card. data is
+// "<percent>_<token>", where "x" asks for a custom amount.
+func (a *application) tokenSellHandler(data string, m *tbot.Message) {
+	percent, token, ok := strings.Cut(data, "_")
+	if !ok || !common.IsHexAddress(token) {
+		log.Printf("Invalid sell callback: %s", data)
+		return
+	}
+
+	if percent == "x" {
+		a.draftsMu.Lock()
+		if a.sellDrafts == nil {
+			a.sellDrafts = make(map[string]string)
+		}
+		a.sellDrafts[m.Chat.ID] = token
+		a.draftsMu.Unlock()
+
+		a.waitingForSellAmount = true
+		a.client.SendMessage(m.Chat.ID, "Enter the amount of tokens to sell from each wallet, or a percentage such as 30%:")
+		return
+	}
+	a.executeSell(token, percent, true, m)
+}
+
+// tokenSellAmountHandler sells the custom amount entered after "Sell X".
+func (a *application) tokenSellAmountHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	token, ok := a.sellDrafts[m.Chat.ID]
+	delete(a.sellDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+
+	if !ok {
+		a.client.SendMessage(m.Chat.ID, "Sell expired. Please paste the contract address again.")
+		return
+	}
+	a.executeSell(token, m.Text, false, m)
+}
+
+// executeSell sells token from every wallet holding it and reports the
+// per-wallet results.
+func (a *application) executeSell(token, amountText string, percentOnly bool, m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := readTokenInfo(ctx, client, common.HexToAddress(token))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return
+	}
+	spec, err := parseSellSpec(amountText, info.Decimals, percentOnly)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Invalid amount: "+err.Error())
+		return
+	}
+
+	a.confirmTrade(m, func() (string, error) {
+		return a.sellPreview(ctx, client, cfg, m.Chat.ID, info, spec, wallets)
+	}, func() {
+		a.sellAndReport(cfg, info, spec, wallets, m)
+	})
+}
+
+// sellPreview summarizes a sell of spec of token from every wallet holding
+// it.
+func (a *application) sellPreview(ctx context.Context, client *ethclient.Client, cfg chainConfig, chatID string, token *tokenInfo, spec sellSpec, wallets []*models.Wallet) (string, error) {
+	if !cfg.hasDEX() && !cfg.hasV3() {
+		return "", fmt.Errorf("no DEX is configured for %s", cfg.Name)
+	}
+	fees, err := a.sellFees(ctx, client, cfg, chatID)
+	if err != nil {
+		return "", err
+	}
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+
+	var lines strings.Builder
+	var gas string
+	for _, wallet := range wallets {
+		holder := common.HexToAddress(wallet.Address)
+		balance, err := tokenBalance(ctx, client, token.Address, holder)
+		if err != nil || balance.Sign() == 0 {
+			continue
+		}
+		amountIn := spec.amountOf(balance)
+		if amountIn.Sign() == 0 || amountIn.Cmp(balance) > 0 {
+			lines.WriteString(fmt.Sprintf("❌ %s: balance is %s\n", shortAddress(wallet.Address), formatUnits(balance, token.Decimals)))
+			continue
+		}
+		route, err := bestRoute(ctx, client, cfg, token.Address, wrapped, amountIn)
+		if err != nil {
+			return "", fmt.Errorf("failed to quote swap: %w", err)
+		}
+		impact, err := route.priceImpact(ctx, client, cfg, token.Address, wrapped, amountIn)
+		if err != nil {
+			return "", fmt.Errorf("failed to quote price impact: %w", err)
+		}
+		lines.WriteString(fmt.Sprintf("%s: %s → %s %s (impact %.2f%%)\n", shortAddress(wallet.Address),
+			formatUnits(amountIn, token.Decimals), formatUnits(route.AmountOut, 18), cfg.NativeSymbol, impact))
+
+		if gas == "" {
+			deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+			data, err := route.sellData(cfg, token.Address, amountIn, new(big.Int), holder, deadline)
+			if err != nil {
+				return "", err
+			}
+			gas = gasSummary(ctx, client, cfg, fees, ethereum.CallMsg{From: holder, To: &route.Router, Data: data})
+		}
+	}
+	if gas == "" {
+		return "", fmt.Errorf("none of your wallets hold %s", token.Symbol)
+	}
+
+	return fmt.Sprintf(`💰 Confirm sell of %s (🔗%s)
+
+%s
+Slippage: %d%%
+Gas: %s`, markdownEscaper.Replace(token.Symbol), cfg.Name, markdownEscaper.Replace(lines.String()),
+		a.defaultSettings().Slippage, gas), nil
+}
+
+// sellAndReport sells spec of token from every wallet holding it and replies
+// with the per-wallet results.
+func (a *application) sellAndReport(cfg chainConfig, info *tokenInfo, spec sellSpec, wallets []*models.Wallet, m *tbot.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	results, err := a.sellToken(ctx, cfg, m.Chat.ID, info, spec, wallets)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Sell failed: "+err.Error())
+		return
+	}
+	if len(results) == 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("None of your wallets hold %s.", info.Symbol))
+		return
+	}
+
+	amount := fmt.Sprintf("%d%% of balance", spec.Percent)
+	if spec.Amount != nil {
+		amount = fmt.Sprintf("%s %s", formatUnits(spec.Amount, info.Decimals), info.Symbol)
+	}
+	sellMsg := fmt.Sprintf(`💰 Sell %s (🔗%s)
+
+Selling per wallet: %s
+Slippage: %d%%
+
+%s`, markdownEscaper.Replace(info.Symbol), cfg.Name, markdownEscaper.Replace(amount),
+		a.defaultSettings().Slippage, formatSwapResults(cfg, results))
+
+	a.client.SendMessage(m.Chat.ID, sellMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+)
+
+// testChainID is the chain ID of the simulated chain.
+const testChainID = 1337
+
+// testChain is a simulated chain for tests. It runs calls and transactions
+// through the EVM against in-memory state and serves the JSON-RPC methods
+// the bot uses in process. Every sent transaction is mined into its own
+// block right away. Unless simulates is set it has no eth_simulateV1, like
+// most public RPCs.
+type testChain struct {
+	mu     sync.Mutex
+	config *params.ChainConfig
+	state  *state.StateDB
+	head   *types.Header
+	// mined holds every sent transaction and receipts its outcome.
+	mined    []*types.Transaction
+	receipts map[common.Hash]*types.Receipt
+	// ignoreOverrides makes eth_call drop state overrides, as some nodes do.
+	ignoreOverrides bool
+	// simulates serves eth_simulateV1, as nodes that can run backruns do.
+	simulates bool
+}
+
+// newTestChain starts a simulated chain with alloc and returns it with a
+// client connected to it.
+func newTestChain(t *testing.T, alloc types.GenesisAlloc) (*testChain, *ethclient.Client) {
+	t.Helper()
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, account := range alloc {
+		if account.Balance != nil {
+			statedb.SetBalance(address, uint256.MustFromBig(account.Balance), tracing.BalanceChangeUnspecified)
+		}
+		statedb.SetCode(address, account.Code)
+		statedb.SetNonce(address, account.Nonce)
+	}
+	chain := &testChain{
+		config: params.AllDevChainProtocolChanges,
+		state:  statedb,
+		head: &types.Header{
+			Number:     big.NewInt(1),
+			Time:       uint64(time.Now().Unix()),
+			GasLimit:   30_000_000,
+			BaseFee:    big.NewInt(params.GWei),
+			Difficulty: new(big.Int),
+		},
+		receipts: make(map[common.Hash]*types.Receipt),
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &testChainAPI{chain}); err != nil {
+		t.Fatal(err)
+	}
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+	})
+	return chain, client
+}
+
+// execute runs a call against statedb and returns its output and gas used.
+func (c *testChain) execute(statedb *state.StateDB, from common.Address, to common.Address, value *big.Int, data []byte, gas uint64) ([]byte, uint64, error) {
+	if gas == 0 {
+		gas = c.head.GasLimit
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	ret, left, err := runtime.Call(to, data, &runtime.Config{
+		ChainConfig: c.config,
+		Origin:      from,
+		GasLimit:    gas,
+		Value:       value,
+		State:       statedb,
+		BlockNumber: c.head.Number,
+		Time:        c.head.Time,
+		BaseFee:     c.head.BaseFee,
+	})
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		return nil, 0, &testRevertError{data: ret}
+	}
+	return ret, params.TxGas + gas - left, err
+}
+
+// failed reports whether the transaction with hash was mined and reverted.
+func (c *testChain) failed(hash common.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	receipt, ok := c.receipts[hash]
+	return ok && receipt.Status == types.ReceiptStatusFailed
+}
+
+// sent returns the mined transactions.
+func (c *testChain) sent() []*types.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*types.Transaction(nil), c.mined...)
+}
+
+type testRevertError struct{ data []byte }
+
+func (e *testRevertError) Error() string {
+	if reason, err := abi.UnpackRevert(e.data); err == nil {
+		return "execution reverted: " + reason
+	}
+	return "execution reverted"
+}
+
+func (e *testRevertError) ErrorCode() int { return 3 }
+
+func (e *testRevertError) ErrorData() interface{} { return hexutil.Encode(e.data) }
+
+type testCallArgs struct {
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Gas   hexutil.Uint64  `json:"gas"`
+	Value *hexutil.Big    `json:"value"`
+	Input hexutil.Bytes   `json:"input"`
+	Data  hexutil.Bytes   `json:"data"`
+}
+
+func (args testCallArgs) data() []byte {
+	if len(args.Input) > 0 {
+		return args.Input
+	}
+	return args.Data
+}
+
+// testChainAPI is the eth namespace of a testChain.
+type testChainAPI struct{ c *testChain }
+
+func (api *testChainAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(testChainID))
+}
+
+func (api *testChainAPI) BlockNumber() hexutil.Uint64 {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return hexutil.Uint64(api.c.head.Number.Uint64())
+}
+
+func (api *testChainAPI) GetBlockByNumber(number string, full bool) *types.Header {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return types.CopyHeader(api.c.head)
+}
+
+func (api *testChainAPI) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(2 * params.GWei))
+}
+
+func (api *testChainAPI) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(params.GWei))
+}
+
+func (api *testChainAPI) GetBalance(address common.Address, block string) *hexutil.Big {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return (*hexutil.Big)(api.c.state.GetBalance(address).ToBig())
+}
+
+func (api *testChainAPI) GetCode(address common.Address, block string) hexutil.Bytes {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return api.c.state.GetCode(address)
+}
+
+func (api *testChainAPI) GetTransactionCount(address common.Address, block string) hexutil.Uint64 {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return hexutil.Uint64(api.c.state.GetNonce(address))
+}
+
+func (api *testChainAPI) Call(args testCallArgs, block *string, overrides *map[common.Address]simAccountOverride) (hexutil.Bytes, error) {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	if args.To == nil {
+		return nil, errors.New("contract creation is not supported")
+	}
+	statedb := api.c.state.Copy()
+	if overrides != nil && !api.c.ignoreOverrides {
+		for address, override := range *overrides {
+			if override.Balance != nil {
+				statedb.SetBalance(address, uint256.MustFromBig(override.Balance.ToInt()), tracing.BalanceChangeUnspecified)
+			}
+			if override.Code != nil {
+				statedb.SetCode(address, *override.Code)
+			}
+		}
+	}
+	ret, _, err := api.c.execute(statedb, args.From, *args.To, args.Value.ToInt(), args.data(), uint64(args.Gas))
+	return ret, err
+}
+
+// testSimulateOpts is the part of the eth_simulateV1 options the testChain
+// reads.
+type testSimulateOpts struct {
+	BlockStateCalls []simBlock `json:"blockStateCalls"`
+}
+
+// testMethodNotFound is the error of a method the node does not serve.
+type testMethodNotFound struct{ method string }
+
+func (e *testMethodNotFound) Error() string { return "the method " + e.method + " does not exist" }
+
+func (e *testMethodNotFound) ErrorCode() int { return -32601 }
+
+func (api *testChainAPI) SimulateV1(opts testSimulateOpts, block string) ([]struct {
+	Calls []simCallResult `json:"calls"`
+}, error) {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	if !api.c.simulates {
+		return nil, &testMethodNotFound{"eth_simulateV1"}
+	}
+	results := make([]struct {
+		Calls []simCallResult `json:"calls"`
+	}, len(opts.BlockStateCalls))
+	statedb := api.c.state.Copy()
+	for i, block := range opts.BlockStateCalls {
+		for address, override := range block.StateOverrides {
+			if override.Balance != nil {
+				statedb.SetBalance(address, uint256.MustFromBig(override.Balance.ToInt()), tracing.BalanceChangeUnspecified)
+			}
+			if override.Code != nil {
+				statedb.SetCode(address, *override.Code)
+			}
+		}
+		for _, call := range block.Calls {
+			ret, used, err := api.c.execute(statedb, call.From, call.To, call.Value.ToInt(), call.Data, uint64(call.Gas))
+			result := simCallResult{ReturnData: ret, GasUsed: hexutil.Uint64(used), Status: 1}
+			if err != nil {
+				result.Status = 0
+				result.Error = &struct {
+					Message string `json:"message"`
+					Data    string `json:"data"`
+				}{Message: err.Error()}
+				var revert *testRevertError
+				if errors.As(err, &revert) {
+					result.Error.Data = hexutil.Encode(revert.data)
+				}
+			}
+			results[i].Calls = append(results[i].Calls, result)
+		}
+	}
+	return results, nil
+}
+
+func (api *testChainAPI) EstimateGas(args testCallArgs, block *string) (hexutil.Uint64, error) {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	if args.To == nil {
+		return 0, errors.New("contract creation is not supported")
+	}
+	_, used, err := api.c.execute(api.c.state.Copy(), args.From, *args.To, args.Value.ToInt(), args.data(), uint64(args.Gas))
+	return hexutil.Uint64(used), err
+}
+
+func (api *testChainAPI) SendRawTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(testChainID)), tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	if nonce := api.c.state.GetNonce(from); tx.Nonce() != nonce {
+		return common.Hash{}, fmt.Errorf("nonce %d, expected %d", tx.Nonce(), nonce)
+	}
+	if tx.To() == nil {
+		return common.Hash{}, errors.New("contract creation is not supported")
+	}
+	cost := new(big.Int).Add(tx.Value(), new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCap()))
+	if api.c.state.GetBalance(from).ToBig().Cmp(cost) < 0 {
+		return common.Hash{}, errors.New("insufficient funds for gas * price + value")
+	}
+
+	api.c.state.SetNonce(from, tx.Nonce()+1)
+	_, used, err := api.c.execute(api.c.state, from, *tx.To(), tx.Value(), tx.Data(), tx.Gas())
+	api.c.head.Number = new(big.Int).Add(api.c.head.Number, common.Big1)
+	api.c.head.Time++
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: used,
+		Logs:              []*types.Log{},
+		TxHash:            tx.Hash(),
+		GasUsed:           used,
+		EffectiveGasPrice: tx.GasFeeCap(),
+		BlockHash:         common.BigToHash(api.c.head.Number),
+		BlockNumber:       new(big.Int).Set(api.c.head.Number),
+	}
+	if err != nil {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	api.c.receipts[tx.Hash()] = receipt
+	api.c.mined = append(api.c.mined, tx)
+	return tx.Hash(), nil
+}
+
+func (api *testChainAPI) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	api.c.mu.Lock()
+	defer api.c.mu.Unlock()
+	return api.c.receipts[hash]
+}
+
+// stubContract returns runtime code that answers each selector with fixed
+// return data and reverts on any other call.
+func stubContract(returns map[[4]byte][]byte) []byte {
+	return payingStubContract(returns, nil)
+}
+
+// payingStubContract is stubContract where the selectors in pays also send
+// their caller a fixed amount of the native coin before returning.
+func payingStubContract(returns map[[4]byte][]byte, pays map[[4]byte]*big.Int) []byte {
+	selectors := make([][4]byte, 0, len(returns))
+	for id := range returns {
+		selectors = append(selectors, id)
+	}
+	sort.Slice(selectors, func(i, j int) bool { return string(selectors[i][:]) < string(selectors[j][:]) })
+
+	const (
+		preambleSize = 6  // PUSH1 0 CALLDATALOAD PUSH1 0xe0 SHR
+		caseSize     = 11 // DUP1 PUSH4 id EQ PUSH2 dest JUMPI
+		revertSize   = 4  // PUSH1 0 DUP1 REVERT
+		bodySize     = 16 // JUMPDEST PUSH2 len PUSH2 off PUSH1 0 CODECOPY PUSH2 len PUSH1 0 RETURN
+		paySize      = 42 // PUSH1 0 DUP1 DUP1 DUP1 PUSH32 amount CALLER GAS CALL POP
+	)
+	u16 := func(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+	size := func(id [4]byte) int {
+		if pays[id] != nil {
+			return bodySize + paySize
+		}
+		return bodySize
+	}
+
+	bodies := preambleSize + caseSize*len(selectors) + revertSize
+	data := bodies
+	for _, id := range selectors {
+		data += size(id)
+	}
+
+	code := []byte{0x60, 0x00, 0x35, 0x60, 0xe0, 0x1c}
+	dest := bodies
+	for _, id := range selectors {
+		code = append(code, 0x80, 0x63)
+		code = append(code, id[:]...)
+		code = append(code, 0x14, 0x61)
+		code = append(code, u16(dest)...)
+		code = append(code, 0x57)
+		dest += size(id)
+	}
+	code = append(code, 0x60, 0x00, 0x80, 0xfd)
+
+	var blobs []byte
+	for _, id := range selectors {
+		out := returns[id]
+		code = append(code, 0x5b)
+		if amount := pays[id]; amount != nil {
+			code = append(code, 0x60, 0x00, 0x80, 0x80, 0x80, 0x7f)
+			code = append(code, common.LeftPadBytes(amount.Bytes(), 32)...)
+			code = append(code, 0x33, 0x5a, 0xf1, 0x50)
+		}
+		code = append(code, 0x61)
+		code = append(code, u16(len(out))...)
+		code = append(code, 0x61)
+		code = append(code, u16(data+len(blobs))...)
+		code = append(code, 0x60, 0x00, 0x39, 0x61)
+		code = append(code, u16(len(out))...)
+		code = append(code, 0x60, 0x00, 0xf3)
+		blobs = append(blobs, out...)
+	}
+	return append(code, blobs...)
+}
+
+// gatedContract returns runtime code that reverts every call until open is
+// called, and from then on delegates every call to impl.
+func gatedContract(impl common.Address, open [4]byte) []byte {
+	//	    PUSH1 0 SLOAD PUSH1 ok JUMPI
+	//	    PUSH1 0 CALLDATALOAD PUSH1 0xe0 SHR PUSH4 open EQ PUSH1 set JUMPI
+	//	    PUSH1 0 DUP1 REVERT
+	//	set:
+	//	    JUMPDEST PUSH1 1 PUSH1 0 SSTORE STOP
+	//	ok:
+	//	    JUMPDEST CALLDATASIZE PUSH1 0 DUP1 CALLDATACOPY
+	//	    PUSH1 0 DUP1 CALLDATASIZE PUSH1 0 PUSH20 impl GAS DELEGATECALL
+	//	    RETURNDATASIZE PUSH1 0 DUP1 RETURNDATACOPY PUSH1 ret JUMPI
+	//	    RETURNDATASIZE PUSH1 0 REVERT
+	//	ret:
+	//	    JUMPDEST RETURNDATASIZE PUSH1 0 RETURN
+	code := []byte{0x60, 0x00, 0x54, 0x60, 32, 0x57, 0x60, 0x00, 0x35, 0x60, 0xe0, 0x1c, 0x63}
+	code = append(code, open[:]...)
+	code = append(code, 0x14, 0x60, 25, 0x57, 0x60, 0x00, 0x80, 0xfd)
+	code = append(code, 0x5b, 0x60, 0x01, 0x60, 0x00, 0x55, 0x00)
+	code = append(code, 0x5b, 0x36, 0x60, 0x00, 0x80, 0x37, 0x60, 0x00, 0x80, 0x36, 0x60, 0x00, 0x73)
+	code = append(code, impl.Bytes()...)
+	code = append(code, 0x5a, 0xf4, 0x3d, 0x60, 0x00, 0x80, 0x3e, 0x60, 79, 0x57, 0x3d, 0x60, 0x00, 0xfd)
+	return append(code, 0x5b, 0x3d, 0x60, 0x00, 0xf3)
+}
+
+// stubReturn packs values as the output of method for stubContract.
+func stubReturn(t *testing.T, returns map[[4]byte][]byte, parsed abi.ABI, method string, values ...interface{}) {
+	t.Helper()
+	m, ok := parsed.Methods[method]
+	if !ok {
+		t.Fatalf("no method %s", method)
+	}
+	out, err := m.Outputs.Pack(values...)
+	if err != nil {
+		t.Fatalf("packing %s: %v", method, err)
+	}
+	returns[[4]byte(m.ID)] = out
+}
+
+// recordingDriver is a database/sql driver which records the statements it
+// is given. Its queries find no rows unless answer gave them one.
+type recordingDriver struct {
+	mu      sync.Mutex
+	queries []string
+	answers map[string][]driver.Value
+}
+
+// answer makes queries starting with prefix return row.
+func (d *recordingDriver) answer(prefix string, row ...driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.answers == nil {
+		d.answers = make(map[string][]driver.Value)
+	}
+	d.answers[prefix] = row
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+
+func (d *recordingDriver) Driver() driver.Driver { return d }
+
+// count returns how many recorded statements start with prefix.
+func (d *recordingDriver) count(prefix string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, query := range d.queries {
+		if strings.HasPrefix(query, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	query = strings.TrimSpace(query)
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	for prefix, row := range c.d.answers {
+		if strings.HasPrefix(query, prefix) {
+			return recordingStmt{row: row}, nil
+		}
+	}
+	return recordingStmt{}, nil
+}
+
+func (c recordingConn) Close() error { return nil }
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type recordingStmt struct{ row []driver.Value }
+
+func (recordingStmt) Close() error { return nil }
+
+func (recordingStmt) NumInput() int { return -1 }
+
+func (recordingStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &answerRows{row: s.row}, nil
+}
+
+// answerRows returns row once, or no rows when it is nil.
+type answerRows struct{ row []driver.Value }
+
+func (r *answerRows) Columns() []string { return make([]string, len(r.row)) }
+
+func (r *answerRows) Close() error { return nil }
+
+func (r *answerRows) Next(dest []driver.Value) error {
+	if r.row == nil {
+		return io.EOF
+	}
+	copy(dest, r.row)
+	r.row = nil
+	return nil
+}
+
+// openRecordingDB returns a database whose queries find nothing, so settings
+// fall back to their defaults, and the driver recording its statements and
+// answering queries.
+func openRecordingDB(t *testing.T) (*sql.DB, *recordingDriver) {
+	t.Helper()
+	recorder := &recordingDriver{}
+	db := sql.OpenDB(recorder)
+	t.Cleanup(func() { db.Close() })
+	return db, recorder
+}
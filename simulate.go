@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simulationGasCap is the gas given to simulated calls without a limit.
+const simulationGasCap = 8_000_000
+
+// errSimulationUnsupported is returned by simulateCalls when the node neither
+// implements eth_simulateV1 nor applies state overrides to eth_call.
+var errSimulationUnsupported = errors.New("the RPC node cannot simulate transactions")
+
+// simulationBatcherCode is installed over the sender of batched calls. Its
+// calldata is a sequence of (to, value, length, data padded to 32 bytes)
+// records; it makes each call in turn and returns a (success, length,
+// return data padded to 32 bytes) record for each. Plain transfers with no
+// calldata, such as the native coin a sell pays out, are accepted.
+//
+//	    CALLDATASIZE ISZERO PUSH1 stop JUMPI PUSH1 0 PUSH1 0
+//	loop:
+//	    JUMPDEST CALLDATASIZE DUP2 LT PUSH1 body JUMPI POP PUSH1 0 RETURN
+//	body:
+//	    JUMPDEST DUP1 PUSH1 64 ADD CALLDATALOAD
+//	    DUP1 DUP3 PUSH1 96 ADD DUP5 PUSH1 64 ADD CALLDATACOPY
+//	    PUSH1 0 PUSH1 0 DUP3 DUP6 PUSH1 64 ADD DUP6 PUSH1 32 ADD CALLDATALOAD
+//	    DUP7 CALLDATALOAD GAS CALL DUP4 MSTORE
+//	    RETURNDATASIZE DUP4 PUSH1 32 ADD MSTORE
+//	    RETURNDATASIZE PUSH1 0 DUP5 PUSH1 64 ADD RETURNDATACOPY
+//	    PUSH1 31 ADD PUSH1 31 NOT AND PUSH1 96 ADD ADD SWAP1
+//	    RETURNDATASIZE PUSH1 31 ADD PUSH1 31 NOT AND PUSH1 64 ADD ADD SWAP1
+//	    PUSH1 loop JUMP
+//	stop:
+//	    JUMPDEST STOP
+var simulationBatcherCode = hexutil.Bytes(common.FromHex("0x3615606257600060005b368110601457506000f35b806040013580826060018460400137600060008285604001856020013586355af183523d83602001523d6000846040013e601f01601f191660600101903d601f01601f191660400101906009565b00"))
+
+// isMethodNotFound reports whether err is the node rejecting an unknown RPC
+// method.
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "not supported")
+}
+
+// simulationError reports a transaction that would revert if broadcast.
+type simulationError struct {
+	Reason string
+}
+
+func (e *simulationError) Error() string {
+	return "transaction would fail: " + e.Reason
+}
+
+// decodeRevertData decodes Error(string), Panic(uint256) and custom error
+// return data. It returns "" when data is not revert data.
+func decodeRevertData(data string) string {
+	raw, err := hexutil.Decode(data)
+	if err != nil || len(raw) < 4 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(raw); err == nil {
+		return reason
+	}
+	return fmt.Sprintf("custom error %s", hexutil.Encode(raw[:4]))
+}
+
+// revertReason turns an eth_call or eth_estimateGas error into a readable
+// reason.
+func revertReason(err error) string {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if reason := decodeRevertData(data); reason != "" {
+				return reason
+			}
+		}
+	}
+
+	reason := err.Error()
+	reason = strings.TrimPrefix(reason, "execution reverted: ")
+	if reason == "execution reverted" {
+		return "execution reverted without a reason"
+	}
+	return reason
+}
+
+// callMsgFromTx rebuilds the call a signed transaction makes.
+func callMsgFromTx(from common.Address, tx *types.Transaction) ethereum.CallMsg {
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		msg.GasFeeCap = tx.GasFeeCap()
+		msg.GasTipCap = tx.GasTipCap()
+	} else {
+		msg.GasPrice = tx.GasPrice()
+	}
+	return msg
+}
+
+// simulateTransaction executes a signed transaction against the latest block
+// with eth_call and eth_estimateGas and returns a simulationError when it
+// would revert or run out of gas.
+func simulateTransaction(ctx context.Context, client *ethclient.Client, from common.Address, tx *types.Transaction) error {
+	msg := callMsgFromTx(from, tx)
+	if _, err := client.CallContract(ctx, msg, nil); err != nil {
+		return &simulationError{Reason: revertReason(err)}
+	}
+	gas, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return &simulationError{Reason: revertReason(err)}
+	}
+	if gas > tx.Gas() {
+		return &simulationError{Reason: fmt.Sprintf("needs %d gas but the limit is %d", gas, tx.Gas())}
+	}
+	return nil
+}
+
+type simCall struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value,omitempty"`
+	Data  hexutil.Bytes  `json:"data"`
+	Gas   hexutil.Uint64 `json:"gas"`
+}
+
+type simAccountOverride struct {
+	Balance *hexutil.Big   `json:"balance,omitempty"`
+	Code    *hexutil.Bytes `json:"code,omitempty"`
+}
+
+type simBlock struct {
+	StateOverrides map[common.Address]simAccountOverride `json:"stateOverrides"`
+	Calls          []simCall                             `json:"calls"`
+}
+
+type simCallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Status     hexutil.Uint64 `json:"status"`
+	Error      *struct {
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+func (r simCallResult) failed() bool {
+	return r.Status == 0
+}
+
+func (r simCallResult) reason() string {
+	if r.Error == nil {
+		return "execution reverted"
+	}
+	if reason := decodeRevertData(r.Error.Data); reason != "" {
+		return reason
+	}
+	return r.Error.Message
+}
+
+// simulateCalls runs calls in sequence on top of the latest block with
+// eth_simulateV1, so each call sees the state left by the previous one. On
+// nodes without it, calls sharing a sender run through batchCalls instead.
+func simulateCalls(ctx context.Context, client *ethclient.Client, overrides map[common.Address]simAccountOverride, calls []simCall) ([]simCallResult, error) {
+	block := simBlock{StateOverrides: overrides, Calls: calls}
+	opts := map[string]interface{}{
+		"blockStateCalls": []simBlock{block},
+		"validation":      false,
+	}
+
+	var result []struct {
+		Calls []simCallResult `json:"calls"`
+	}
+	if err := client.Client().CallContext(ctx, &result, "eth_simulateV1", opts, "latest"); err != nil {
+		if isMethodNotFound(err) {
+			return batchCalls(ctx, client, overrides, calls)
+		}
+		return nil, fmt.Errorf("simulation failed: %w", err)
+	}
+	if len(result) != 1 || len(result[0].Calls) != len(calls) {
+		return nil, errors.New("simulation returned unexpected results")
+	}
+	return result[0].Calls, nil
+}
+
+// batchCalls runs calls from a single sender in one eth_call by overriding
+// the sender with simulationBatcherCode. The sender is a contract during the
+// calls, which tokens refusing contracts will notice.
+func batchCalls(ctx context.Context, client *ethclient.Client, overrides map[common.Address]simAccountOverride, calls []simCall) ([]simCallResult, error) {
+	from := calls[0].From
+	var input []byte
+	for _, call := range calls {
+		if call.From != from {
+			return nil, errSimulationUnsupported
+		}
+		value := new(big.Int)
+		if call.Value != nil {
+			value = call.Value.ToInt()
+		}
+		input = append(input, common.LeftPadBytes(call.To.Bytes(), 32)...)
+		input = append(input, common.LeftPadBytes(value.Bytes(), 32)...)
+		input = append(input, common.LeftPadBytes(big.NewInt(int64(len(call.Data))).Bytes(), 32)...)
+		input = append(input, common.RightPadBytes(call.Data, roundUp32(len(call.Data)))...)
+	}
+
+	batched := make(map[common.Address]simAccountOverride, len(overrides)+1)
+	for address, override := range overrides {
+		batched[address] = override
+	}
+	sender := batched[from]
+	sender.Code = &simulationBatcherCode
+	batched[from] = sender
+
+	args := map[string]interface{}{"from": from, "to": from, "input": hexutil.Bytes(input)}
+	var output hexutil.Bytes
+	if err := client.Client().CallContext(ctx, &output, "eth_call", args, "latest", batched); err != nil {
+		if isMethodNotFound(err) || isInvalidParams(err) {
+			return nil, errSimulationUnsupported
+		}
+		return nil, fmt.Errorf("simulation failed: %w", err)
+	}
+
+	// A node that ignores the override calls the sender's own code, which
+	// returns nothing for an account without any.
+	results := make([]simCallResult, 0, len(calls))
+	for len(results) < len(calls) {
+		if len(output) < 64 {
+			return nil, errSimulationUnsupported
+		}
+		success := new(big.Int).SetBytes(output[:32])
+		size := new(big.Int).SetBytes(output[32:64])
+		if !size.IsInt64() || size.Int64() > int64(len(output)-64) {
+			return nil, errors.New("simulation returned unexpected results")
+		}
+		data := output[64 : 64+size.Int64()]
+		result := simCallResult{ReturnData: append(hexutil.Bytes{}, data...), Status: hexutil.Uint64(success.Uint64())}
+		if result.failed() {
+			result.Error = &struct {
+				Message string `json:"message"`
+				Data    string `json:"data"`
+			}{Message: "execution reverted", Data: hexutil.Encode(data)}
+		}
+		results = append(results, result)
+		output = output[min(64+roundUp32(len(data)), len(output)):]
+	}
+	return results, nil
+}
+
+// roundUp32 rounds n up to a whole number of 32-byte words.
+func roundUp32(n int) int {
+	return (n + 31) / 32 * 32
+}
+
+// isInvalidParams reports whether err is the node rejecting the parameters
+// of an RPC call, as nodes without state overrides do.
+func isInvalidParams(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32602 {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "too many arguments")
+}
+
+// pendingCall replays a pending transaction as a simulation call.
+func pendingCall(tx *types.Transaction) (simCall, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return simCall{}, err
+	}
+	if tx.To() == nil {
+		return simCall{}, errors.New("contract creations cannot be replayed")
+	}
+	return simCall{From: from, To: *tx.To(), Value: (*hexutil.Big)(tx.Value()), Data: tx.Data(), Gas: hexutil.Uint64(tx.Gas())}, nil
+}
+
+// errPendingReverts is returned by simulateBehind when the pending
+// transaction the calls run behind reverts.
+var errPendingReverts = errors.New("pending transaction reverts")
+
+// simulateBehind runs calls like simulateCalls, on top of the pending
+// transaction after when it is set, and returns the results of calls only.
+func simulateBehind(ctx context.Context, client *ethclient.Client, overrides map[common.Address]simAccountOverride, after *types.Transaction, calls []simCall) ([]simCallResult, error) {
+	if after == nil {
+		return simulateCalls(ctx, client, overrides, calls)
+	}
+	first, err := pendingCall(after)
+	if err != nil {
+		return nil, err
+	}
+	results, err := simulateCalls(ctx, client, overrides, append([]simCall{first}, calls...))
+	if err != nil {
+		return nil, err
+	}
+	if results[0].failed() {
+		return nil, fmt.Errorf("%w: %s", errPendingReverts, results[0].reason())
+	}
+	return results[1:], nil
+}
+
+// simulateAfter executes msg on top of the latest block after the pending
+// transaction prior and returns the gas it used, or a simulationError when it
+// would revert.
+func simulateAfter(ctx context.Context, client *ethclient.Client, prior *types.Transaction, msg ethereum.CallMsg) (uint64, error) {
+	first, err := pendingCall(prior)
+	if err != nil {
+		return 0, err
+	}
+	call := simCall{From: msg.From, To: *msg.To, Value: (*hexutil.Big)(msg.Value), Data: msg.Data, Gas: hexutil.Uint64(msg.Gas)}
+	if call.Gas == 0 {
+		call.Gas = simulationGasCap
+	}
+	results, err := simulateCalls(ctx, client, nil, []simCall{first, call})
+	if err != nil {
+		return 0, err
+	}
+	if results[0].failed() {
+		return 0, &simulationError{Reason: "the pending transaction reverts: " + results[0].reason()}
+	}
+	if results[1].failed() {
+		return 0, &simulationError{Reason: results[1].reason()}
+	}
+	return uint64(results[1].GasUsed), nil
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	// sniperReloadInterval is how often active targets are re-read, and how
+	// long the sniper waits before resubscribing.
+	sniperReloadInterval = 15 * time.Second
+	// snipeTimeout bounds a snipe from the liquidity event to the sent buys.
+	snipeTimeout = 2 * time.Minute
+)
+
+var (
+	pairCreatedTopic = crypto.Keccak256Hash([]byte("PairCreated(address,address,address,uint256)"))
+	pairMintTopic    = crypto.Keccak256Hash([]byte("Mint(address,uint256,uint256)"))
+)
+
+// runSniper watches the active chain for liquidity being added to snipe
+// targets until ctx is cancelled.
+func (a *application) runSniper(ctx context.Context) {
+	for {
+		if err := a.watchLiquidity(ctx); err != nil {
+			log.Printf("Sniper watch stopped: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sniperReloadInterval):
+		}
+	}
+}
+
+func snipeTargetIDs(targets []*models.SnipeTarget) string {
+	ids := make([]string, len(targets))
+	for i, target := range targets {
+		ids[i] = target.ID.String()
+	}
+	return strings.Join(ids, ",")
+}
+
+// launchWatch tracks where each token of the active targets is on its way
+// to being tradable.
+type launchWatch struct {
+	byToken map[common.Address][]*models.SnipeTarget
+	// pairs maps pairs without liquidity yet to their token.
+	pairs map[common.Address]common.Address
+	// unfunded holds tokens without liquidity on a chain with V3, which
+	// are checked every block as V3 pools are not subscribed to.
+	unfunded map[common.Address]bool
+	// launching holds tokens with liquidity whose trading is still closed.
+	launching map[common.Address]bool
+	// unprobed holds launching tokens the node cannot simulate a buy of;
+	// they launch on a mined trading-enable call instead.
+	unprobed map[common.Address]bool
+	// fired is set once a launch has fired snipes, so that a backrun that
+	// left its target active rebuilds the watch.
+	fired bool
+}
+
+// hasLiquidity reports whether token has a V3 pool with liquidity in range
+// or a funded V2 pair, and otherwise remembers where to look for it.
+func hasLiquidity(ctx context.Context, client *ethclient.Client, cfg chainConfig, watch *launchWatch, token common.Address) (bool, error) {
+	v3, err := quoteV3(ctx, client, cfg, common.HexToAddress(cfg.WrappedNative), token, safetyProbeAmount)
+	if err != nil {
+		return false, err
+	}
+	if v3 != nil {
+		delete(watch.unfunded, token)
+		return true, nil
+	}
+	if cfg.hasV3() {
+		watch.unfunded[token] = true
+	}
+
+	pair, err := findV2Pair(ctx, client, cfg, token)
+	if err != nil {
+		if errors.Is(err, errNoPair) {
+			return false, nil
+		}
+		return false, err
+	}
+	if pair.NativeReserve.Sign() == 0 {
+		watch.pairs[pair.Address] = token
+		return false, nil
+	}
+	delete(watch.pairs, pair.Address)
+	delete(watch.unfunded, token)
+	return true, nil
+}
+
+// checkLaunch buys token when it has liquidity and trading is open, and
+// otherwise remembers which of the two it is waiting for.
+func (a *application) checkLaunch(ctx context.Context, client *ethclient.Client, cfg chainConfig, watch *launchWatch, token common.Address) error {
+	funded, err := hasLiquidity(ctx, client, cfg, watch, token)
+	if err != nil || !funded {
+		return err
+	}
+
+	// Liquidity alone is not enough: a probe that cannot run keeps the token
+	// waiting for a trading-enable call.
+	live, err := tradingLive(ctx, client, cfg, token, nil)
+	if err != nil {
+		log.Printf("Error probing trading of %s: %v", token.Hex(), err)
+		watch.unprobed[token] = errors.Is(err, errSimulationUnsupported)
+	}
+	if !live {
+		watch.launching[token] = true
+		return nil
+	}
+	a.launched(cfg, watch, token)
+	return nil
+}
+
+// launched fires the snipes of token once its trading is open.
+func (a *application) launched(cfg chainConfig, watch *launchWatch, token common.Address) {
+	delete(watch.launching, token)
+	delete(watch.unprobed, token)
+	watch.fired = true
+	a.fireSnipes(cfg, watch.byToken[token], nil)
+}
+
+// checkEnabledInBlock launches the unprobed tokens a trading-enable call in
+// the block with hash opened.
+func (a *application) checkEnabledInBlock(ctx context.Context, client *ethclient.Client, cfg chainConfig, watch *launchWatch, hash common.Hash) error {
+	if len(watch.unprobed) == 0 {
+		return nil
+	}
+	block, err := client.BlockByHash(ctx, hash)
+	if err != nil {
+		return err
+	}
+	for token := range watch.unprobed {
+		enabled, err := enabledInBlock(ctx, client, block, token)
+		if err != nil {
+			return err
+		}
+		if enabled {
+			a.launched(cfg, watch, token)
+		}
+	}
+	return nil
+}
+
+// watchLiquidity subscribes to PairCreated on the V2 factory and Mint on the
+// pairs of active targets, checks for V3 liquidity every block, and once a
+// token has liquidity probes every block with a simulated buy until trading
+// opens. Buys are sent as soon as the block opening trading is seen, so they
+// land in the next block. With Alpha Mode on, pending trading-enable calls
+// on any target token, including ones that add its liquidity, are backrun in
+// the same block instead. It returns when the targets change so the
+// subscriptions can be rebuilt.
+func (a *application) watchLiquidity(ctx context.Context) error {
+	cfg, err := a.currentChain()
+	if err != nil {
+		return err
+	}
+	if !cfg.isEVM() || !cfg.hasDEX() {
+		return nil
+	}
+	targets, err := database.GetActiveSnipeTargets(a.db, cfg.Name)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+	if cfg.WSURL == "" {
+		return fmt.Errorf("set %s_WS_URL to snipe on %s", cfg.envPrefix(), cfg.Name)
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	watch := &launchWatch{
+		byToken:   make(map[common.Address][]*models.SnipeTarget),
+		pairs:     make(map[common.Address]common.Address),
+		unfunded:  make(map[common.Address]bool),
+		launching: make(map[common.Address]bool),
+		unprobed:  make(map[common.Address]bool),
+	}
+	for _, target := range targets {
+		token := common.HexToAddress(target.TokenAddress)
+		watch.byToken[token] = append(watch.byToken[token], target)
+	}
+	for token := range watch.byToken {
+		if err := a.checkLaunch(ctx, client, cfg, watch, token); err != nil {
+			log.Printf("Error checking launch of %s: %v", token.Hex(), err)
+		}
+	}
+
+	wsClient, err := ethclient.DialContext(ctx, cfg.WSURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s websocket: %w", cfg.Name, err)
+	}
+	defer wsClient.Close()
+
+	addresses := []common.Address{common.HexToAddress(cfg.V2Factory)}
+	for pair := range watch.pairs {
+		addresses = append(addresses, pair)
+	}
+	logs := make(chan types.Log, 64)
+	logSub, err := wsClient.SubscribeFilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: addresses,
+		Topics:    [][]common.Hash{{pairCreatedTopic, pairMintTopic}},
+	}, logs)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to liquidity events: %w", err)
+	}
+	defer logSub.Unsubscribe()
+
+	heads := make(chan *types.Header, 16)
+	headSub, err := wsClient.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to new blocks: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	// The pending stream is optional; a nil channel never delivers.
+	var pending <-chan *mempoolEvent
+	if a.defaultSettings().AlphaMode {
+		pool, err := a.mempool(cfg)
+		if err != nil {
+			log.Printf("Alpha Mode unavailable on %s: %v", cfg.Name, err)
+		} else {
+			var unsubscribe func()
+			pending, unsubscribe = pool.subscribe(isTradingEnableCall)
+			defer unsubscribe()
+		}
+	}
+
+	reload := time.NewTicker(sniperReloadInterval)
+	defer reload.Stop()
+
+	watched := snipeTargetIDs(targets)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-logSub.Err():
+			return subscriptionEnded(err)
+		case err := <-headSub.Err():
+			return subscriptionEnded(err)
+		case <-reload.C:
+			current, err := database.GetActiveSnipeTargets(a.db, cfg.Name)
+			if err != nil {
+				return err
+			}
+			if snipeTargetIDs(current) != watched || watch.fired {
+				return nil
+			}
+		case head := <-heads:
+			if err := a.checkEnabledInBlock(ctx, client, cfg, watch, head.Hash()); err != nil {
+				log.Printf("Error checking block %s for trading-enable calls: %v", head.Number, err)
+			}
+			for token := range watch.launching {
+				if watch.unprobed[token] {
+					continue
+				}
+				if err := a.checkLaunch(ctx, client, cfg, watch, token); err != nil {
+					log.Printf("Error checking launch of %s: %v", token.Hex(), err)
+				}
+			}
+			for token := range watch.unfunded {
+				if err := a.checkLaunch(ctx, client, cfg, watch, token); err != nil {
+					log.Printf("Error checking launch of %s: %v", token.Hex(), err)
+				}
+			}
+		case e := <-pending:
+			// Anyone can send a trading-enable call that reverts, so only
+			// backrun one a probe buy succeeds behind. The call may add the
+			// liquidity too, so every watched token is probed, whatever it
+			// is waiting for; it stays watched in case the backrun is not
+			// sent.
+			for token := range watch.byToken {
+				if !isTradingEnable(e.Tx, token) {
+					continue
+				}
+				live, err := tradingLive(ctx, client, cfg, token, e.Tx)
+				if err != nil {
+					log.Printf("Error probing trading-enable %s of %s: %v", e.Tx.Hash().Hex(), token.Hex(), err)
+					continue
+				}
+				if live {
+					a.fireSnipes(cfg, watch.byToken[token], e.Tx)
+				}
+			}
+		case event := <-logs:
+			if event.Removed || len(event.Topics) == 0 {
+				continue
+			}
+			if event.Topics[0] == pairMintTopic {
+				if token, ok := watch.pairs[event.Address]; ok {
+					if err := a.checkLaunch(ctx, client, cfg, watch, token); err != nil {
+						log.Printf("Error checking launch of %s: %v", token.Hex(), err)
+					}
+				}
+				continue
+			}
+			if event.Topics[0] != pairCreatedTopic || len(event.Topics) < 3 {
+				continue
+			}
+			// A pair created and funded in one transaction never emits a
+			// Mint the subscription sees, so check it directly; an empty
+			// pair is added to the subscription by returning.
+			for _, topic := range event.Topics[1:3] {
+				token := common.BytesToAddress(topic.Bytes())
+				if _, ok := watch.byToken[token]; !ok {
+					continue
+				}
+				watchedPairs := len(watch.pairs)
+				if err := a.checkLaunch(ctx, client, cfg, watch, token); err != nil {
+					return err
+				}
+				if len(watch.pairs) > watchedPairs {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func subscriptionEnded(err error) error {
+	if err == nil {
+		return errors.New("subscription closed")
+	}
+	return err
+}
+
+// fireSnipes claims each still-active target and buys it in the background,
+// as a backrun of after when it is set.
+func (a *application) fireSnipes(cfg chainConfig, targets []*models.SnipeTarget, after *types.Transaction) {
+	for _, target := range targets {
+		claimed, err := database.UpdateSnipeTargetStatus(a.db, target.ID, database.SnipeStatusActive, database.SnipeStatusSniped)
+		if err != nil || !claimed {
+			continue
+		}
+		go a.executeSnipe(cfg, target, after)
+	}
+}
+
+// executeSnipe buys a target from its wallets and reports to its chat.
+func (a *application) executeSnipe(cfg chainConfig, target *models.SnipeTarget, after *types.Transaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), snipeTimeout)
+	defer cancel()
+
+	results, info, err := a.snipe(ctx, cfg, target, after)
+	if err == nil && !anySucceeded(results) {
+		err = errors.New("no buy was sent")
+	}
+	if err != nil && after != nil && !anySucceeded(results) {
+		// Nothing was sent for the backrun; leave the target for the
+		// block watcher to buy once trading is open.
+		log.Printf("Alpha Mode backrun of %s for target %s not sent: %v", after.Hash().Hex(), target.ID, err)
+		database.UpdateSnipeTargetStatus(a.db, target.ID, database.SnipeStatusSniped, database.SnipeStatusActive)
+		return
+	}
+	if err != nil {
+		database.UpdateSnipeTargetStatus(a.db, target.ID, database.SnipeStatusSniped, database.SnipeStatusFailed)
+	}
+
+	symbol := shortAddress(target.TokenAddress)
+	if info != nil {
+		symbol = info.Symbol
+	}
+	outcome := formatSwapResults(cfg, results)
+	if err != nil {
+		outcome += "❌ " + markdownEscaper.Replace(err.Error())
+	}
+	trigger := "Trading is live for " + target.TokenAddress + "."
+	if after != nil {
+		trigger = fmt.Sprintf("Alpha Mode: backrunning the trading-enable [transaction](%s) of %s.", cfg.txURL(after.Hash().Hex()), target.TokenAddress)
+	}
+	snipeMsg := fmt.Sprintf(`🚀 Sniped %s (🔗%s)
+
+%s
+Buying %s %s per wallet:
+
+%s`, markdownEscaper.Replace(symbol), cfg.Name, trigger, target.Amount, cfg.NativeSymbol, outcome)
+
+	a.client.SendMessage(target.ChatID, snipeMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
+
+// snipe buys a target. A backrun of after is priced like it so it lands in
+// the same block, overriding the target's gas.
+func (a *application) snipe(ctx context.Context, cfg chainConfig, target *models.SnipeTarget, after *types.Transaction) ([]swapResult, *tokenInfo, error) {
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := readTokenInfo(ctx, client, common.HexToAddress(target.TokenAddress))
+	if err != nil {
+		return nil, nil, err
+	}
+	amountIn, err := parseUnits(target.Amount, 18)
+	if err != nil {
+		return nil, info, err
+	}
+
+	wallets := a.walletsByAddress(target.Wallets)
+	if len(wallets) == 0 {
+		return nil, info, errors.New("none of the target's wallets exist any more")
+	}
+
+	opts := buyOptions{MaxTax: target.MaxTax, After: after}
+	if after != nil {
+		opts.Fees = matchFees(after)
+	} else if target.GasGwei > 0 {
+		if opts.Fees, err = presetFees(ctx, client, target.GasGwei); err != nil {
+			return nil, info, err
+		}
+	}
+	results, _, err := a.buyToken(ctx, cfg, target.ChatID, info, amountIn, wallets, opts)
+	return results, info, err
+}
+
+func anySucceeded(results []swapResult) bool {
+	for _, result := range results {
+		if result.Err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *application) autoSniperHandler(m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	targets, err := database.GetChatSnipeTargets(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting snipe targets: %v", err)
+	}
+	wallets, err := database.GetDefaultWallets(a.db, m.Chat.ID, database.DefaultWalletsSnipe)
+	if err != nil {
+		log.Printf("Error getting snipe wallets: %v", err)
+	}
+
+	var targetList strings.Builder
+	var cancelButtons [][]tbot.InlineKeyboardButton
+	for i, target := range targets {
+		gas := "preset"
+		if target.GasGwei > 0 {
+			gas = fmt.Sprintf("%.2f gwei", target.GasGwei)
+		}
+		maxTax := "defaults"
+		if target.MaxTax > 0 {
+			maxTax = fmt.Sprintf("%.1f%%", target.MaxTax)
+		}
+		targetList.WriteString(fmt.Sprintf("%d. %s (🔗%s)\n   %s %s x %d wallets, gas %s, max tax %s\n",
+			i+1, target.TokenAddress, target.Chain, target.Amount, cfg.NativeSymbol, len(target.Wallets), gas, maxTax))
+		cancelButtons = append(cancelButtons, []tbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("❌ Cancel %d", i+1), CallbackData: "snipe_cancel_" + target.ID.String()},
+		})
+	}
+	if len(targets) == 0 {
+		targetList.WriteString("No active targets.\n")
+	}
+
+	sniperMsg := fmt.Sprintf(`🚀 Auto Sniper (🔗%s)
+
+Buys a token as soon as liquidity is added for it.
+Snipe wallets selected: %d
+
+Targets:
+%s`, cfg.Name, len(wallets), targetList.String())
+
+	buttons := append(cancelButtons,
+		[]tbot.InlineKeyboardButton{{Text: "➕ Add Target", CallbackData: "snipe_add"}},
+		[]tbot.InlineKeyboardButton{{Text: "Snipe Wallets", CallbackData: "snipe_wallets"}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "back_to_mainboard"}},
+	)
+	a.client.SendMessage(m.Chat.ID, sniperMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) snipeAddHandler(m *tbot.Message) {
+	a.waitingForSnipeTarget = true
+	a.client.SendMessage(m.Chat.ID, `Send the target as:
+<token address> <amount per wallet> [gas gwei] [max tax %]
+
+For example: 0x1234...abcd 0.1 30 10
+Gas 0 uses your gas preset; max tax 0 uses your default tax limits.`)
+}
+
+// snipeTargetInputHandler registers the target entered after "Add Target"
+// for the snipe wallets currently selected.
+func (a *application) snipeTargetInputHandler(m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if !cfg.isEVM() || !cfg.hasDEX() {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Sniping is not available on %s.", cfg.Name))
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	if len(fields) < 2 || len(fields) > 4 || !isEVMAddress(fields[0]) {
+		a.client.SendMessage(m.Chat.ID, "Invalid target. Expected: <token address> <amount> [gas gwei] [max tax %]")
+		return
+	}
+	if amount, err := parseUnits(fields[1], 18); err != nil || amount.Sign() <= 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", fields[1]))
+		return
+	}
+	target := &models.SnipeTarget{
+		ChatID:       m.Chat.ID,
+		Chain:        cfg.Name,
+		TokenAddress: common.HexToAddress(fields[0]).Hex(),
+		Amount:       fields[1],
+	}
+	if len(fields) > 2 {
+		if target.GasGwei, err = strconv.ParseFloat(fields[2], 64); err != nil || target.GasGwei < 0 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid gas %q.", fields[2]))
+			return
+		}
+	}
+	if len(fields) > 3 {
+		if target.MaxTax, err = strconv.ParseFloat(strings.TrimSuffix(fields[3], "%"), 64); err != nil || target.MaxTax < 0 || target.MaxTax > 100 {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid max tax %q.", fields[3]))
+			return
+		}
+	}
+
+	if target.Wallets, err = database.GetDefaultWallets(a.db, m.Chat.ID, database.DefaultWalletsSnipe); err != nil {
+		log.Printf("Error getting snipe wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if len(target.Wallets) == 0 {
+		a.client.SendMessage(m.Chat.ID, "No snipe wallets selected. Choose them with Snipe Wallets first.")
+		return
+	}
+	if err := database.CreateSnipeTarget(a.db, target); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save the target.")
+		return
+	}
+	a.autoSniperHandler(m)
+}
+
+// snipeCancelHandler cancels one of the chat's active targets by ID.
+func (a *application) snipeCancelHandler(id string, m *tbot.Message) {
+	targetID, err := uuid.Parse(id)
+	if err != nil {
+		log.Printf("Invalid snipe target id: %s", id)
+		return
+	}
+	targets, err := database.GetChatSnipeTargets(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting snipe targets: %v", err)
+		return
+	}
+	for _, target := range targets {
+		if target.ID != targetID {
+			continue
+		}
+		if cancelled, _ := database.UpdateSnipeTargetStatus(a.db, targetID, database.SnipeStatusActive, database.SnipeStatusCancelled); !cancelled {
+			a.client.SendMessage(m.Chat.ID, "That target has already fired.")
+		}
+		break
+	}
+	a.autoSniperHandler(m)
+}
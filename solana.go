@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+type solanaRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type solanaRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// solanaRPC calls a Solana JSON-RPC method and decodes its result into out.
+func solanaRPC(ctx context.Context, cfg chainConfig, method string, params []interface{}, out interface{}) error {
+	requestData, err := json.Marshal(solanaRPCRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.RPCURL, bytes.NewReader(requestData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Result json.RawMessage `json:"result"`
+		Error  *solanaRPCError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if body.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, body.Error.Message)
+	}
+	return json.Unmarshal(body.Result, out)
+}
+
+// solanaTokenSupply returns the total supply and decimals of an SPL mint.
+func solanaTokenSupply(ctx context.Context, cfg chainConfig, mint string) (*big.Int, uint8, error) {
+	var result struct {
+		Value struct {
+			Amount   string `json:"amount"`
+			Decimals uint8  `json:"decimals"`
+		} `json:"value"`
+	}
+	if err := solanaRPC(ctx, cfg, "getTokenSupply", []interface{}{mint}, &result); err != nil {
+		return nil, 0, err
+	}
+	supply, ok := new(big.Int).SetString(result.Value.Amount, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid supply %q", result.Value.Amount)
+	}
+	return supply, result.Value.Decimals, nil
+}
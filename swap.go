@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// swapDeadline is how long a swap may wait in the mempool before the router
+// rejects it.
+const swapDeadline = 20 * time.Minute
+
+// defaultSettings returns the saved trading defaults, falling back to the
+// values the Defaults screen starts with.
+func (a *application) defaultSettings() *models.DefaultSettings {
+	settings, err := database.GetDefaultSettings(a.db)
+	if err != nil {
+		log.Printf("Error getting default settings: %v", err)
+	}
+	if len(settings) > 0 {
+		return settings[0]
+	}
+	return &models.DefaultSettings{
+		Slippage:      10,
+		SellGweiExtra: 7.00,
+		ApproveGwei:   7.00,
+		BuyTax:        100.00,
+		SellTax:       100.00,
+		MinLiquidity:  150,
+	}
+}
+
+// tradingWallets returns the chat's wallets selected for purpose.
+func (a *application) tradingWallets(chatID, purpose string) ([]*models.Wallet, error) {
+	addresses, err := database.GetDefaultWallets(a.db, chatID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	return a.walletsByAddress(addresses), nil
+}
+
+// walletsByAddress loads the wallets with the given addresses, skipping any
+// that no longer exist.
+func (a *application) walletsByAddress(addresses []string) []*models.Wallet {
+	var wallets []*models.Wallet
+	for _, address := range addresses {
+		wallet, err := database.GetWalletByAddress(a.db, address)
+		if err != nil {
+			log.Printf("Error getting wallet %s: %v", address, err)
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets
+}
+
+// swapResult is the outcome of a swap sent from one wallet.
+type swapResult struct {
+	Wallet *models.Wallet
+	Route  *swapRoute
+	// AmountIn is what the swap spends: native coin for a buy, tokens for a
+	// sell. A split buy has one result per transaction.
+	AmountIn *big.Int
+	Tx       *types.Transaction
+	Err      error
+}
+
+// buyQuote is what a buy was checked and priced against.
+type buyQuote struct {
+	Route  *swapRoute
+	Pool   *poolHealth
+	Safety *tokenSafety
+	// SafetySkipped is set when the node could not simulate the honeypot
+	// and tax check and UncheckedBuys let the buy go ahead without it.
+	SafetySkipped bool
+}
+
+// buyOptions override the chat's defaults for one buy.
+type buyOptions struct {
+	// Fees prices the swaps; nil uses the chat's gas preset.
+	Fees *feeQuote
+	// MaxTax replaces both the BuyTax and SellTax limits when above 0.
+	MaxTax float64
+	// MinLiquidity replaces the MinLiquidity default when above 0.
+	MinLiquidity int
+	// After makes the buy a backrun of a pending transaction: it is
+	// simulated on top of it and should be priced to land right behind it.
+	After *types.Transaction
+}
+
+// buyToken swaps amountIn of the native coin for token from every wallet
+// through the best V2 or V3 route and records each sent swap as a trade.
+func (a *application) buyToken(ctx context.Context, cfg chainConfig, chatID string, token *tokenInfo, amountIn *big.Int, wallets []*models.Wallet, opts buyOptions) ([]swapResult, *buyQuote, error) {
+	if !cfg.hasDEX() && !cfg.hasV3() {
+		return nil, nil, fmt.Errorf("no DEX is configured for %s", cfg.Name)
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A backrun is quoted behind the transaction it follows, which may be
+	// the one adding the liquidity.
+	route, err := bestRouteAfter(ctx, client, cfg, common.HexToAddress(cfg.WrappedNative), token.Address, amountIn, opts.After)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to quote swap: %w", err)
+	}
+	settings := a.defaultSettings()
+	if opts.MaxTax > 0 {
+		settings.BuyTax, settings.SellTax = float32(opts.MaxTax), float32(opts.MaxTax)
+	}
+	if opts.MinLiquidity > 0 {
+		settings.MinLiquidity = opts.MinLiquidity
+	}
+	quote := &buyQuote{Route: route}
+
+	if quote.Pool, err = checkPoolAfter(ctx, client, cfg, token, route, opts.After); err != nil {
+		return nil, nil, fmt.Errorf("failed to read pool: %w", err)
+	}
+	if quote.Pool.belowMinimum(settings.MinLiquidity) {
+		return nil, nil, fmt.Errorf("pool liquidity %s is below your minimum of $%d", formatUSD(quote.Pool.PairedUSD), settings.MinLiquidity)
+	}
+
+	// Buying without the check on a node that cannot simulate it takes the
+	// UncheckedBuys opt-in; any other failure refuses the buy.
+	quote.Safety, err = analyzeTokenSafety(ctx, client, cfg, token, route, amountIn, opts.After)
+	switch {
+	case errors.Is(err, errSimulationUnsupported) && settings.UncheckedBuys:
+		log.Printf("Skipping safety check of %s on %s: %v", token.Address.Hex(), cfg.Name, err)
+		quote.SafetySkipped = true
+	case errors.Is(err, errSimulationUnsupported):
+		return nil, nil, fmt.Errorf("the %s RPC cannot run the honeypot and tax check; turn on Unchecked Buys in Settings > Defaults to buy without it", cfg.Name)
+	case err != nil:
+		return nil, nil, fmt.Errorf("safety check failed: %w", err)
+	default:
+		if reason := quote.Safety.violation(settings); reason != "" {
+			return nil, nil, fmt.Errorf("blocked by safety check: %s", reason)
+		}
+	}
+
+	// With MaxTx or Revert on, buys over the token's limits are split into
+	// max-size transactions; otherwise they are refused before sending.
+	plan, err := planBuys(ctx, client, token, route, amountIn, wallets, readTradeLimits(ctx, client, token.Address), settings.MultitxOrRevert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fees := opts.Fees
+	if fees == nil {
+		if fees, err = a.chatFees(ctx, client, cfg, chatID); err != nil {
+			return nil, nil, err
+		}
+	}
+	deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+
+	var results []swapResult
+	for _, buy := range plan {
+		wallet := buy.Wallet
+		result := swapResult{Wallet: wallet, Route: route, AmountIn: buy.AmountIn}
+		key, err := loadPrivateKey(wallet)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		// The quote does not know about the token's own tax, so the
+		// minimum is taken from what the safety check saw arrive.
+		expected := new(big.Int).Mul(route.AmountOut, buy.AmountIn)
+		expected.Div(expected, amountIn)
+		if quote.Safety != nil {
+			expected = quote.Safety.afterBuyTax(expected)
+		}
+		minOut := applySlippage(expected, settings.Slippage)
+		data, err := route.buyData(cfg, token.Address, buy.AmountIn, minOut, common.HexToAddress(wallet.Address), deadline)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		result.Tx, result.Err = a.sendTransactionAfter(ctx, client, cfg, key, route.Router, buy.AmountIn, data, fees, opts.After)
+		results = append(results, result)
+		if result.Err != nil {
+			continue
+		}
+
+		database.AddWalletToken(a.db, cfg.Name, wallet.Address, token.Address.Hex())
+		database.CreateTrade(a.db, &models.Trade{
+			ChatID:        chatID,
+			Chain:         cfg.Name,
+			WalletAddress: wallet.Address,
+			TokenAddress:  token.Address.Hex(),
+			Side:          database.TradeSideBuy,
+			Route:         route.String(),
+			NativeAmount:  buy.AmountIn.String(),
+			TokenAmount:   minOut.String(),
+			TxHash:        result.Tx.Hash().Hex(),
+			Status:        database.TransferStatusPending,
+		})
+	}
+	return results, quote, nil
+}
+
+func formatSwapResults(cfg chainConfig, results []swapResult) string {
+	var lines strings.Builder
+	for _, result := range results {
+		if result.Err != nil {
+			lines.WriteString(fmt.Sprintf("❌ %s: %s\n", shortAddress(result.Wallet.Address), markdownEscaper.Replace(result.Err.Error())))
+			continue
+		}
+		route := ""
+		if result.Route != nil {
+			route = fmt.Sprintf(" via %s", result.Route)
+		}
+		lines.WriteString(fmt.Sprintf("✅ %s: [transaction](%s)%s\n", shortAddress(result.Wallet.Address), cfg.txURL(result.Tx.Hash().Hex()), route))
+	}
+	return lines.String()
+}
+
+func (a *application) manualBuyerHandler(m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	wallets, err := a.tradingWallets(m.Chat.ID, database.DefaultWalletsManualBuy)
+	if err != nil {
+		log.Printf("Error getting manual buy wallets: %v", err)
+	}
+
+	var walletDetails strings.Builder
+	for i, wallet := range wallets {
+		walletDetails.WriteString(fmt.Sprintf("%d: %s\n", i+1, wallet.Address))
+	}
+	if len(wallets) == 0 {
+		walletDetails.WriteString("No wallets selected.\n")
+	}
+
+	gas := "Network"
+	if gasGwei, _ := database.GetGasPreset(a.db, m.Chat.ID, cfg.Name); gasGwei > 0 {
+		gas = fmt.Sprintf("%.2f gwei", gasGwei)
+	}
+
+	buyerMsg := fmt.Sprintf(`Manual Buyer (🔗%s)
+
+Buying from:
+%s
+Slippage: %d%%
+Gas: %s
+
+Paste a token contract address to open its card and buy.`, cfg.Name, walletDetails.String(), a.defaultSettings().Slippage, gas)
+
+	buttons := &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tbot.InlineKeyboardButton{
+			{{Text: "Manual Buy Wallets", CallbackData: "manual_buy_wallets"}},
+			{{Text: "⛽Gas Buttons", CallbackData: "gas_preset_buttons"}},
+			{{Text: "Back", CallbackData: "back_to_mainboard"}},
+		},
+	}
+	a.client.SendMessage(m.Chat.ID, buyerMsg, tbot.OptInlineKeyboardMarkup(buttons))
+}
+
+// tokenBuyHandler handles a buy button of a token card. data is
+// "<amount>_<token>", where an amount of "x" asks for a custom amount.
+func (a *application) tokenBuyHandler(data string, m *tbot.Message) {
+	amount, token, ok := strings.Cut(data, "_")
+	if !ok || !common.IsHexAddress(token) {
+		log.Printf("Invalid buy callback: %s", data)
+		return
+	}
+
+	if amount == "x" {
+		a.draftsMu.Lock()
+		if a.buyDrafts == nil {
+			a.buyDrafts = make(map[string]string)
+		}
+		a.buyDrafts[m.Chat.ID] = token
+		a.draftsMu.Unlock()
+
+		a.waitingForBuyAmount = true
+		a.client.SendMessage(m.Chat.ID, "Enter the amount you would like to buy with:")
+		return
+	}
+	a.executeBuy(token, amount, m)
+}
+
+// tokenBuyAmountHandler buys with the custom amount entered after "Buy X".
+func (a *application) tokenBuyAmountHandler(m *tbot.Message) {
+	a.draftsMu.Lock()
+	token, ok := a.buyDrafts[m.Chat.ID]
+	delete(a.buyDrafts, m.Chat.ID)
+	a.draftsMu.Unlock()
+
+	if !ok {
+		a.client.SendMessage(m.Chat.ID, "Buy expired. Please paste the contract address again.")
+		return
+	}
+	a.executeBuy(token, strings.TrimSpace(m.Text), m)
+}
+
+// executeBuy buys token for amountText of the native coin from each of the
+// chat's manual buy wallets and reports the per-wallet results.
+func (a *application) executeBuy(token, amountText string, m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	amountIn, err := parseUnits(amountText, 18)
+	if err != nil || amountIn.Sign() <= 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Invalid amount %q.", amountText))
+		return
+	}
+
+	wallets, err := a.tradingWallets(m.Chat.ID, database.DefaultWalletsManualBuy)
+	if err != nil {
+		log.Printf("Error getting manual buy wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if len(wallets) == 0 {
+		a.client.SendMessage(m.Chat.ID, "No manual buy wallets selected. Choose them in Settings > Wallets > Default Wallets.")
+		return
+	}
+	a.confirmBuy(cfg, token, amountIn, wallets, buyOptions{}, m)
+}
+
+// confirmBuy runs buyAndReport, asking the chat to confirm the buy first
+// when it has Trade Confirmation on.
+func (a *application) confirmBuy(cfg chainConfig, token string, amountIn *big.Int, wallets []*models.Wallet, opts buyOptions, m *tbot.Message) {
+	a.confirmTrade(m, func() (string, error) {
+		return a.buyPreview(cfg, m.Chat.ID, token, amountIn, wallets)
+	}, func() {
+		a.buyAndReport(cfg, token, amountIn, wallets, opts, m)
+	})
+}
+
+// buyPreview summarizes a buy of token for amountIn from each wallet.
+func (a *application) buyPreview(cfg chainConfig, chatID, token string, amountIn *big.Int, wallets []*models.Wallet) (string, error) {
+	if !cfg.hasDEX() && !cfg.hasV3() {
+		return "", fmt.Errorf("no DEX is configured for %s", cfg.Name)
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := readTokenInfo(ctx, client, common.HexToAddress(token))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	wrapped := common.HexToAddress(cfg.WrappedNative)
+	route, err := bestRoute(ctx, client, cfg, wrapped, info.Address, amountIn)
+	if err != nil {
+		return "", fmt.Errorf("failed to quote swap: %w", err)
+	}
+	impact, err := route.priceImpact(ctx, client, cfg, wrapped, info.Address, amountIn)
+	if err != nil {
+		return "", fmt.Errorf("failed to quote price impact: %w", err)
+	}
+	fees, err := a.chatFees(ctx, client, cfg, chatID)
+	if err == nil && fees == nil {
+		fees, err = suggestFees(ctx, client)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	from := common.HexToAddress(wallets[0].Address)
+	deadline := big.NewInt(time.Now().Add(swapDeadline).Unix())
+	data, err := route.buyData(cfg, info.Address, amountIn, new(big.Int), from, deadline)
+	if err != nil {
+		return "", err
+	}
+	gas := gasSummary(ctx, client, cfg, fees, ethereum.CallMsg{From: from, To: &route.Router, Value: amountIn, Data: data})
+
+	var addresses []string
+	for _, wallet := range wallets {
+		addresses = append(addresses, shortAddress(wallet.Address))
+	}
+	return fmt.Sprintf(`🛒 Confirm buy of %s (🔗%s)
+
+Wallets: %s
+Spend per wallet: %s %s
+Expected per wallet: %s %s
+Route: %s
+Price impact: %.2f%%
+Slippage: %d%%
+Gas: %s`, markdownEscaper.Replace(info.Symbol), cfg.Name, strings.Join(addresses, ", "),
+		formatUnits(amountIn, 18), cfg.NativeSymbol,
+		formatUnits(route.AmountOut, info.Decimals), markdownEscaper.Replace(info.Symbol),
+		route, impact, a.defaultSettings().Slippage, gas), nil
+}
+
+// buyAndReport buys token for amountIn from each wallet and replies with the
+// per-wallet results.
+func (a *application) buyAndReport(cfg chainConfig, token string, amountIn *big.Int, wallets []*models.Wallet, opts buyOptions, m *tbot.Message) {
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	info, err := readTokenInfo(ctx, client, common.HexToAddress(token))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return
+	}
+
+	results, quote, err := a.buyToken(ctx, cfg, m.Chat.ID, info, amountIn, wallets, opts)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Buy failed: "+err.Error())
+		return
+	}
+
+	buyMsg := fmt.Sprintf(`🛒 Buy %s (🔗%s)
+
+Spent per wallet: %s %s
+Expected per wallet: %s %s
+Route: %s
+Slippage: %d%%
+
+%s`, markdownEscaper.Replace(info.Symbol), cfg.Name,
+		formatUnits(amountIn, 18), cfg.NativeSymbol,
+		formatUnits(quote.Route.AmountOut, info.Decimals), markdownEscaper.Replace(info.Symbol),
+		quote.Route, a.defaultSettings().Slippage, formatSwapResults(cfg, results))
+	for _, warning := range quote.Pool.Warnings {
+		buyMsg += "\n⚠️ " + markdownEscaper.Replace(warning)
+	}
+	if quote.SafetySkipped {
+		buyMsg += fmt.Sprintf("\n⚠️ Honeypot and tax checks were skipped: the %s RPC cannot simulate transactions and Unchecked Buys is on.", cfg.Name)
+	}
+
+	a.client.SendMessage(m.Chat.ID, buyMsg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+}
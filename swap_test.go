@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/models"
+)
+
+var (
+	stubRouter  = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	stubFactory = common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	stubPair    = common.HexToAddress("0x00000000000000000000000000000000000000a3")
+	stubToken   = common.HexToAddress("0x00000000000000000000000000000000000000a4")
+	stubWrapped = common.HexToAddress("0x00000000000000000000000000000000000000a5")
+	// stubRouterImpl holds the router's code when stubRouter is gated.
+	stubRouterImpl = common.HexToAddress("0x00000000000000000000000000000000000000a6")
+)
+
+// stubMarket is a V2 market of stubToken on a testChain. The router quotes
+// amountOut for any amount, the token hands every holder received, and a
+// sell pays back sellPaid of the native coin, so the safety check measures a
+// buy tax of received against amountOut and a sell tax of sellPaid against
+// amountOut. A gated market's router reverts until openTrading() is called
+// on it.
+type stubMarket struct {
+	amountIn, amountOut *big.Int
+	received, sellPaid  *big.Int
+	supply              *big.Int
+	gated               bool
+}
+
+func (m stubMarket) alloc(t *testing.T) types.GenesisAlloc {
+	t.Helper()
+	routerCode := map[[4]byte][]byte{}
+	stubReturn(t, routerCode, uniswapV2RouterABI, "getAmountsOut", []*big.Int{m.amountIn, m.amountOut})
+	stubReturn(t, routerCode, uniswapV2RouterABI, "swapExactETHForTokensSupportingFeeOnTransferTokens")
+	stubReturn(t, routerCode, uniswapV2RouterABI, "swapExactTokensForETHSupportingFeeOnTransferTokens")
+	sell := [4]byte(uniswapV2RouterABI.Methods["swapExactTokensForETHSupportingFeeOnTransferTokens"].ID)
+	factoryCode := map[[4]byte][]byte{}
+	stubReturn(t, factoryCode, uniswapV2FactoryABI, "getPair", stubPair)
+	pairCode := map[[4]byte][]byte{}
+	stubReturn(t, pairCode, uniswapV2PairABI, "token0", stubToken)
+	stubReturn(t, pairCode, uniswapV2PairABI, "getReserves", new(big.Int).Div(m.supply, big.NewInt(2)), big.NewInt(5e18), uint32(0))
+	stubReturn(t, pairCode, erc20ABI, "totalSupply", big.NewInt(1e18))
+	stubReturn(t, pairCode, erc20ABI, "balanceOf", big.NewInt(0))
+	tokenCode := map[[4]byte][]byte{}
+	stubReturn(t, tokenCode, erc20ABI, "balanceOf", m.received)
+	stubReturn(t, tokenCode, erc20ABI, "transfer", true)
+	stubReturn(t, tokenCode, erc20ABI, "approve", true)
+
+	alloc := types.GenesisAlloc{
+		stubRouter:  {Code: payingStubContract(routerCode, map[[4]byte]*big.Int{sell: m.sellPaid}), Balance: new(big.Int).Mul(m.sellPaid, big.NewInt(100))},
+		stubFactory: {Code: stubContract(factoryCode)},
+		stubPair:    {Code: stubContract(pairCode)},
+		stubToken:   {Code: stubContract(tokenCode)},
+	}
+	if m.gated {
+		alloc[stubRouterImpl] = types.Account{Code: alloc[stubRouter].Code}
+		alloc[stubRouter] = types.Account{Code: gatedContract(stubRouterImpl, selector("openTrading()")), Balance: alloc[stubRouter].Balance}
+	}
+	return alloc
+}
+
+func (m stubMarket) chain() chainConfig {
+	return chainConfig{
+		Name:          "Simulated",
+		ChainID:       testChainID,
+		NativeSymbol:  "ETH",
+		V2Router:      stubRouter.Hex(),
+		V2Factory:     stubFactory.Hex(),
+		WrappedNative: stubWrapped.Hex(),
+	}
+}
+
+func (m stubMarket) token() *tokenInfo {
+	return &tokenInfo{Address: stubToken, Name: "Stub", Symbol: "STUB", Decimals: 18, TotalSupply: m.supply}
+}
+
+// newStubMarket quotes 5e20 tokens for 0.1 of the native coin, with a 5%
+// buy tax and a 10% sell tax.
+func newStubMarket() stubMarket {
+	amountOut := new(big.Int).Mul(big.NewInt(5e8), big.NewInt(1e12))
+	return stubMarket{
+		amountIn:  big.NewInt(1e17),
+		amountOut: amountOut,
+		received:  new(big.Int).Div(new(big.Int).Mul(amountOut, big.NewInt(95)), big.NewInt(100)),
+		sellPaid:  new(big.Int).Div(new(big.Int).Mul(amountOut, big.NewInt(90)), big.NewInt(100)),
+		supply:    new(big.Int).Mul(big.NewInt(1e9), big.NewInt(1e18)),
+	}
+}
+
+func TestBuyTokenReportsEachWallet(t *testing.T) {
+	market := newStubMarket()
+	amountIn := market.amountIn
+
+	fundedKey, _ := crypto.GenerateKey()
+	brokeKey, _ := crypto.GenerateKey()
+	funded := crypto.PubkeyToAddress(fundedKey.PublicKey)
+	broke := crypto.PubkeyToAddress(brokeKey.PublicKey)
+
+	alloc := market.alloc(t)
+	alloc[funded] = types.Account{Balance: new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))}
+	chain, client := newTestChain(t, alloc)
+
+	cfg := market.chain()
+	db, recorder := openRecordingDB(t)
+	recorder.answer("SELECT gwei FROM gas_presets", 5.0)
+	app := &application{db: db, ethClients: map[string]*ethclient.Client{cfg.Name: client}}
+
+	wallets := []*models.Wallet{
+		{Address: funded.Hex(), PrivateKey: hex.EncodeToString(crypto.FromECDSA(fundedKey))},
+		{Address: broke.Hex(), PrivateKey: hex.EncodeToString(crypto.FromECDSA(brokeKey))},
+		{Address: common.HexToAddress("0x00000000000000000000000000000000000000b1").Hex()},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	sentAt := time.Now()
+	results, quote, err := app.buyToken(ctx, cfg, "chat", market.token(), amountIn, wallets, buyOptions{})
+	if err != nil {
+		t.Fatalf("buyToken: %v", err)
+	}
+
+	if quote.Route.Version != 2 || quote.Route.AmountOut.Cmp(market.amountOut) != 0 {
+		t.Errorf("quote route = %v for %v, want V2 for %v", quote.Route, quote.Route.AmountOut, market.amountOut)
+	}
+	// The chain has no eth_simulateV1, so the check ran through eth_call
+	// with state overrides.
+	if quote.SafetySkipped || quote.Safety == nil {
+		t.Fatal("safety check skipped on a node with state overrides")
+	}
+	if math.Abs(quote.Safety.BuyTax-5) > 0.01 || math.Abs(quote.Safety.SellTax-10) > 0.01 || quote.Safety.Honeypot {
+		t.Errorf("safety = %+v, want a 5%% buy tax and a 10%% sell tax", quote.Safety)
+	}
+	if len(results) != len(wallets) {
+		t.Fatalf("got %d results, want one per wallet (%d)", len(results), len(wallets))
+	}
+	for i, result := range results {
+		if result.Wallet != wallets[i] {
+			t.Errorf("result %d is for %s, want %s", i, result.Wallet.Address, wallets[i].Address)
+		}
+		if result.Route != quote.Route {
+			t.Errorf("result %d route = %v, want %v", i, result.Route, quote.Route)
+		}
+		if result.AmountIn == nil || result.AmountIn.Cmp(amountIn) != 0 {
+			t.Errorf("result %d spends %v, want %v", i, result.AmountIn, amountIn)
+		}
+	}
+
+	if results[0].Err != nil || results[0].Tx == nil {
+		t.Fatalf("funded wallet: tx %v, err %v", results[0].Tx, results[0].Err)
+	}
+	if results[1].Err == nil || results[1].Tx != nil {
+		t.Errorf("unfunded wallet: tx %v, err %v, want an error", results[1].Tx, results[1].Err)
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "no private key") {
+		t.Errorf("wallet without key: err %v, want missing key", results[2].Err)
+	}
+	if got := recorder.count("INSERT INTO trades"); got != 1 {
+		t.Errorf("recorded %d trades, want 1 for the sent swap", got)
+	}
+
+	report := formatSwapResults(cfg, results)
+	if !strings.Contains(report, "via V2") || strings.Count(report, "❌") != 2 {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+
+	sent := chain.sent()
+	if len(sent) != 1 || sent[0].Hash() != results[0].Tx.Hash() {
+		t.Fatalf("chain mined %d transactions, want only the funded wallet's swap", len(sent))
+	}
+	swap := sent[0]
+	if chain.failed(swap.Hash()) {
+		t.Errorf("swap reverted on the router")
+	}
+	if to := swap.To(); to == nil || *to != stubRouter || swap.Value().Cmp(amountIn) != 0 {
+		t.Errorf("swap sent %v to %v, want %v to the router", swap.Value(), to, amountIn)
+	}
+
+	args, err := uniswapV2RouterABI.Methods["swapExactETHForTokensSupportingFeeOnTransferTokens"].Inputs.Unpack(swap.Data()[4:])
+	if err != nil {
+		t.Fatalf("decoding the swap: %v", err)
+	}
+	// The quote less the measured 5% buy tax, less the default 10% slippage.
+	wantMin := new(big.Int).Div(new(big.Int).Mul(market.amountOut, big.NewInt(95*90)), big.NewInt(100*100))
+	if diff := new(big.Int).Sub(args[0].(*big.Int), wantMin); diff.CmpAbs(new(big.Int).Div(wantMin, big.NewInt(1e9))) > 0 {
+		t.Errorf("amountOutMin = %v, want %v", args[0], wantMin)
+	}
+	if path := args[1].([]common.Address); len(path) != 2 || path[0] != stubWrapped || path[1] != stubToken {
+		t.Errorf("path = %v, want [wrapped native, token]", path)
+	}
+	if to := args[2].(common.Address); to != funded {
+		t.Errorf("tokens go to %s, want the buying wallet %s", to.Hex(), funded.Hex())
+	}
+	wantDeadline := sentAt.Add(swapDeadline).Unix()
+	if deadline := args[3].(*big.Int).Int64(); deadline < wantDeadline || deadline > wantDeadline+60 {
+		t.Errorf("deadline = %d, want %s from now (%d)", deadline, swapDeadline, wantDeadline)
+	}
+
+	// The chat's 5 gwei preset is the priority fee on top of twice the
+	// 1 gwei base fee.
+	if swap.Type() != types.DynamicFeeTxType || swap.GasTipCap().Cmp(big.NewInt(5e9)) != 0 || swap.GasFeeCap().Cmp(big.NewInt(7e9)) != 0 {
+		t.Errorf("swap priced at tip %v, fee cap %v, want the 5 gwei preset", swap.GasTipCap(), swap.GasFeeCap())
+	}
+	if swap.ChainId().Int64() != testChainID {
+		t.Errorf("swap signed for chain %v, want %d", swap.ChainId(), testChainID)
+	}
+}
+
+func TestBuyTokenRefusesUncheckedBuys(t *testing.T) {
+	market := newStubMarket()
+	key, _ := crypto.GenerateKey()
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	alloc := market.alloc(t)
+	alloc[owner] = types.Account{Balance: big.NewInt(1e18)}
+	chain, client := newTestChain(t, alloc)
+	chain.ignoreOverrides = true
+
+	cfg := market.chain()
+	db, _ := openRecordingDB(t)
+	app := &application{db: db, ethClients: map[string]*ethclient.Client{cfg.Name: client}}
+	wallets := []*models.Wallet{{Address: owner.Hex(), PrivateKey: hex.EncodeToString(crypto.FromECDSA(key))}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, _, err := app.buyToken(ctx, cfg, "chat", market.token(), market.amountIn, wallets, buyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "Unchecked Buys") {
+		t.Errorf("buyToken on a node that cannot simulate: err %v, want a refusal", err)
+	}
+	if sent := chain.sent(); len(sent) != 0 {
+		t.Errorf("sent %d transactions without a safety check", len(sent))
+	}
+}
+
+func TestBuyTokenBackrunsLiquidity(t *testing.T) {
+	market := newStubMarket()
+	market.gated = true
+	key, _ := crypto.GenerateKey()
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	alloc := market.alloc(t)
+	alloc[owner] = types.Account{Balance: big.NewInt(1e18)}
+	chain, client := newTestChain(t, alloc)
+	chain.simulates = true
+
+	cfg := market.chain()
+	db, _ := openRecordingDB(t)
+	app := &application{db: db, ethClients: map[string]*ethclient.Client{cfg.Name: client}}
+	wallets := []*models.Wallet{{Address: owner.Hex(), PrivateKey: hex.EncodeToString(crypto.FromECDSA(key))}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// Nothing trades on the latest block; the pending call opens the market.
+	if _, _, err := app.buyToken(ctx, cfg, "chat", market.token(), market.amountIn, wallets, buyOptions{}); err == nil {
+		t.Fatal("bought on a market that is not open yet")
+	}
+	pending := signPending(t, "openTrading()")
+	results, quote, err := app.buyToken(ctx, cfg, "chat", market.token(), market.amountIn, wallets, buyOptions{After: pending, Fees: matchFees(pending)})
+	if err != nil {
+		t.Fatalf("backrun: %v", err)
+	}
+	if quote.Route.AmountOut.Cmp(market.amountOut) != 0 || quote.Pool.Pool != stubPair {
+		t.Errorf("quoted %v from pool %s, want %v from the pair", quote.Route.AmountOut, quote.Pool.Pool.Hex(), market.amountOut)
+	}
+	if quote.SafetySkipped || math.Abs(quote.Safety.BuyTax-5) > 0.01 {
+		t.Errorf("safety = %+v, want the 5%% buy tax measured behind the pending call", quote.Safety)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("results = %+v, want the backrun sent", results)
+	}
+	if sent := chain.sent(); len(sent) != 1 || sent[0].GasTipCap().Cmp(pending.GasTipCap()) != 0 {
+		t.Errorf("sent %d transactions, want one priced like the pending call", len(sent))
+	}
+}
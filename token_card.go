@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/yanzay/tbot/v2"
+)
+
+const ownableABIJSON = `[
+	{"constant":true,"inputs":[],"name":"owner","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+var ownableABI = mustParseABI(ownableABIJSON)
+
+var (
+	evmAddressPattern    = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	solanaAddressPattern = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{32,44}$`)
+)
+
+// buyPresetAmounts are the native amounts offered as buy buttons on a token
+// card.
+var buyPresetAmounts = []string{"0.1", "0.2", "0.8", "1"}
+
+// sellPresetPercents are the balance percentages offered as sell buttons.
+var sellPresetPercents = []int{25, 50, 75, 100}
+
+func isEVMAddress(text string) bool {
+	return evmAddressPattern.MatchString(text)
+}
+
+func isSolanaAddress(text string) bool {
+	return solanaAddressPattern.MatchString(text)
+}
+
+// tokenCard is everything known about a token on one chain. Market fields
+// are nil when the token has no pool or no USD price is available.
+type tokenCard struct {
+	Chain chainConfig
+	Info  *tokenInfo
+	Owner *common.Address
+	// Route is the best V2 or V3 route buying the token, and Pool the pool
+	// it trades through.
+	Route           *swapRoute
+	Pool            *poolHealth
+	PriceNative     *big.Float
+	PriceUSD        *big.Float
+	LiquidityNative *big.Float
+	LiquidityUSD    *big.Float
+	MarketCapUSD    *big.Float
+	Safety          *tokenSafety
+}
+
+// loadTokenCard reads token metadata, ownership and the pool of the best V2
+// or V3 route for token.
+func (a *application) loadTokenCard(ctx context.Context, cfg chainConfig, token common.Address) (*tokenCard, error) {
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readTokenInfo(ctx, client, token)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &tokenCard{Chain: cfg, Info: info}
+	if out, err := callContract(ctx, client, token, ownableABI, "owner"); err == nil {
+		owner := out[0].(common.Address)
+		card.Owner = &owner
+	}
+
+	route, err := bestRoute(ctx, client, cfg, common.HexToAddress(cfg.WrappedNative), token, safetyProbeAmount)
+	if err != nil {
+		return card, nil
+	}
+	if card.PriceNative, err = routeNativePrice(route, info); err != nil {
+		log.Printf("Error pricing %s: %v", token.Hex(), err)
+		return card, nil
+	}
+	card.Route = route
+
+	if card.Pool, err = checkPool(ctx, client, cfg, info, route); err == nil {
+		// Both sides of the pool valued at the quoted price, about twice
+		// the native side for a V2 pair.
+		tokens := new(big.Float).Mul(toDecimal(card.Pool.TokenReserve, info.Decimals), card.PriceNative)
+		card.LiquidityNative = new(big.Float).Add(toDecimal(card.Pool.NativeReserve, 18), tokens)
+	} else {
+		log.Printf("Error checking pool of %s: %v", token.Hex(), err)
+	}
+	if card.Safety, err = analyzeTokenSafety(ctx, client, cfg, info, route, safetyProbeAmount, nil); err != nil {
+		log.Printf("Error checking safety of %s: %v", token.Hex(), err)
+	}
+
+	nativeUSD, err := nativeUSDPrice(ctx, client, cfg)
+	if err != nil {
+		log.Printf("Error reading %s price: %v", cfg.NativeSymbol, err)
+		return card, nil
+	}
+	card.PriceUSD = new(big.Float).Mul(card.PriceNative, nativeUSD)
+	if card.LiquidityNative != nil {
+		card.LiquidityUSD = new(big.Float).Mul(card.LiquidityNative, nativeUSD)
+	}
+	if info.TotalSupply != nil {
+		card.MarketCapUSD = new(big.Float).Mul(card.PriceUSD, toDecimal(info.TotalSupply, info.Decimals))
+	}
+	return card, nil
+}
+
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+func (c *tokenCard) String() string {
+	info := c.Info
+	owner := "Unknown"
+	if c.Owner != nil {
+		if *c.Owner == (common.Address{}) {
+			owner = "Renounced"
+		} else {
+			owner = fmt.Sprintf("[%s](%s)", shortAddress(c.Owner.Hex()), c.Chain.addressURL(c.Owner.Hex()))
+		}
+	}
+
+	supply := "Unknown"
+	if info.TotalSupply != nil {
+		supply = formatCompact(toDecimal(info.TotalSupply, info.Decimals))
+	}
+
+	market := "No liquidity pool found."
+	if c.Route != nil {
+		pool := c.Route.String()
+		liquidity := "Unknown"
+		if c.Pool != nil {
+			pool = fmt.Sprintf("[%s](%s) (%s)", shortAddress(c.Pool.Pool.Hex()), c.Chain.addressURL(c.Pool.Pool.Hex()), c.Route)
+			liquidity = fmt.Sprintf("%s (%s %s)", formatUSD(c.LiquidityUSD), formatCompact(c.LiquidityNative), c.Chain.NativeSymbol)
+		}
+		market = fmt.Sprintf(`Pool: %s
+Price: %s (%s %s)
+Liquidity: %s
+Market cap: %s`,
+			pool,
+			formatUSD(c.PriceUSD), formatCompact(c.PriceNative), c.Chain.NativeSymbol,
+			liquidity,
+			formatUSD(c.MarketCapUSD))
+	}
+	if c.Safety != nil {
+		market += "\n\n" + markdownEscaper.Replace(c.Safety.String())
+	}
+	if c.Pool != nil {
+		for _, warning := range c.Pool.Warnings {
+			market += "\n⚠️ " + markdownEscaper.Replace(warning)
+		}
+	}
+
+	return fmt.Sprintf(`🪙 %s (%s) (🔗%s)
+%s
+
+Decimals: %d
+Total supply: %s
+Owner: %s
+
+%s`, markdownEscaper.Replace(info.Name), markdownEscaper.Replace(info.Symbol), c.Chain.Name,
+		info.Address.Hex(), info.Decimals, supply, owner, market)
+}
+
+func makeTokenCardButtons(cfg chainConfig, token string) *tbot.InlineKeyboardMarkup {
+	var buyRow []tbot.InlineKeyboardButton
+	for _, amount := range buyPresetAmounts {
+		buyRow = append(buyRow, tbot.InlineKeyboardButton{
+			Text:         fmt.Sprintf("Buy %s %s", amount, cfg.NativeSymbol),
+			CallbackData: fmt.Sprintf("token_buy_%s_%s", amount, token),
+		})
+	}
+	buyRow = append(buyRow, tbot.InlineKeyboardButton{Text: "Buy X", CallbackData: "token_buy_x_" + token})
+
+	var sellRow []tbot.InlineKeyboardButton
+	for _, percent := range sellPresetPercents {
+		sellRow = append(sellRow, tbot.InlineKeyboardButton{
+			Text:         fmt.Sprintf("Sell %d%%", percent),
+			CallbackData: fmt.Sprintf("token_sell_%d_%s", percent, token),
+		})
+	}
+	sellRow = append(sellRow, tbot.InlineKeyboardButton{Text: "Sell X", CallbackData: "token_sell_x_" + token})
+
+	refreshButton := tbot.InlineKeyboardButton{Text: "🔄Refresh", CallbackData: "token_card_" + token}
+	explorerButton := tbot.InlineKeyboardButton{Text: "🔍Explorer", URL: cfg.addressURL(token)}
+
+	return &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tbot.InlineKeyboardButton{buyRow, sellRow, {refreshButton, explorerButton}},
+	}
+}
+
+// tokenCardHandler looks up a contract address on the active chain and replies
+// with its token card. It returns the card of an EVM token, or nil when none
+// was shown.
+func (a *application) tokenCardHandler(address string, m *tbot.Message) *tokenCard {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if !cfg.isEVM() {
+		if !isSolanaAddress(address) {
+			a.client.SendMessage(m.Chat.ID, fmt.Sprintf("That is not a %s address. Switch chains in Settings to look it up.", cfg.Name))
+			return nil
+		}
+		a.solanaTokenCardHandler(ctx, cfg, address, m)
+		return nil
+	}
+	if !isEVMAddress(address) {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("That is not a %s address. Switch chains in Settings to look it up.", cfg.Name))
+		return nil
+	}
+
+	card, err := a.loadTokenCard(ctx, cfg, common.HexToAddress(address))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return nil
+	}
+
+	buttons := makeTokenCardButtons(cfg, card.Info.Address.Hex())
+	a.client.SendMessage(m.Chat.ID, card.String(), tbot.OptParseModeMarkdown, tbot.OptInlineKeyboardMarkup(buttons), tbot.OptDisableWebPagePreview)
+	return card
+}
+
+func (a *application) solanaTokenCardHandler(ctx context.Context, cfg chainConfig, mint string, m *tbot.Message) {
+	supply, decimals, err := solanaTokenSupply(ctx, cfg, mint)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return
+	}
+
+	msg := fmt.Sprintf(`🪙 SPL token (🔗%s)
+%s
+
+Decimals: %d
+Total supply: %s
+
+Price and liquidity are not available for %s yet.`, cfg.Name, mint, decimals, formatCompact(toDecimal(supply, decimals)), cfg.Name)
+
+	buttons := &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tbot.InlineKeyboardButton{
+			{{Text: "🔄Refresh", CallbackData: "token_card_" + mint}, {Text: "🔍Explorer", URL: fmt.Sprintf("%s/token/%s", cfg.Explorer, mint)}},
+		},
+	}
+	a.client.SendMessage(m.Chat.ID, msg, tbot.OptInlineKeyboardMarkup(buttons))
+}
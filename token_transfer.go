@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+// tokenTransferDraft holds the choices made so far in the token transfer flow.
+type tokenTransferDraft struct {
+	Chain   chainConfig
+	From    *models.Wallet
+	Token   *tokenInfo
+	Balance *big.Int
+	Amount  *big.Int
+}
+
+func (a *application) tokenTransferDraft(chatID string) *tokenTransferDraft {
+	a.draftsMu.Lock()
+	defer a.draftsMu.Unlock()
+	return a.tokenTransfers[chatID]
+}
+
+func (a *application) setTokenTransferDraft(chatID string, draft *tokenTransferDraft) {
+	a.draftsMu.Lock()
+	defer a.draftsMu.Unlock()
+	if a.tokenTransfers == nil {
+		a.tokenTransfers = make(map[string]*tokenTransferDraft)
+	}
+	if draft == nil {
+		delete(a.tokenTransfers, chatID)
+		return
+	}
+	a.tokenTransfers[chatID] = draft
+}
+
+func (a *application) tokenTransferWalletHandler(m *tbot.Message) {
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	if !cfg.isEVM() {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Token transfers are not supported on %s yet.", cfg.Name))
+		return
+	}
+
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+
+	walletMsg := fmt.Sprintf(`
+Settings > Transfers > Token Transfer (🔗%s)
+
+Select the wallet you want to transfer tokens from.
+`, cfg.Name)
+
+	buttons := make([][]tbot.InlineKeyboardButton, 0, len(wallets)+1)
+	for i, wallet := range wallets {
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("%s (%d)", wallet.Address, i+1),
+			CallbackData: fmt.Sprintf("token_transfer_from_%d", i),
+		}})
+	}
+	buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "transfer_crypto"}})
+
+	a.client.SendMessage(m.Chat.ID, walletMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+// tokenTransferTokenHandler lists the tokens held by the selected wallet.
+func (a *application) tokenTransferTokenHandler(walletIndex int, m *tbot.Message) {
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if walletIndex >= len(wallets) || walletIndex < 0 {
+		a.client.SendMessage(m.Chat.ID, "Invalid wallet selection.")
+		return
+	}
+
+	cfg, err := a.currentChain()
+	if err != nil {
+		log.Printf("Error getting chain status: %v", err)
+		return
+	}
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	from := wallets[walletIndex]
+	a.setTokenTransferDraft(m.Chat.ID, &tokenTransferDraft{Chain: cfg, From: from})
+
+	tokens, err := database.GetWalletTokens(a.db, cfg.Name, from.Address)
+	if err != nil {
+		log.Printf("Error retrieving wallet tokens: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var holdings strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for _, holding := range walletTokenHoldings(ctx, client, tokens, common.HexToAddress(from.Address)) {
+		holdings.WriteString(fmt.Sprintf("%s: %s\n", holding.Token.Symbol, formatUnits(holding.Balance, holding.Token.Decimals)))
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("%s (%s)", holding.Token.Symbol, formatUnits(holding.Balance, holding.Token.Decimals)),
+			CallbackData: "token_transfer_token_" + holding.Token.Address.Hex(),
+		}})
+	}
+	if holdings.Len() == 0 {
+		holdings.WriteString("No known token holdings.\n")
+	}
+
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "📋Paste contract", CallbackData: "token_transfer_paste"}},
+		[]tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "token_transfer"}},
+	)
+
+	walletMsg := fmt.Sprintf(`Settings > Transfers > Token Transfer (🔗%s)
+From: %s
+
+Token holdings:
+%s
+Select the token to transfer or paste its contract address.`, cfg.Name, from.Address, holdings.String())
+
+	a.client.SendMessage(m.Chat.ID, walletMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+// tokenTransferSelectToken reads the token metadata and asks for the amount.
+func (a *application) tokenTransferSelectToken(tokenAddress string, m *tbot.Message) {
+	draft := a.tokenTransferDraft(m.Chat.ID)
+	if draft == nil {
+		a.client.SendMessage(m.Chat.ID, "Transfer expired. Please start again.")
+		return
+	}
+	if !common.IsHexAddress(tokenAddress) {
+		a.client.SendMessage(m.Chat.ID, "Invalid contract address.")
+		return
+	}
+
+	client, err := a.ethClient(draft.Chain)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	token := common.HexToAddress(tokenAddress)
+	info, err := readTokenInfo(ctx, client, token)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token: "+err.Error())
+		return
+	}
+	balance, err := tokenBalance(ctx, client, token, common.HexToAddress(draft.From.Address))
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to read token balance: "+err.Error())
+		return
+	}
+	if balance.Sign() == 0 {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Wallet %s holds no %s.", draft.From.Address, info.Symbol))
+		return
+	}
+
+	draft.Token = info
+	draft.Balance = balance
+	database.AddWalletToken(a.db, draft.Chain.Name, draft.From.Address, token.Hex())
+
+	a.waitingForTokenAmount = true
+	walletMsg := fmt.Sprintf(`Settings > Transfers > Token Transfer (🔗%s)
+From: %s
+Token: %s (%s)
+Available balance: %s %s
+
+Enter the amount you would like to transfer, or "max":`, draft.Chain.Name, draft.From.Address, info.Name, info.Symbol, formatUnits(balance, info.Decimals), info.Symbol)
+
+	a.client.SendMessage(m.Chat.ID, walletMsg)
+}
+
+func (a *application) tokenTransferAmountHandler(m *tbot.Message) {
+	draft := a.tokenTransferDraft(m.Chat.ID)
+	if draft == nil || draft.Token == nil {
+		a.client.SendMessage(m.Chat.ID, "Transfer expired. Please start again.")
+		return
+	}
+
+	var amount *big.Int
+	if strings.EqualFold(strings.TrimSpace(m.Text), "max") {
+		amount = new(big.Int).Set(draft.Balance)
+	} else {
+		parsed, err := parseUnits(m.Text, draft.Token.Decimals)
+		if err != nil {
+			a.waitingForTokenAmount = true
+			a.client.SendMessage(m.Chat.ID, "Invalid amount: "+err.Error()+"\nPlease enter the amount again:")
+			return
+		}
+		amount = parsed
+	}
+	if amount.Sign() <= 0 || amount.Cmp(draft.Balance) > 0 {
+		a.waitingForTokenAmount = true
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("Amount must be between 0 and %s %s. Please enter the amount again:", formatUnits(draft.Balance, draft.Token.Decimals), draft.Token.Symbol))
+		return
+	}
+	draft.Amount = amount
+
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	addressBook, err := database.GetAddressBook(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error retrieving address book: %v", err)
+	}
+
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, wallet := range wallets {
+		if strings.EqualFold(wallet.Address, draft.From.Address) {
+			continue
+		}
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("👛 %s (%d)", wallet.Address, i+1),
+			CallbackData: fmt.Sprintf("token_transfer_to_wallet_%d", i),
+		}})
+	}
+	for i, entry := range addressBook {
+		buttons = append(buttons, []tbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("📒 %s (%s)", entry.Label, shortAddress(entry.Address)),
+			CallbackData: fmt.Sprintf("token_transfer_to_book_%d", i),
+		}})
+	}
+	buttons = append(buttons,
+		[]tbot.InlineKeyboardButton{{Text: "✍️Paste address", CallbackData: "token_transfer_to_paste"}},
+		[]tbot.InlineKeyboardButton{{Text: "Cancel", CallbackData: "transfer_crypto"}},
+	)
+
+	walletMsg := fmt.Sprintf(`Settings > Transfers > Token Transfer (🔗%s)
+From: %s
+Amount: %s %s
+
+Select the destination:`, draft.Chain.Name, draft.From.Address, formatUnits(amount, draft.Token.Decimals), draft.Token.Symbol)
+
+	a.client.SendMessage(m.Chat.ID, walletMsg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+func (a *application) tokenTransferToWallet(walletIndex int, m *tbot.Message) {
+	wallets, err := database.GetAllWallets(a.db)
+	if err != nil {
+		log.Printf("Error retrieving wallets: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch wallets.")
+		return
+	}
+	if walletIndex >= len(wallets) || walletIndex < 0 {
+		a.client.SendMessage(m.Chat.ID, "Invalid wallet selection.")
+		return
+	}
+	a.executeTokenTransfer(wallets[walletIndex].Address, m)
+}
+
+func (a *application) tokenTransferToAddressBook(entryIndex int, m *tbot.Message) {
+	entries, err := database.GetAddressBook(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error retrieving address book: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch address book.")
+		return
+	}
+	if entryIndex >= len(entries) || entryIndex < 0 {
+		a.client.SendMessage(m.Chat.ID, "Invalid address book selection.")
+		return
+	}
+	a.executeTokenTransfer(entries[entryIndex].Address, m)
+}
+
+func (a *application) tokenTransferRecipientHandler(m *tbot.Message) {
+	address := strings.TrimSpace(m.Text)
+	if !common.IsHexAddress(address) {
+		a.waitingForTokenRecipient = true
+		a.client.SendMessage(m.Chat.ID, "Invalid address. Please paste the destination address again:")
+		return
+	}
+
+	database.SaveAddressBookEntry(a.db, &models.AddressBookEntry{
+		ChatID:  m.Chat.ID,
+		Label:   "Recent " + shortAddress(common.HexToAddress(address).Hex()),
+		Address: address,
+	})
+	a.executeTokenTransfer(address, m)
+}
+
+// executeTokenTransfer sends the drafted ERC-20 transfer to toAddress, once
+// confirmed when the chat has Trade Confirmation on.
+func (a *application) executeTokenTransfer(toAddress string, m *tbot.Message) {
+	draft := a.tokenTransferDraft(m.Chat.ID)
+	if draft == nil || draft.Token == nil || draft.Amount == nil {
+		a.client.SendMessage(m.Chat.ID, "Transfer expired. Please start again.")
+		return
+	}
+	a.setTokenTransferDraft(m.Chat.ID, nil)
+
+	to := common.HexToAddress(toAddress)
+	if strings.EqualFold(to.Hex(), draft.From.Address) {
+		a.client.SendMessage(m.Chat.ID, "Source and destination are the same wallet.")
+		return
+	}
+
+	a.confirmTrade(m, func() (string, error) {
+		return a.tokenTransferPreview(draft, to)
+	}, func() {
+		a.sendTokenTransfer(draft, to, m)
+	})
+}
+
+// tokenTransferPreview summarizes the transfer of draft to to.
+func (a *application) tokenTransferPreview(draft *tokenTransferDraft, to common.Address) (string, error) {
+	client, err := a.ethClient(draft.Chain)
+	if err != nil {
+		return "", err
+	}
+	data, err := erc20ABI.Pack("transfer", to, draft.Amount)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fees, err := suggestFees(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	gas := gasSummary(ctx, client, draft.Chain, fees, ethereum.CallMsg{From: common.HexToAddress(draft.From.Address), To: &draft.Token.Address, Data: data})
+
+	return fmt.Sprintf(`🚆 Confirm token transfer (🔗%s)
+
+From: %s
+To: %s
+Amount: %s %s
+Gas: %s`, draft.Chain.Name, draft.From.Address, to.Hex(), formatUnits(draft.Amount, draft.Token.Decimals),
+		markdownEscaper.Replace(draft.Token.Symbol), gas), nil
+}
+
+// sendTokenTransfer signs the ERC-20 transfer of draft to to and records it.
+func (a *application) sendTokenTransfer(draft *tokenTransferDraft, to common.Address, m *tbot.Message) {
+	key, err := loadPrivateKey(draft.From)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to initiate token transfer: "+err.Error())
+		return
+	}
+	client, err := a.ethClient(draft.Chain)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	data, err := erc20ABI.Pack("transfer", to, draft.Amount)
+	if err != nil {
+		log.Printf("Error packing transfer: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := a.sendTransaction(ctx, client, draft.Chain, key, draft.Token.Address, nil, data, nil)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to initiate token transfer: "+err.Error())
+		return
+	}
+
+	amount := formatUnits(draft.Amount, draft.Token.Decimals)
+	transfer := &database.TransferRecord{
+		FromChain:     draft.Chain.Name,
+		ToChain:       draft.Chain.Name,
+		FromToken:     draft.Token.Symbol,
+		ToToken:       draft.Token.Symbol,
+		Amount:        amount,
+		FromAddress:   draft.From.Address,
+		ToAddress:     to.Hex(),
+		TransactionID: tx.Hash().Hex(),
+		Status:        database.TransferStatusPending,
+		TokenAddress:  draft.Token.Address.Hex(),
+		ChatID:        m.Chat.ID,
+	}
+	buttons := &tbot.InlineKeyboardMarkup{}
+	if err := database.CreateTransferRecord(a.db, transfer); err != nil {
+		log.Printf("Error saving transfer record: %v", err)
+	} else {
+		buttons.InlineKeyboard = [][]tbot.InlineKeyboardButton{makePendingTransferButtons(transfer)}
+	}
+	if found, _ := database.FindMultipleWalletsByAddress(a.db, to.Hex()); found {
+		database.AddWalletToken(a.db, draft.Chain.Name, to.Hex(), draft.Token.Address.Hex())
+	}
+
+	transferMsg := fmt.Sprintf(`Token transfer sent! 🚆
+
+From: %s
+To: %s
+Amount: %s %s
+
+[View transaction](%s)`, draft.From.Address, to.Hex(), amount, markdownEscaper.Replace(draft.Token.Symbol), draft.Chain.txURL(tx.Hash().Hex()))
+
+	a.client.SendMessage(m.Chat.ID, transferMsg, tbot.OptParseModeMarkdown, tbot.OptInlineKeyboardMarkup(buttons))
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+	"github.com/yanzay/tbot/v2"
+)
+
+const (
+	transferPollInterval = 15 * time.Second
+	// transferDropTimeout is how long a transaction may be unknown to the node
+	// before it is considered dropped from the mempool.
+	transferDropTimeout = 30 * time.Minute
+)
+
+// trackTransfers polls pending transfers and trades until ctx is cancelled.
+func (a *application) trackTransfers(ctx context.Context) {
+	ticker := time.NewTicker(transferPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.pollPendingTransfers(ctx)
+			a.pollPendingTrades(ctx)
+		}
+	}
+}
+
+func (a *application) pollPendingTransfers(ctx context.Context) {
+	transfers, err := database.GetPendingTransferRecords(a.db)
+	if err != nil {
+		log.Printf("Error retrieving pending transfers: %v", err)
+		return
+	}
+
+	for _, transfer := range transfers {
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		var changed bool
+		if transfer.FromChain != transfer.ToChain {
+			changed, err = a.checkBridgeTransfer(checkCtx, transfer)
+		} else {
+			changed, err = a.checkTransactionTransfer(checkCtx, transfer)
+		}
+		cancel()
+
+		if err != nil {
+			log.Printf("Error checking transfer %s: %v", transfer.TransactionID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := database.UpdateTransferStatus(a.db, transfer); err != nil {
+			continue
+		}
+		a.notifyTransferStatus(transfer)
+	}
+}
+
+// checkTransactionTransfer looks up the receipts of an on-chain transfer's
+// transactions and reports whether its status changed. A replaced transfer is
+// settled by whichever of its transactions was mined, since a speed up or
+// cancellation can lose the race to the original.
+func (a *application) checkTransactionTransfer(ctx context.Context, transfer *database.TransferRecord) (bool, error) {
+	cfg := chainConfigFor(convertChainStatusNameToType(transfer.FromChain))
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	hashes := append([]string{transfer.TransactionID}, transfer.ReplacedTransactionIDs...)
+	var receipt *types.Receipt
+	var mined string
+	for _, hash := range hashes {
+		receipt, err = client.TransactionReceipt(ctx, common.HexToHash(hash))
+		if err == nil {
+			mined = hash
+			break
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return false, err
+		}
+	}
+	if receipt == nil {
+		for _, hash := range hashes {
+			_, _, err := client.TransactionByHash(ctx, common.HexToHash(hash))
+			if !errors.Is(err, ethereum.NotFound) {
+				return false, nil
+			}
+		}
+		if time.Since(transfer.CreatedAt) > transferDropTimeout {
+			transfer.Status = database.TransferStatusDropped
+			return true, nil
+		}
+		return false, nil
+	}
+
+	// Only the latest transaction can be the cancellation; a mined earlier
+	// one means the transfer went through after all.
+	cancelled := transfer.Status == database.TransferStatusCancelling && mined == transfer.TransactionID
+	switch {
+	case receipt.Status == 0:
+		transfer.Status = database.TransferStatusFailed
+	case cancelled:
+		transfer.Status = database.TransferStatusCancelled
+	default:
+		transfer.Status = database.TransferStatusConfirmed
+	}
+	transfer.TransactionID = mined
+	transfer.BlockNumber = receipt.BlockNumber.Uint64()
+	transfer.GasUsed = receipt.GasUsed
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		transfer.EffectiveFee = fee.String()
+	}
+	return true, nil
+}
+
+// checkBridgeTransfer asks the bridge for the state of a cross-chain transfer.
+func (a *application) checkBridgeTransfer(ctx context.Context, transfer *database.TransferRecord) (bool, error) {
+	provider, err := a.bridgeProvider(transfer.Provider)
+	if err != nil {
+		return false, err
+	}
+	status, err := provider.Status(ctx, transfer.TransactionID)
+	if err != nil {
+		return false, err
+	}
+	if status == transfer.Status {
+		return false, nil
+	}
+	transfer.Status = status
+	return true, nil
+}
+
+func (a *application) notifyTransferStatus(transfer *database.TransferRecord) {
+	if transfer.ChatID == "" {
+		return
+	}
+
+	var icon string
+	switch transfer.Status {
+	case database.TransferStatusConfirmed:
+		icon = "✅"
+	case database.TransferStatusFailed:
+		icon = "❌"
+	case database.TransferStatusCancelled:
+		icon = "🛑"
+	default:
+		icon = "⚠️"
+	}
+
+	msg := fmt.Sprintf(`%s Transfer %s
+
+From: %s (%s)
+To: %s (%s)
+Amount: %s %s
+`, icon, transfer.Status, transfer.FromAddress, transfer.FromChain, transfer.ToAddress, transfer.ToChain, transfer.Amount, transfer.FromToken)
+
+	if transfer.FromChain == transfer.ToChain {
+		cfg := chainConfigFor(convertChainStatusNameToType(transfer.FromChain))
+		if transfer.BlockNumber != 0 {
+			msg += fmt.Sprintf("Block: %d\nGas used: %d\n", transfer.BlockNumber, transfer.GasUsed)
+		}
+		if fee, ok := new(big.Int).SetString(transfer.EffectiveFee, 10); ok {
+			msg += fmt.Sprintf("Fee: %s %s\n", formatUnits(fee, 18), cfg.NativeSymbol)
+		}
+		msg += fmt.Sprintf("\n[View transaction](%s)", cfg.txURL(transfer.TransactionID))
+	} else {
+		msg += fmt.Sprintf("Bridge: %s\nTransfer ID: %s", transfer.Provider, transfer.TransactionID)
+	}
+
+	if _, err := a.client.SendMessage(transfer.ChatID, msg, tbot.OptParseModeMarkdown); err != nil {
+		log.Printf("Error sending transfer notification: %v", err)
+	}
+}
+
+// erc20TransferTopic is the log topic of the ERC-20 Transfer event.
+var erc20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// wrappedWithdrawalTopic is the log topic of WETH's Withdrawal event.
+var wrappedWithdrawalTopic = crypto.Keccak256Hash([]byte("Withdrawal(address,uint256)"))
+
+func (a *application) pollPendingTrades(ctx context.Context) {
+	trades, err := database.GetPendingTrades(a.db)
+	if err != nil {
+		log.Printf("Error retrieving pending trades: %v", err)
+		return
+	}
+
+	for _, trade := range trades {
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		changed, err := a.checkTrade(checkCtx, trade)
+		cancel()
+
+		if err != nil {
+			log.Printf("Error checking trade %s: %v", trade.TxHash, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := database.UpdateTradeResult(a.db, trade); err != nil {
+			continue
+		}
+		a.notifyTradeResult(trade)
+	}
+}
+
+// checkTrade looks up the receipt of a swap and fills in the amounts that
+// actually moved.
+func (a *application) checkTrade(ctx context.Context, trade *models.Trade) (bool, error) {
+	cfg := chainConfigFor(convertChainStatusNameToType(trade.Chain))
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	hash := common.HexToHash(trade.TxHash)
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		_, _, err := client.TransactionByHash(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) && time.Since(trade.Createdate) > transferDropTimeout {
+			trade.Status = database.TransferStatusDropped
+			return true, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	trade.BlockNumber = receipt.BlockNumber.Uint64()
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		trade.GasFee = fee.String()
+	}
+	if receipt.Status == 0 {
+		trade.Status = database.TransferStatusFailed
+		return true, nil
+	}
+	trade.Status = database.TransferStatusConfirmed
+	if price, err := nativeUSDPrice(ctx, client, cfg); err == nil {
+		trade.NativeUSD = price.Text('f', -1)
+	}
+
+	if trade.Side == database.TradeSideBuy {
+		trade.TokenAmount = receivedTokens(receipt, common.HexToAddress(trade.TokenAddress), common.HexToAddress(trade.WalletAddress)).String()
+	} else {
+		trade.NativeAmount = unwrappedNative(receipt, common.HexToAddress(cfg.WrappedNative)).String()
+	}
+	return true, nil
+}
+
+// unwrappedNative sums the wrapped native coin withdrawn in a receipt, which
+// is what a router pays out when selling for the native coin.
+func unwrappedNative(receipt *types.Receipt, wrapped common.Address) *big.Int {
+	total := new(big.Int)
+	for _, entry := range receipt.Logs {
+		if entry.Address != wrapped || len(entry.Topics) != 2 || entry.Topics[0] != wrappedWithdrawalTopic {
+			continue
+		}
+		total.Add(total, new(big.Int).SetBytes(entry.Data))
+	}
+	return total
+}
+
+// receivedTokens sums the token transfers to holder in a receipt.
+func receivedTokens(receipt *types.Receipt, token, holder common.Address) *big.Int {
+	total := new(big.Int)
+	for _, entry := range receipt.Logs {
+		if entry.Address != token || len(entry.Topics) != 3 || entry.Topics[0] != erc20TransferTopic {
+			continue
+		}
+		if common.BytesToAddress(entry.Topics[2].Bytes()) != holder {
+			continue
+		}
+		total.Add(total, new(big.Int).SetBytes(entry.Data))
+	}
+	return total
+}
+
+func (a *application) notifyTradeResult(trade *models.Trade) {
+	if trade.ChatID == "" {
+		return
+	}
+	cfg := chainConfigFor(convertChainStatusNameToType(trade.Chain))
+
+	symbol, decimals := shortAddress(trade.TokenAddress), uint8(18)
+	if client, err := a.ethClient(cfg); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if info, err := readTokenInfo(ctx, client, common.HexToAddress(trade.TokenAddress)); err == nil {
+			symbol, decimals = info.Symbol, info.Decimals
+		}
+		cancel()
+	}
+
+	var icon string
+	switch trade.Status {
+	case database.TransferStatusConfirmed:
+		icon = "✅"
+	case database.TransferStatusFailed:
+		icon = "❌"
+	default:
+		icon = "⚠️"
+	}
+
+	nativeAmount, _ := new(big.Int).SetString(trade.NativeAmount, 10)
+	tokenAmount, _ := new(big.Int).SetString(trade.TokenAmount, 10)
+	msg := fmt.Sprintf(`%s %s %s %s
+
+Wallet: %s
+Amount: %s %s ⇄ %s %s
+`, icon, strings.ToUpper(trade.Side[:1])+trade.Side[1:], markdownEscaper.Replace(symbol), trade.Status,
+		trade.WalletAddress,
+		formatUnits(nativeAmount, 18), cfg.NativeSymbol, formatUnits(tokenAmount, decimals), markdownEscaper.Replace(symbol))
+	if fee, ok := new(big.Int).SetString(trade.GasFee, 10); ok {
+		msg += fmt.Sprintf("Fee: %s %s\n", formatUnits(fee, 18), cfg.NativeSymbol)
+	}
+	msg += fmt.Sprintf("\n[View transaction](%s)", cfg.txURL(trade.TxHash))
+
+	if _, err := a.client.SendMessage(trade.ChatID, msg, tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview); err != nil {
+		log.Printf("Error sending trade notification: %v", err)
+	}
+}
+
+func makePendingTransferButtons(transfer *database.TransferRecord) []tbot.InlineKeyboardButton {
+	return []tbot.InlineKeyboardButton{
+		{Text: "⚡Speed up", CallbackData: "tx_speedup_" + transfer.ID.String()},
+		{Text: "🛑Cancel", CallbackData: "tx_cancel_" + transfer.ID.String()},
+	}
+}
+
+// pendingTransactionsHandler lists the chat's unconfirmed transfers with
+// actions to speed up or cancel them.
+func (a *application) pendingTransactionsHandler(m *tbot.Message) {
+	transfers, err := database.GetPendingTransferRecordsByChat(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error retrieving pending transfers: %v", err)
+		a.client.SendMessage(m.Chat.ID, "Failed to fetch pending transactions.")
+		return
+	}
+
+	var details strings.Builder
+	var buttons [][]tbot.InlineKeyboardButton
+	for i, transfer := range transfers {
+		if transfer.FromChain != transfer.ToChain {
+			continue
+		}
+		details.WriteString(fmt.Sprintf("%d: %s %s → %s (%s)\n%s\n", i+1, transfer.Amount, transfer.FromToken, shortAddress(transfer.ToAddress), transfer.Status, transfer.TransactionID))
+		if transfer.Status == database.TransferStatusPending {
+			buttons = append(buttons, makePendingTransferButtons(transfer))
+		}
+	}
+	if details.Len() == 0 {
+		details.WriteString("No pending transactions.")
+	}
+	buttons = append(buttons, []tbot.InlineKeyboardButton{{Text: "Back", CallbackData: "transfer_crypto"}})
+
+	msg := fmt.Sprintf(`Settings > Transfers > Pending
+
+%s`, details.String())
+	a.client.SendMessage(m.Chat.ID, msg, tbot.OptInlineKeyboardMarkup(&tbot.InlineKeyboardMarkup{InlineKeyboard: buttons}))
+}
+
+// replaceTransferHandler speeds up or cancels the transaction of a pending
+// transfer.
+func (a *application) replaceTransferHandler(transferID string, cancel bool, m *tbot.Message) {
+	id, err := uuid.Parse(transferID)
+	if err != nil {
+		log.Printf("Parse error: %v", err)
+		return
+	}
+	transfer, err := database.GetTransferRecord(a.db, id)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Transfer not found.")
+		return
+	}
+	if transfer.Status != database.TransferStatusPending || transfer.FromChain != transfer.ToChain {
+		a.client.SendMessage(m.Chat.ID, fmt.Sprintf("This transfer can no longer be changed (%s).", transfer.Status))
+		return
+	}
+
+	wallet, err := database.GetWalletByAddress(a.db, transfer.FromAddress)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Sending wallet not found.")
+		return
+	}
+	key, err := loadPrivateKey(wallet)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+	cfg := chainConfigFor(convertChainStatusNameToType(transfer.FromChain))
+	client, err := a.ethClient(cfg)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, err.Error())
+		return
+	}
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelCtx()
+
+	tx, err := a.replaceTransaction(ctx, client, cfg, key, common.HexToHash(transfer.TransactionID), cancel)
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to replace transaction: "+err.Error())
+		return
+	}
+
+	status, action := database.TransferStatusPending, "Speed up"
+	if cancel {
+		status, action = database.TransferStatusCancelling, "Cancellation"
+	}
+	if err := database.ReplaceTransferTransaction(a.db, transfer.ID, tx.Hash().Hex(), status); err != nil {
+		log.Printf("Error updating transfer: %v", err)
+	}
+
+	msg := fmt.Sprintf(`%s sent for transfer of %s %s.
+
+[View transaction](%s)`, action, transfer.Amount, transfer.FromToken, cfg.txURL(tx.Hash().Hex()))
+	a.client.SendMessage(m.Chat.ID, msg, tbot.OptParseModeMarkdown)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/google/uuid"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/yanzay/tbot/v2"
+)
+
+// tradeConfirmWindow is how long the Confirm button of a trade stays valid.
+const tradeConfirmWindow = time.Minute
+
+// pendingTrade is a trade waiting for its Confirm or Cancel button.
+type pendingTrade struct {
+	ChatID  string
+	Expires time.Time
+	Execute func()
+}
+
+func makeTradeConfirmButtons(enabled bool) *tbot.InlineKeyboardMarkup {
+	on, off := "On", "Off🟢"
+	if enabled {
+		on, off = "On🟢", "Off"
+	}
+	btnGroup := []tbot.InlineKeyboardButton{
+		{Text: on, CallbackData: "new_trade_on"},
+		{Text: off, CallbackData: "new_trade_off"},
+	}
+
+	btnCancel := tbot.InlineKeyboardButton{
+		Text:         "Cancel",
+		CallbackData: "cancel_trade_confirm",
+	}
+
+	buttons := [][]tbot.InlineKeyboardButton{
+		btnGroup,
+		{btnCancel},
+	}
+	return &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: buttons,
+	}
+}
+
+func (a *application) tradeConfirmHandler(m *tbot.Message) {
+	enabled, err := database.GetTradeConfirmation(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting trade confirmation: %v", err)
+	}
+
+	tradeConfirmMsg := `Settings > Trade Confirmation
+
+When on, this option will show an additional confirmation dialog
+before tokens are bought, sold or transferred. This helps to avoid
+accidental transactions.`
+
+	buttons := makeTradeConfirmButtons(enabled)
+
+	a.client.SendMessage(m.Chat.ID, tradeConfirmMsg, tbot.OptInlineKeyboardMarkup(buttons))
+}
+
+// setTradeConfirmationHandler saves the Trade Confirmation preset and redraws
+// its screen.
+func (a *application) setTradeConfirmationHandler(enabled bool, m *tbot.Message) {
+	if err := database.SetTradeConfirmation(a.db, m.Chat.ID, enabled); err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to save settings.")
+		return
+	}
+	a.tradeConfirmHandler(m)
+}
+
+// confirmTrade runs execute right away when the chat has Trade Confirmation
+// off. Otherwise it sends the summary returned by preview with Confirm and
+// Cancel buttons, and runs execute once Confirm is pressed within
+// tradeConfirmWindow.
+func (a *application) confirmTrade(m *tbot.Message, preview func() (string, error), execute func()) {
+	enabled, err := database.GetTradeConfirmation(a.db, m.Chat.ID)
+	if err != nil {
+		log.Printf("Error getting trade confirmation: %v", err)
+	}
+	if !enabled {
+		execute()
+		return
+	}
+
+	summary, err := preview()
+	if err != nil {
+		a.client.SendMessage(m.Chat.ID, "Failed to prepare trade: "+err.Error())
+		return
+	}
+
+	id := uuid.NewString()
+	a.draftsMu.Lock()
+	if a.pendingTrades == nil {
+		a.pendingTrades = make(map[string]*pendingTrade)
+	}
+	a.pendingTrades[id] = &pendingTrade{ChatID: m.Chat.ID, Expires: time.Now().Add(tradeConfirmWindow), Execute: execute}
+	a.draftsMu.Unlock()
+
+	buttons := &tbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tbot.InlineKeyboardButton{{
+			{Text: "✅ Confirm", CallbackData: "trade_ok_" + id},
+			{Text: "❌ Cancel", CallbackData: "trade_no_" + id},
+		}},
+	}
+	summary += fmt.Sprintf("\n\nConfirm within %s.", tradeConfirmWindow)
+	sent, err := a.client.SendMessage(m.Chat.ID, summary, tbot.OptParseModeMarkdown, tbot.OptInlineKeyboardMarkup(buttons), tbot.OptDisableWebPagePreview)
+	if err != nil {
+		log.Printf("Error sending trade confirmation: %v", err)
+		return
+	}
+
+	time.AfterFunc(tradeConfirmWindow, func() {
+		a.draftsMu.Lock()
+		_, waiting := a.pendingTrades[id]
+		delete(a.pendingTrades, id)
+		a.draftsMu.Unlock()
+		if waiting {
+			a.client.EditMessageText(m.Chat.ID, sent.MessageID, summary+"\n\n⌛ Expired.", tbot.OptParseModeMarkdown, tbot.OptDisableWebPagePreview)
+		}
+	})
+}
+
+// tradeConfirmResponseHandler runs or drops the pending trade id.
+func (a *application) tradeConfirmResponseHandler(id string, confirmed bool, m *tbot.Message) {
+	a.draftsMu.Lock()
+	trade, ok := a.pendingTrades[id]
+	delete(a.pendingTrades, id)
+	a.draftsMu.Unlock()
+
+	switch {
+	case !ok || trade.ChatID != m.Chat.ID || time.Now().After(trade.Expires):
+		a.client.SendMessage(m.Chat.ID, "This trade has expired. Please start it again.")
+	case !confirmed:
+		a.client.SendMessage(m.Chat.ID, "Trade cancelled.")
+	default:
+		trade.Execute()
+	}
+}
+
+// maxPrice is the most a transaction priced at f pays per unit of gas.
+func (f *feeQuote) maxPrice() *big.Int {
+	if f.Dynamic {
+		return f.FeeCap
+	}
+	return f.GasPrice
+}
+
+// gasSummary describes fees for a confirmation, with the cost of msg when its
+// gas can be estimated.
+func gasSummary(ctx context.Context, client *ethclient.Client, cfg chainConfig, fees *feeQuote, msg ethereum.CallMsg) string {
+	price := new(big.Float).Quo(new(big.Float).SetInt(fees.maxPrice()), gwei)
+	summary := fmt.Sprintf("up to %s gwei", price.Text('f', 2))
+	gas, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return summary
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gas), fees.maxPrice())
+	return fmt.Sprintf("%s (max %s %s per transaction)", summary, formatUnits(cost, 18), cfg.NativeSymbol)
+}
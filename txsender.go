@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/l3njo/rochambeau/database"
+	"github.com/l3njo/rochambeau/models"
+)
+
+func loadPrivateKey(wallet *models.Wallet) (*ecdsa.PrivateKey, error) {
+	if wallet.PrivateKey == "" {
+		return nil, fmt.Errorf("wallet %s has no private key", wallet.Address)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(wallet.PrivateKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key of %s: %w", wallet.Address, err)
+	}
+	return key, nil
+}
+
+// feeQuote holds the gas pricing for a transaction. EIP-1559 fees are used
+// when the chain reports a base fee, legacy gas pricing otherwise.
+type feeQuote struct {
+	Dynamic  bool
+	TipCap   *big.Int
+	FeeCap   *big.Int
+	GasPrice *big.Int
+}
+
+func suggestFees(ctx context.Context, client *ethclient.Client) (*feeQuote, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	if head.BaseFee == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get gas price: %w", err)
+		}
+		return &feeQuote{GasPrice: gasPrice}, nil
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas tip: %w", err)
+	}
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	return &feeQuote{Dynamic: true, TipCap: tip, FeeCap: feeCap}, nil
+}
+
+var gwei = big.NewFloat(1e9)
+
+// presetFees prices a transaction at a fixed gas price in gwei. On EIP-1559
+// chains the preset is paid as the priority fee on top of the base fee.
+func presetFees(ctx context.Context, client *ethclient.Client, gasGwei float64) (*feeQuote, error) {
+	price, _ := new(big.Float).Mul(big.NewFloat(gasGwei), gwei).Int(nil)
+
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if head.BaseFee == nil {
+		return &feeQuote{GasPrice: price}, nil
+	}
+	feeCap := new(big.Int).Add(price, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	return &feeQuote{Dynamic: true, TipCap: price, FeeCap: feeCap}, nil
+}
+
+// chatFees returns the fees from the chat's gas preset for cfg, or nil to use
+// network suggestions when no preset is saved.
+func (a *application) chatFees(ctx context.Context, client *ethclient.Client, cfg chainConfig, chatID string) (*feeQuote, error) {
+	gasGwei, err := database.GetGasPreset(a.db, chatID, cfg.Name)
+	if err != nil {
+		log.Printf("Error getting gas preset: %v", err)
+	}
+	if gasGwei <= 0 {
+		return nil, nil
+	}
+	return presetFees(ctx, client, gasGwei)
+}
+
+func (f *feeQuote) txData(cfg chainConfig, nonce, gas uint64, to common.Address, value *big.Int, data []byte) types.TxData {
+	if f.Dynamic {
+		return &types.DynamicFeeTx{
+			ChainID:   cfg.chainID(),
+			Nonce:     nonce,
+			GasTipCap: f.TipCap,
+			GasFeeCap: f.FeeCap,
+			Gas:       gas,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		}
+	}
+	return &types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: f.GasPrice,
+		Gas:      gas,
+		To:       &to,
+		Value:    value,
+		Data:     data,
+	}
+}
+
+// sendTransaction signs and broadcasts a transaction from key using a nonce
+// reserved from the wallet's nonce manager. Network fees are suggested when
+// fees is nil.
+func (a *application) sendTransaction(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte, fees *feeQuote) (*types.Transaction, error) {
+	return a.sendTransactionAfter(ctx, client, cfg, key, to, value, data, fees, nil)
+}
+
+// sendTransactionAfter is sendTransaction for a transaction that only
+// succeeds once the pending transaction after is mined, such as a backrun.
+// Gas is estimated and the transaction simulated on top of after.
+func (a *application) sendTransactionAfter(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte, fees *feeQuote, after *types.Transaction) (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	msg := ethereum.CallMsg{From: from, To: &to, Value: value, Data: data}
+	var gas uint64
+	var err error
+	if after == nil {
+		if gas, err = client.EstimateGas(ctx, msg); err != nil {
+			return nil, &simulationError{Reason: revertReason(err)}
+		}
+	} else {
+		if gas, err = simulateAfter(ctx, client, after, msg); err != nil {
+			return nil, err
+		}
+		// Simulated usage is exact; leave headroom for state changing
+		// between the simulation and inclusion.
+		gas = gas * 13 / 10
+	}
+	if fees == nil {
+		fees, err = suggestFees(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nonce, err := a.nonces.reserve(ctx, client, cfg.Name, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	return a.signAndSendAfter(ctx, client, cfg, key, fees.txData(cfg, nonce, gas, to, value, data), after)
+}
+
+// signAndSend signs txData, simulates the signed transaction and broadcasts
+// it. Every transaction the bot sends goes through here, so transactions that
+// would revert are refused before they cost gas. The sender's nonce is
+// resynced when the transaction is not sent.
+func (a *application) signAndSend(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, txData types.TxData) (*types.Transaction, error) {
+	return a.signAndSendAfter(ctx, client, cfg, key, txData, nil)
+}
+
+// signAndSendAfter is signAndSend simulating on top of the pending
+// transaction after when it is set.
+func (a *application) signAndSendAfter(ctx context.Context, client *ethclient.Client, cfg chainConfig, key *ecdsa.PrivateKey, txData types.TxData, after *types.Transaction) (*types.Transaction, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	signed, err := types.SignNewTx(key, types.LatestSignerForChainID(cfg.chainID()), txData)
+	if err != nil {
+		a.nonces.resync(cfg.Name, from)
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	if after == nil {
+		err = simulateTransaction(ctx, client, from, signed)
+	} else {
+		_, err = simulateAfter(ctx, client, after, callMsgFromTx(from, signed))
+	}
+	if err != nil {
+		a.nonces.resync(cfg.Name, from)
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, signed); err != nil {
+		a.nonces.resync(cfg.Name, from)
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+	return signed, nil
+}